@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"unreal.sh/echo/internal/server/services"
+)
+
+func main() {
+	target := flag.Duration("target", 250*time.Millisecond, "desired time to hash a single password")
+	memory := flag.Uint("memory", 64*1024, "memory to use, in KiB")
+	parallelism := flag.Uint("parallelism", 2, "number of lanes")
+	flag.Parse()
+
+	params := services.CalibrateHashParams(*target, uint32(*memory), uint8(*parallelism))
+
+	for _, line := range params.Environment() {
+		fmt.Println(line)
+	}
+}
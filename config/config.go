@@ -0,0 +1,15 @@
+// Package config holds the default data files the server is shipped with.
+package config
+
+import _ "embed"
+
+// Achievements is the default achievements.json, used unless ACHIEVEMENTS_FILE is set or the
+// achievements collection has some.
+//
+//go:embed achievements.json
+var Achievements []byte
+
+// ImpactFactors is the default impact_factors.json, used unless IMPACT_FACTORS_FILE is set.
+//
+//go:embed impact_factors.json
+var ImpactFactors []byte
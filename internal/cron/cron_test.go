@@ -0,0 +1,165 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec  string
+		valid bool
+	}{
+		{"* * * * *", true},
+		{"*/15 0-6 1,15 * 1-5", true},
+		{"0-30/10 * * * *", true},
+		{"5/20 * * * *", true},
+		{"0 0 * * 7", true},
+		{"  @daily  ", true},
+		{"@hourly", true},
+		{"@weekly", true},
+		{"@monthly", true},
+		{"@yearly", true},
+		{"@every 90s", true},
+		{"@every 10m", true},
+
+		{"", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * 32 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"5-1 * * * *", false},
+		{"*/0 * * * *", false},
+		{"*/x * * * *", false},
+		{"a * * * *", false},
+		{"1- * * * *", false},
+		{"1,,2 * * * *", false},
+		{"@annually", false},
+		{"@every", false},
+		{"@every 500ms", false},
+		{"@every soon", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if tt.valid && err != nil {
+				t.Fatalf("Parse(%q) returned %v", tt.spec, err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatalf("Parse(%q) = %v, want an error", tt.spec, s)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"*/5 * * * *", "*/5 * * * *"},
+		{" @daily ", "@daily"},
+		{"@every 90s", "@every 1m30s"},
+	}
+
+	for _, tt := range tests {
+		if got := MustParse(tt.spec).String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	date := func(value string) time.Time {
+		d, err := time.Parse("2006-01-02 15:04:05", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name string
+		spec string
+		from string
+		want string
+	}{
+		{"every minute", "* * * * *", "2024-03-10 12:30:45", "2024-03-10 12:31:00"},
+		{"on the minute", "* * * * *", "2024-03-10 12:30:00", "2024-03-10 12:31:00"},
+		{"steps", "*/15 * * * *", "2024-03-10 12:31:00", "2024-03-10 12:45:00"},
+		{"steps from a start", "5/20 * * * *", "2024-03-10 12:26:00", "2024-03-10 12:45:00"},
+		{"range", "0 9-17 * * *", "2024-03-10 17:30:00", "2024-03-11 09:00:00"},
+		{"list", "0 0 1,15 * *", "2024-03-02 00:00:00", "2024-03-15 00:00:00"},
+		{"hourly", "@hourly", "2024-03-10 12:59:59", "2024-03-10 13:00:00"},
+		{"daily", "@daily", "2024-03-10 00:00:00", "2024-03-11 00:00:00"},
+		{"weekly on Sunday", "@weekly", "2024-03-11 08:00:00", "2024-03-17 00:00:00"},
+		{"Sunday as 7", "0 0 * * 7", "2024-03-11 08:00:00", "2024-03-17 00:00:00"},
+		{"Sunday as 0", "0 0 * * 0", "2024-03-11 08:00:00", "2024-03-17 00:00:00"},
+		{"weekdays", "0 8 * * 1-5", "2024-03-08 09:00:00", "2024-03-11 08:00:00"},
+		{"day of month or week", "0 0 13 * 5", "2024-09-01 00:00:00", "2024-09-06 00:00:00"},
+		{"day of month or week, month first", "0 0 2 * 5", "2024-09-01 00:00:00", "2024-09-02 00:00:00"},
+		{"day of month with any weekday", "0 0 13 * *", "2024-09-01 00:00:00", "2024-09-13 00:00:00"},
+		{"day of week with any day of month", "0 0 * * 5", "2024-09-07 00:00:00", "2024-09-13 00:00:00"},
+		{"month rollover", "0 0 1 * *", "2024-01-31 12:00:00", "2024-02-01 00:00:00"},
+		{"year rollover", "@yearly", "2024-12-31 23:59:00", "2025-01-01 00:00:00"},
+		{"short month", "0 0 31 * *", "2024-04-01 00:00:00", "2024-05-31 00:00:00"},
+		{"leap day", "0 0 29 2 *", "2025-01-01 00:00:00", "2028-02-29 00:00:00"},
+		{"restricted month", "30 6 * 6 *", "2024-07-01 00:00:00", "2025-06-01 06:30:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MustParse(tt.spec).Next(date(tt.from))
+			if want := date(tt.want); !got.Equal(want) {
+				t.Errorf("Next(%s) of %q = %s, want %s", tt.from, tt.spec, got, want)
+			}
+		})
+	}
+}
+
+func TestNextNeverMatching(t *testing.T) {
+	for _, spec := range []string{"0 0 30 2 *", "0 0 31 4,6,9,11 *"} {
+		if got := MustParse(spec).Next(time.Now()); !got.IsZero() {
+			t.Errorf("Next of %q = %s, want the zero time", spec, got)
+		}
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	location := time.FixedZone("UTC+9", 9*60*60)
+
+	got := MustParse("@daily").Next(time.Date(2024, 3, 10, 12, 0, 0, 0, location))
+	if want := time.Date(2024, 3, 11, 0, 0, 0, 0, location); !got.Equal(want) {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestEvery(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		from     time.Time
+		want     time.Time
+	}{
+		{time.Minute, time.Unix(90, 0), time.Unix(120, 0)},
+		{time.Minute, time.Unix(120, 0), time.Unix(180, 0)},
+		{10 * time.Minute, time.Unix(599, 0), time.Unix(600, 0)},
+		{90 * time.Second, time.Unix(100, 0), time.Unix(180, 0)},
+	}
+
+	for _, tt := range tests {
+		if got := Every(tt.interval).Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("Every(%s).Next(%d) = %d, want %d", tt.interval, tt.from.Unix(), got.Unix(), tt.want.Unix())
+		}
+	}
+
+	// Schedules created at different times agree on when they're due.
+	parsed := MustParse("@every 10m")
+	if got, want := parsed.Next(time.Unix(1234, 0)), Every(10*time.Minute).Next(time.Unix(1234, 0)); !got.Equal(want) {
+		t.Errorf("@every 10m is due at %d, Every(10m) at %d", got.Unix(), want.Unix())
+	}
+}
@@ -7,17 +7,23 @@ import (
 	"strings"
 
 	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
 )
 
 type MiddlewareContextKey string
 
 const (
-	TokenContextKey  MiddlewareContextKey = "token"
-	UserContextKey   MiddlewareContextKey = "user"
-	ClaimsContextKey MiddlewareContextKey = "claims"
+	TokenContextKey    MiddlewareContextKey = "token"
+	UserContextKey     MiddlewareContextKey = "user"
+	ClaimsContextKey   MiddlewareContextKey = "claims"
+	SessionContextKey  MiddlewareContextKey = "session"
+	ApiTokenContextKey MiddlewareContextKey = "api_token"
 )
 
-func ValidateToken(authService *services.AuthService) func(http.Handler) http.Handler {
+// ValidateToken checks the bearer token of the request, which is either a JWT or a personal access token.
+// Personal access tokens are fully authenticated here, as they have no session.
+func ValidateToken(authService *services.AuthService, apiTokenService *services.ApiTokenService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 			// Get the JWT token from the Authorization header
@@ -34,6 +40,20 @@ func ValidateToken(authService *services.AuthService) func(http.Handler) http.Ha
 				return
 			}
 
+			if strings.HasPrefix(token, structures.ApiTokenPrefix) {
+				apiToken, user, err := apiTokenService.Authenticate(token)
+				if err != nil {
+					http.Error(rw, "Invalid API token", http.StatusUnauthorized)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), TokenContextKey, token)
+				ctx = context.WithValue(ctx, UserContextKey, user)
+				ctx = context.WithValue(ctx, ApiTokenContextKey, apiToken)
+				next.ServeHTTP(rw, r.WithContext(ctx))
+				return
+			}
+
 			// Validate the token
 			// If the token is invalid, return an error
 			// If the token is valid, set the user in the context and call the next handler
@@ -54,9 +74,17 @@ func ValidateToken(authService *services.AuthService) func(http.Handler) http.Ha
 	}
 }
 
-func RequireAuthentication(authService *services.AuthService) func(http.Handler) http.Handler {
+// RequireAuthentication loads the user and session of the token, rejecting it if the session was revoked.
+// The session's last used time is refreshed, at most once every few minutes.
+func RequireAuthentication(authService *services.AuthService, sessionService *services.SessionService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			// Personal access tokens were already authenticated by ValidateToken.
+			if r.Context().Value(ApiTokenContextKey) != nil {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
 			// Get the JWT token from the "token" context value.
 			tokenInterface := r.Context().Value(TokenContextKey)
 			if tokenInterface == nil {
@@ -74,8 +102,24 @@ func RequireAuthentication(authService *services.AuthService) func(http.Handler)
 				return
 			}
 
+			session, err := sessionService.Get(user.Id, claims.SessionId)
+			if err == structures.ErrNoSession {
+				http.Error(rw, "Session was revoked or has expired", http.StatusUnauthorized)
+				return
+			} else if err != nil {
+				http.Error(rw, "Failed to get session", http.StatusInternalServerError)
+				return
+			}
+
+			err = sessionService.Touch(session, r.UserAgent(), utils.ClientIP(r), false)
+			if err != nil {
+				// Not worth failing the request over.
+				fmt.Printf("Failed to touch session: %v\n", err)
+			}
+
 			ctx := context.WithValue(r.Context(), UserContextKey, user)
 			ctx = context.WithValue(ctx, ClaimsContextKey, claims)
+			ctx = context.WithValue(ctx, SessionContextKey, session)
 
 			next.ServeHTTP(rw, r.WithContext(ctx))
 		})
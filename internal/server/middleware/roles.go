@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+)
+
+// RequireAdmin rejects requests from users who aren't admins.
+// It must run after RequireAuthentication.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(UserContextKey).(*structures.User)
+
+		if !user.IsAdmin {
+			http.Error(rw, "User is not an admin.", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// RequireMerchant rejects requests from users who aren't on the staff of a merchant.
+// It must run after RequireAuthentication.
+func RequireMerchant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value(UserContextKey).(*structures.User)
+
+		if user.MerchantId == "" {
+			http.Error(rw, "User is not a merchant.", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// RequireTwoFactor rejects requests from users whose roles require 2FA but who haven't enabled it.
+// It must run after RequireAuthentication.
+func RequireTwoFactor(twoFactorService *services.TwoFactorService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			user := r.Context().Value(UserContextKey).(*structures.User)
+
+			if !user.HasTwoFactor() {
+				required, err := twoFactorService.IsRequired(user)
+				if err != nil {
+					fmt.Printf("Failed to check 2FA requirement: %v\n", err)
+					http.Error(rw, "Failed to check 2FA requirement.", http.StatusInternalServerError)
+					return
+				}
+
+				if required {
+					http.Error(rw, "Two-factor authentication must be enabled.", http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+// RequireScope rejects requests made with a personal access token that lacks the given scope.
+// Requests made with a session token are allowed through.
+func RequireScope(scope structures.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			apiToken, ok := r.Context().Value(ApiTokenContextKey).(*structures.ApiToken)
+			if ok && !apiToken.HasScope(scope) {
+				http.Error(rw, "Token is missing the "+string(scope)+" scope.", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// RequireSession rejects requests made with a personal access token,
+// for routes that only the user themselves may use, such as managing tokens.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(ApiTokenContextKey) != nil {
+			http.Error(rw, "This route can't be used with an API token.", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+// reauthenticationWindow is how recently users without a password or 2FA must have signed in
+// to delete their account.
+const reauthenticationWindow = 10 * time.Minute
+
+type AccountHandler struct {
+	r                      *render.Render
+	authService            *services.AuthService
+	twoFactorService       *services.TwoFactorService
+	accountDeletionService *services.AccountDeletionService
+}
+
+// DeleteAccount schedules the current user's account for deletion, after confirming their
+// password and, if enabled, a 2FA code. Users who only sign in through an identity provider
+// confirm with a 2FA code, or without one by having signed in with the provider in the last
+// few minutes. It receives a DeleteAccountInput body, and returns a DeleteAccountPayload with
+// the time the account will be anonymized.
+func (ach *AccountHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.DeleteAccountInput
+	if !decodeInput(w, r, ach.r, &input) {
+		return
+	}
+
+	if user.HasPassword() {
+		err := ach.authService.VerifyPassword(user, input.Password)
+		if err != nil {
+			ach.r.JSON(w, http.StatusUnauthorized, payloads.DeleteAccountPayload{Error: "Invalid password."})
+			return
+		}
+	} else if !user.HasTwoFactor() {
+		// Sessions keep the time they were signed in at across refreshes, and API tokens have none.
+		session, _ := r.Context().Value(middleware.SessionContextKey).(*structures.Session)
+		if session == nil || time.Since(time.Unix(session.CreatedAt, 0)) > reauthenticationWindow {
+			ach.r.JSON(w, http.StatusUnauthorized, payloads.DeleteAccountPayload{
+				Error: "Sign in again with your identity provider to confirm.",
+			})
+			return
+		}
+	}
+
+	if user.HasTwoFactor() {
+		err := ach.twoFactorService.Verify(user, input.Code)
+		if err != nil {
+			ach.r.JSON(w, http.StatusUnauthorized, payloads.DeleteAccountPayload{Error: "Invalid code."})
+			return
+		}
+	}
+
+	scheduledAt, err := ach.accountDeletionService.Schedule(user)
+	if err == structures.ErrDeletionAlreadyScheduled {
+		ach.r.JSON(w, http.StatusConflict, payloads.DeleteAccountPayload{
+			Error:               "Account deletion is already scheduled.",
+			DeletionScheduledAt: user.DeletionScheduledAt,
+		})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to schedule account deletion: %v\n", err)
+		ach.r.JSON(w, http.StatusInternalServerError, payloads.DeleteAccountPayload{Error: "Failed to schedule deletion."})
+		return
+	}
+
+	ach.r.JSON(w, http.StatusOK, payloads.DeleteAccountPayload{Success: true, DeletionScheduledAt: scheduledAt})
+}
+
+// CancelDeletion keeps the current user's account, if its grace period isn't over yet.
+func (ach *AccountHandler) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	err := ach.accountDeletionService.Cancel(user)
+	if err == structures.ErrDeletionNotScheduled {
+		ach.r.JSON(w, http.StatusBadRequest, payloads.DeleteAccountPayload{Error: "Account deletion is not scheduled."})
+		return
+	} else if err == structures.ErrDeletionInProgress {
+		ach.r.JSON(w, http.StatusConflict, payloads.DeleteAccountPayload{Error: "Account deletion is already in progress."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to cancel account deletion: %v\n", err)
+		ach.r.JSON(w, http.StatusInternalServerError, payloads.DeleteAccountPayload{Error: "Failed to cancel deletion."})
+		return
+	}
+
+	ach.r.JSON(w, http.StatusOK, payloads.DeleteAccountPayload{Success: true})
+}
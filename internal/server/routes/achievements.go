@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+type AchievementsHandler struct {
+	r                  *render.Render
+	achievementService *services.AchievementService
+}
+
+// GetAchievements lists every achievement, and which ones the current user has earned.
+func (avh *AchievementsHandler) GetAchievements(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	earned := user.Badges
+	if earned == nil {
+		earned = []string{}
+	}
+
+	avh.r.JSON(w, http.StatusOK, payloads.GetAchievementsPayload{
+		Achievements: avh.achievementService.List(),
+		Earned:       earned,
+	})
+}
+
+func GetAchievementsRouter(ctx context.Context, render *render.Render, achs *services.AchievementService) chi.Router {
+	r := chi.NewRouter()
+
+	achievementsHandler := AchievementsHandler{r: render, achievementService: achs}
+
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/", achievementsHandler.GetAchievements)
+
+	return r
+}
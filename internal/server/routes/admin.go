@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+type AdminHandler struct {
+	r         *render.Render
+	dbService *services.DatabaseService
+}
+
+// GetSecuritySettings returns the platform-wide security settings.
+func (adh *AdminHandler) GetSecuritySettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := adh.dbService.GetSecuritySettings()
+	if err != nil {
+		adh.r.JSON(w, http.StatusInternalServerError, payloads.SecuritySettingsPayload{Error: "Failed to get settings."})
+		return
+	}
+
+	adh.r.JSON(w, http.StatusOK, payloads.SecuritySettingsPayload{Success: true, Settings: settings})
+}
+
+// UpdateSecuritySettings replaces the platform-wide security settings,
+// such as the roles that must have 2FA enabled.
+func (adh *AdminHandler) UpdateSecuritySettings(w http.ResponseWriter, r *http.Request) {
+	var input inputs.UpdateSecuritySettingsInput
+	if !decodeInput(w, r, adh.r, &input) {
+		return
+	}
+
+	settings := structures.SecuritySettings{TwoFactorRequiredRoles: input.TwoFactorRequiredRoles}
+
+	err := adh.dbService.UpdateSecuritySettings(&settings)
+	if err != nil {
+		fmt.Printf("Failed to update security settings: %v\n", err)
+		adh.r.JSON(w, http.StatusInternalServerError, payloads.SecuritySettingsPayload{Error: "Failed to update settings."})
+		return
+	}
+
+	adh.r.JSON(w, http.StatusOK, payloads.SecuritySettingsPayload{Success: true, Settings: &settings})
+}
+
+func GetAdminRouter(ctx context.Context, render *render.Render, db *services.DatabaseService,
+	tfs *services.TwoFactorService, cs *services.CampaignService, mcs *services.MerchantService,
+	tms *services.TeamService, whs *services.WebhookService, scs *services.SchedulerService) chi.Router {
+	r := chi.NewRouter()
+
+	r.Use(middleware.RequireSession)
+	r.Use(middleware.RequireAdmin)
+	r.Use(middleware.RequireTwoFactor(tfs))
+
+	adminHandler := AdminHandler{r: render, dbService: db}
+
+	r.Get("/security", adminHandler.GetSecuritySettings)
+	r.Put("/security", adminHandler.UpdateSecuritySettings)
+
+	r.Mount("/campaigns", GetCampaignsRouter(ctx, render, cs))
+	r.Mount("/merchants", GetMerchantsRouter(ctx, render, db, mcs))
+	r.Mount("/challenges", GetChallengesRouter(ctx, render, tms))
+	r.Mount("/webhooks", GetWebhooksRouter(ctx, render, whs))
+	r.Mount("/jobs", GetJobsRouter(ctx, render, scs))
+
+	return r
+}
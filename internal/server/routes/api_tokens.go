@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+type ApiTokensHandler struct {
+	r               *render.Render
+	apiTokenService *services.ApiTokenService
+}
+
+// GetApiTokens lists the current user's personal access tokens, without the tokens themselves.
+func (ath *ApiTokensHandler) GetApiTokens(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	apiTokens, err := ath.apiTokenService.ListByUser(user.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ath.r.JSON(w, http.StatusOK, payloads.GetApiTokensPayload{ApiTokens: apiTokens})
+}
+
+// CreateApiToken issues a new personal access token.
+// It receives a CreateApiTokenInput body, and returns a CreateApiTokenPayload
+// holding the token, which is never shown again.
+func (ath *ApiTokensHandler) CreateApiToken(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.CreateApiTokenInput
+	if !decodeInput(w, r, ath.r, &input) {
+		return
+	}
+
+	expiresIn := time.Duration(input.ExpiresInDays) * 24 * time.Hour
+
+	token, apiToken, err := ath.apiTokenService.Create(user.Id, input.Name, input.Scopes, expiresIn)
+	if err != nil {
+		fmt.Printf("Failed to create api token: %v\n", err)
+		ath.r.JSON(w, http.StatusInternalServerError, payloads.CreateApiTokenPayload{Error: "Failed to create token."})
+		return
+	}
+
+	ath.r.JSON(w, http.StatusOK, payloads.CreateApiTokenPayload{Success: true, Token: token, ApiToken: apiToken})
+}
+
+// RevokeApiToken deletes one of the current user's personal access tokens.
+func (ath *ApiTokensHandler) RevokeApiToken(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	err := ath.apiTokenService.Revoke(user.Id, chi.URLParam(r, "id"))
+	if err == structures.ErrNoApiToken {
+		http.Error(w, "Token not found.", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetApiTokensRouter(ctx context.Context, render *render.Render, ats *services.ApiTokenService) chi.Router {
+	r := chi.NewRouter()
+
+	apiTokensHandler := ApiTokensHandler{r: render, apiTokenService: ats}
+
+	r.Get("/", apiTokensHandler.GetApiTokens)
+	r.Post("/", apiTokensHandler.CreateApiToken)
+	r.Delete("/{id}", apiTokensHandler.RevokeApiToken)
+
+	return r
+}
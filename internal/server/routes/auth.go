@@ -2,90 +2,401 @@ package routes
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/unrolled/render"
 
 	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
 	"unreal.sh/echo/internal/structures/inputs"
 	"unreal.sh/echo/internal/structures/payloads"
+	"unreal.sh/echo/internal/utils"
 )
 
+// oidcStateCookie holds the hash of the state of the browser's OIDC login in progress.
+const oidcStateCookie = "oidc_state"
+
 type AuthHandler struct {
-	r           *render.Render
-	authService *services.AuthService
+	r                *render.Render
+	authService      *services.AuthService
+	twoFactorService *services.TwoFactorService
+	throttleService  *services.LoginThrottleService
+	oidcService      *services.OidcService
+	sessionService   *services.SessionService
+	referralService  *services.ReferralService
 }
 
 // Authenticate authenticates a user with the given username and password.
 // It receives an AuthenticationInput body, and returns an AuthenticationPayload.
 // It returns a profile on success, and an error on failure.
+// Users with 2FA enabled get an MFA token instead, to be exchanged at POST /auth/2fa.
+// Repeated failures for the same username or IP address are throttled with 429 Too Many Requests.
 func (ah *AuthHandler) Authenticate(w http.ResponseWriter, r *http.Request) {
 	var input inputs.AuthenticationInput
+	if !decodeInput(w, r, ah.r, &input) {
+		return
+	}
 
-	err := json.NewDecoder(r.Body).Decode(&input)
-	if err != nil {
-		fmt.Printf("Failed to decode input: %v\n", err)
-		ah.r.JSON(w, http.StatusBadRequest, payloads.AuthenticationPayload{Error: "Invalid input."})
+	ip := utils.ClientIP(r)
+	if ah.isThrottled(w, r, input.Username, ip) {
 		return
 	}
 
 	user, err := ah.authService.Authenticate(input.Username, input.Password)
 	if err != nil {
 		fmt.Printf("Failed to authenticate: %v\n", err)
+		ah.recordFailure(r, input.Username, ip)
 		ah.r.JSON(w, http.StatusUnauthorized, payloads.AuthenticationPayload{Error: "Invalid credentials."})
 		return
 	}
 
-	token, err := ah.authService.GenerateToken(user)
+	if user.HasTwoFactor() {
+		ah.sendMfaToken(w, user)
+		return
+	}
+
+	ah.recordSuccess(r, user.Username)
+	ah.sendToken(w, r, user)
+}
+
+// Refresh exchanges a refresh token for a new token pair in the same session.
+// It receives a RefreshTokenInput body, and returns an AuthenticationPayload.
+func (ah *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var input inputs.RefreshTokenInput
+	if !decodeInput(w, r, ah.r, &input) {
+		return
+	}
+
+	user, claims, err := ah.authService.ParseRefreshToken(input.RefreshToken)
 	if err != nil {
-		fmt.Printf("Failed to generate token: %v\n", err)
-		ah.r.JSON(w, http.StatusInternalServerError, payloads.AuthenticationPayload{Error: "Failed to generate token."})
+		ah.r.JSON(w, http.StatusUnauthorized, payloads.AuthenticationPayload{Error: "Invalid refresh token."})
+		return
+	}
+
+	session, err := ah.sessionService.Get(user.Id, claims.SessionId)
+	if err == structures.ErrNoSession {
+		ah.r.JSON(w, http.StatusUnauthorized, payloads.AuthenticationPayload{Error: "Session was revoked or has expired."})
+		return
+	} else if err != nil {
+		ah.r.JSON(w, http.StatusInternalServerError, payloads.AuthenticationPayload{Error: "Failed to get session."})
+		return
+	}
+
+	err = ah.sessionService.Touch(session, r.UserAgent(), utils.ClientIP(r), true)
+	if err != nil {
+		ah.r.JSON(w, http.StatusInternalServerError, payloads.AuthenticationPayload{Error: "Failed to refresh session."})
 		return
 	}
 
-	payload := payloads.AuthenticationPayload{Token: token, User: user.ToProfile()}
+	ah.sendTokenPair(w, user, session.Id)
+}
 
-	ah.r.JSON(w, http.StatusOK, payload)
+// StartOidc redirects to the given OpenID Connect provider to sign in.
+func (ah *AuthHandler) StartOidc(w http.ResponseWriter, r *http.Request) {
+	authorizationUrl, stateHash, err := ah.oidcService.Start(r.Context(), chi.URLParam(r, "provider"), nil)
+	if err == structures.ErrUnknownOidcProvider {
+		ah.r.JSON(w, http.StatusNotFound, payloads.AuthenticationPayload{Error: "Unknown identity provider."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to start OIDC login: %v\n", err)
+		ah.r.JSON(w, http.StatusBadGateway, payloads.AuthenticationPayload{Error: "Failed to reach identity provider."})
+		return
+	}
+
+	setOidcStateCookie(w, stateHash)
+	http.Redirect(w, r, authorizationUrl, http.StatusFound)
+}
+
+// LinkOidc starts linking an identity from the given OpenID Connect provider to the user of the
+// request's bearer token. Browsers can't send the token on a navigation, so it returns an
+// OidcLinkPayload with the URL to send the browser to, which then comes back to OidcCallback.
+// The link is bound to the session of the token, and fails if it is revoked in the meantime.
+func (ah *AuthHandler) LinkOidc(w http.ResponseWriter, r *http.Request) {
+	session, err := ah.bearerSession(r)
+	if err != nil || session == nil {
+		ah.r.JSON(w, http.StatusUnauthorized, payloads.OidcLinkPayload{Error: "Invalid token."})
+		return
+	}
+
+	authorizationUrl, stateHash, err := ah.oidcService.Start(r.Context(), chi.URLParam(r, "provider"), session)
+	if err == structures.ErrUnknownOidcProvider {
+		ah.r.JSON(w, http.StatusNotFound, payloads.OidcLinkPayload{Error: "Unknown identity provider."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to start OIDC link: %v\n", err)
+		ah.r.JSON(w, http.StatusBadGateway, payloads.OidcLinkPayload{Error: "Failed to reach identity provider."})
+		return
+	}
+
+	setOidcStateCookie(w, stateHash)
+	ah.r.JSON(w, http.StatusOK, payloads.OidcLinkPayload{AuthorizationUrl: authorizationUrl})
+}
+
+// setOidcStateCookie binds the OIDC login in progress to the browser, for OidcCallback to check.
+func setOidcStateCookie(w http.ResponseWriter, stateHash string) {
+	// Lax, since the provider sends the browser back with a cross-site redirect.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateHash,
+		Path:     "/auth/oidc",
+		MaxAge:   int(services.OidcStateLifetime.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// OidcCallback completes a login started with StartOidc or a link started with LinkOidc,
+// in the same browser. It returns an AuthenticationPayload, exactly like a password login.
+func (ah *AuthHandler) OidcCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	stateHash := ""
+	if cookie, err := r.Cookie(oidcStateCookie); err == nil {
+		stateHash = cookie.Value
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", MaxAge: -1})
+
+	if providerError := query.Get("error"); providerError != "" {
+		fmt.Printf("OIDC provider returned an error: %v\n", providerError)
+		ah.r.JSON(w, http.StatusUnauthorized, payloads.AuthenticationPayload{Error: "Sign in was cancelled or denied."})
+		return
+	}
+
+	user, err := ah.oidcService.Finish(r.Context(), chi.URLParam(r, "provider"), query.Get("state"), query.Get("code"),
+		stateHash)
+	switch err {
+	case nil:
+	case structures.ErrUnknownOidcProvider:
+		ah.r.JSON(w, http.StatusNotFound, payloads.AuthenticationPayload{Error: "Unknown identity provider."})
+		return
+	case structures.ErrInvalidOidcState, structures.ErrInvalidToken:
+		ah.r.JSON(w, http.StatusUnauthorized, payloads.AuthenticationPayload{Error: "Invalid or expired sign in."})
+		return
+	case structures.ErrIdentityAlreadyLinked:
+		ah.r.JSON(w, http.StatusConflict, payloads.AuthenticationPayload{Error: "This identity is linked to another account."})
+		return
+	default:
+		fmt.Printf("Failed to finish OIDC login: %v\n", err)
+		ah.r.JSON(w, http.StatusBadGateway, payloads.AuthenticationPayload{Error: "Failed to sign in with identity provider."})
+		return
+	}
+
+	if user.HasTwoFactor() {
+		ah.sendMfaToken(w, user)
+		return
+	}
+
+	ah.sendToken(w, r, user)
+}
+
+// bearerSession returns the session of the request's bearer token, or nil if it has none.
+// Most /auth routes don't require authentication, so they check the token themselves.
+func (ah *AuthHandler) bearerSession(r *http.Request) (*structures.Session, error) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return nil, nil
+	}
+
+	user, claims, err := ah.authService.ParseAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return ah.sessionService.Get(user.Id, claims.SessionId)
 }
 
-// CreateAccount creates a new account with the given name, username, and password.
+// VerifyTwoFactor completes the login of a user with 2FA enabled.
+// It receives a TwoFactorLoginInput body, and returns an AuthenticationPayload.
+func (ah *AuthHandler) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var input inputs.TwoFactorLoginInput
+	if !decodeInput(w, r, ah.r, &input) {
+		return
+	}
+
+	user, err := ah.authService.ParseMfaToken(input.MfaToken)
+	if err != nil {
+		fmt.Printf("Failed to parse MFA token: %v\n", err)
+		ah.r.JSON(w, http.StatusUnauthorized, payloads.AuthenticationPayload{Error: "Invalid or expired MFA token."})
+		return
+	}
+
+	ip := utils.ClientIP(r)
+	if ah.isThrottled(w, r, user.Username, ip) {
+		return
+	}
+
+	err = ah.twoFactorService.Verify(user, input.Code)
+	if err == structures.ErrInvalidTwoFactorCode || err == structures.ErrTwoFactorNotEnrolled {
+		ah.recordFailure(r, user.Username, ip)
+		ah.r.JSON(w, http.StatusUnauthorized, payloads.AuthenticationPayload{Error: "Invalid code."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to verify 2FA code: %v\n", err)
+		ah.r.JSON(w, http.StatusInternalServerError, payloads.AuthenticationPayload{Error: "Failed to verify code."})
+		return
+	}
+
+	ah.recordSuccess(r, user.Username)
+	ah.sendToken(w, r, user)
+}
+
+// isThrottled responds with 429 Too Many Requests and returns true if logins for the username
+// or from the IP address are currently backed off or locked out.
+func (ah *AuthHandler) isThrottled(w http.ResponseWriter, r *http.Request, username string, ip string) bool {
+	retryAfter, err := ah.throttleService.RetryAfter(r.Context(), username, ip)
+	if err != nil {
+		// Don't lock everyone out if the store is down.
+		fmt.Printf("Failed to check login throttle: %v\n", err)
+		return false
+	}
+
+	if retryAfter <= 0 {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	ah.r.JSON(w, http.StatusTooManyRequests, payloads.AuthenticationPayload{Error: "Too many failed attempts. Try again later."})
+
+	return true
+}
+
+func (ah *AuthHandler) recordFailure(r *http.Request, username string, ip string) {
+	err := ah.throttleService.RecordFailure(r.Context(), username, ip)
+	if err != nil {
+		fmt.Printf("Failed to record login failure: %v\n", err)
+	}
+}
+
+func (ah *AuthHandler) recordSuccess(r *http.Request, username string) {
+	err := ah.throttleService.RecordSuccess(r.Context(), username)
+	if err != nil {
+		fmt.Printf("Failed to reset login failures: %v\n", err)
+	}
+}
+
+// CreateAccount creates a new account with the given name, username, and password,
+// optionally referred by another user's referral code.
 // It receives an AccountInput body, and returns an AuthenticationPayload.
 func (ah *AuthHandler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 	var input inputs.CreateAccountInput
+	if !decodeInput(w, r, ah.r, &input) {
+		return
+	}
+
+	var referrer *structures.User
+	if input.ReferralCode != "" {
+		var err error
+		referrer, err = ah.referralService.FindReferrer(r.Context(), input.ReferralCode)
+		if err == structures.ErrInvalidReferralCode {
+			ah.r.JSON(w, http.StatusUnprocessableEntity, payloads.AuthenticationPayload{Error: "Invalid referral code."})
+			return
+		} else if err != nil {
+			fmt.Printf("Failed to find referrer: %v\n", err)
+			ah.r.JSON(w, http.StatusInternalServerError, payloads.AuthenticationPayload{Error: "Failed to create account."})
+			return
+		}
+	}
+
+	user, err := ah.authService.CreateAccount(input.Name, input.Username, input.Password)
+	if err == structures.ErrUserAlreadyExists {
+		ah.r.JSON(w, http.StatusConflict, payloads.AuthenticationPayload{Error: "Username is already taken."})
+		return
+	} else if err == structures.ErrInvalidPasswordLength {
+		ah.r.JSON(w, http.StatusBadRequest, payloads.AuthenticationPayload{Error: "Invalid password length."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to create account: %v\n", err)
+		ah.r.JSON(w, http.StatusInternalServerError, payloads.AuthenticationPayload{Error: "Failed to create account."})
+		return
+	}
 
-	err := json.NewDecoder(r.Body).Decode(&input)
+	// The account exists at this point, so referral failures are only logged.
+	_, err = ah.referralService.EnsureCode(r.Context(), &user)
 	if err != nil {
-		ah.r.JSON(w, http.StatusBadRequest, payloads.AuthenticationPayload{Error: "Invalid input."})
+		fmt.Printf("Failed to generate referral code for user %v: %v\n", user.Id, err)
+	}
+
+	if referrer != nil {
+		_, err = ah.referralService.Record(r.Context(), referrer, &user, utils.ClientIP(r), r.UserAgent(),
+			r.Header.Get("X-Device-Name"))
+		if err != nil {
+			fmt.Printf("Failed to record referral of user %v: %v\n", user.Id, err)
+		}
+	}
+
+	ah.sendToken(w, r, &user)
+}
+
+func (ah *AuthHandler) sendMfaToken(w http.ResponseWriter, user *structures.User) {
+	mfaToken, err := ah.authService.GenerateMfaToken(user)
+	if err != nil {
+		fmt.Printf("Failed to generate MFA token: %v\n", err)
+		ah.r.JSON(w, http.StatusInternalServerError, payloads.AuthenticationPayload{Error: "Failed to generate token."})
 		return
 	}
 
-	user, err := ah.authService.CreateAccount(input.Name, input.Username, input.Password)
+	ah.r.JSON(w, http.StatusOK, payloads.AuthenticationPayload{MfaRequired: true, MfaToken: mfaToken})
+}
+
+// sendToken starts a new session for the user and sends its token pair.
+// The session is named after the X-Device-Name header, if the client sets it.
+func (ah *AuthHandler) sendToken(w http.ResponseWriter, r *http.Request, user *structures.User) {
+	deviceName := r.Header.Get("X-Device-Name")
+	if len(deviceName) > 64 {
+		deviceName = deviceName[:64]
+	}
+
+	session, err := ah.sessionService.Create(user.Id, deviceName, r.UserAgent(), utils.ClientIP(r))
 	if err != nil {
-		ah.r.JSON(w, http.StatusInternalServerError, payloads.AuthenticationPayload{Error: "Failed to create account."})
+		ah.r.JSON(w, http.StatusInternalServerError, payloads.AuthenticationPayload{Error: "Failed to create session."})
 		return
 	}
 
-	token, err := ah.authService.GenerateToken(&user)
+	ah.sendTokenPair(w, user, session.Id)
+}
+
+func (ah *AuthHandler) sendTokenPair(w http.ResponseWriter, user *structures.User, sessionId string) {
+	token, refreshToken, err := ah.authService.GenerateTokenPair(user, sessionId)
 	if err != nil {
+		fmt.Printf("Failed to generate token: %v\n", err)
 		ah.r.JSON(w, http.StatusInternalServerError, payloads.AuthenticationPayload{Error: "Failed to generate token."})
 		return
 	}
 
-	payload := payloads.AuthenticationPayload{Token: token, User: user.ToProfile()}
+	payload := payloads.AuthenticationPayload{Token: token, RefreshToken: refreshToken, User: user.ToProfile()}
 
 	ah.r.JSON(w, http.StatusOK, payload)
 }
 
-func GetAuthRouter(ctx context.Context, render *render.Render, as *services.AuthService) chi.Router {
+func GetAuthRouter(ctx context.Context, render *render.Render, as *services.AuthService,
+	tfs *services.TwoFactorService, lts *services.LoginThrottleService, ois *services.OidcService,
+	ss *services.SessionService, rs *services.ReferralService) chi.Router {
 	r := chi.NewRouter()
 
-	authHandler := AuthHandler{r: render, authService: as}
+	authHandler := AuthHandler{
+		r:                render,
+		authService:      as,
+		twoFactorService: tfs,
+		throttleService:  lts,
+		oidcService:      ois,
+		sessionService:   ss,
+		referralService:  rs,
+	}
 
 	r.Post("/", authHandler.Authenticate)
 	r.Put("/", authHandler.CreateAccount)
+	r.Post("/2fa", authHandler.VerifyTwoFactor)
+	r.Post("/refresh", authHandler.Refresh)
+
+	r.Get("/oidc/{provider}/start", authHandler.StartOidc)
+	r.Post("/oidc/{provider}/link", authHandler.LinkOidc)
+	r.Get("/oidc/{provider}/callback", authHandler.OidcCallback)
 
 	return r
 }
@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+type CampaignsHandler struct {
+	r               *render.Render
+	campaignService *services.CampaignService
+}
+
+// GetCampaigns lists every campaign, past, running and upcoming.
+func (ch *CampaignsHandler) GetCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := ch.campaignService.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ch.r.JSON(w, http.StatusOK, payloads.GetCampaignsPayload{Campaigns: campaigns})
+}
+
+func (ch *CampaignsHandler) GetCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, err := ch.campaignService.Get(r.Context(), chi.URLParam(r, "id"))
+	if err == structures.ErrNoCampaign {
+		ch.r.JSON(w, http.StatusNotFound, payloads.CampaignPayload{Error: "Campaign not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ch.r.JSON(w, http.StatusOK, payloads.CampaignPayload{Campaign: campaign})
+}
+
+// CreateCampaign receives a CampaignInput and returns the created campaign in a CampaignPayload.
+func (ch *CampaignsHandler) CreateCampaign(w http.ResponseWriter, r *http.Request) {
+	var input inputs.CampaignInput
+	if !decodeInput(w, r, ch.r, &input) {
+		return
+	}
+
+	campaign := campaignFromInput(&input)
+
+	err := ch.campaignService.Create(r.Context(), campaign)
+	if err == structures.ErrInvalidCampaign {
+		ch.r.JSON(w, http.StatusUnprocessableEntity, payloads.CampaignPayload{
+			Error: "Campaigns must end after they start, and grant a multiplier above 1 or a flat bonus.",
+		})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to create campaign: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ch.r.JSON(w, http.StatusCreated, payloads.CampaignPayload{Campaign: campaign})
+}
+
+// UpdateCampaign receives a CampaignInput and replaces the campaign with it.
+func (ch *CampaignsHandler) UpdateCampaign(w http.ResponseWriter, r *http.Request) {
+	var input inputs.CampaignInput
+	if !decodeInput(w, r, ch.r, &input) {
+		return
+	}
+
+	campaign := campaignFromInput(&input)
+
+	err := ch.campaignService.Update(r.Context(), chi.URLParam(r, "id"), campaign)
+	if err == structures.ErrNoCampaign {
+		ch.r.JSON(w, http.StatusNotFound, payloads.CampaignPayload{Error: "Campaign not found."})
+		return
+	} else if err == structures.ErrInvalidCampaign {
+		ch.r.JSON(w, http.StatusUnprocessableEntity, payloads.CampaignPayload{
+			Error: "Campaigns must end after they start, and grant a multiplier above 1 or a flat bonus.",
+		})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to update campaign: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ch.r.JSON(w, http.StatusOK, payloads.CampaignPayload{Campaign: campaign})
+}
+
+func (ch *CampaignsHandler) DeleteCampaign(w http.ResponseWriter, r *http.Request) {
+	err := ch.campaignService.Delete(r.Context(), chi.URLParam(r, "id"))
+	if err == structures.ErrNoCampaign {
+		ch.r.JSON(w, http.StatusNotFound, payloads.CampaignPayload{Error: "Campaign not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func campaignFromInput(input *inputs.CampaignInput) *structures.Campaign {
+	return &structures.Campaign{
+		Name:         input.Name,
+		Description:  input.Description,
+		Multiplier:   input.Multiplier,
+		FlatBonus:    input.FlatBonus,
+		StartsAt:     input.StartsAt,
+		EndsAt:       input.EndsAt,
+		StationId:    input.StationId,
+		Region:       input.Region,
+		DisposalType: input.DisposalType,
+		CapPerUser:   input.CapPerUser,
+	}
+}
+
+func GetCampaignsRouter(ctx context.Context, render *render.Render, cs *services.CampaignService) chi.Router {
+	r := chi.NewRouter()
+
+	campaignsHandler := CampaignsHandler{r: render, campaignService: cs}
+
+	r.Get("/", campaignsHandler.GetCampaigns)
+	r.Post("/", campaignsHandler.CreateCampaign)
+	r.Get("/{id}", campaignsHandler.GetCampaign)
+	r.Put("/{id}", campaignsHandler.UpdateCampaign)
+	r.Delete("/{id}", campaignsHandler.DeleteCampaign)
+
+	return r
+}
@@ -0,0 +1,134 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+type ChallengesHandler struct {
+	r           *render.Render
+	teamService *services.TeamService
+}
+
+// GetChallenges lists every challenge, past, running and upcoming.
+func (chh *ChallengesHandler) GetChallenges(w http.ResponseWriter, r *http.Request) {
+	challenges, err := chh.teamService.ListChallenges(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	chh.r.JSON(w, http.StatusOK, payloads.GetChallengesPayload{Challenges: challenges})
+}
+
+func (chh *ChallengesHandler) GetChallenge(w http.ResponseWriter, r *http.Request) {
+	challenge, err := chh.teamService.GetChallenge(r.Context(), chi.URLParam(r, "id"))
+	if err == structures.ErrNoChallenge {
+		chh.r.JSON(w, http.StatusNotFound, payloads.ChallengePayload{Error: "Challenge not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	chh.r.JSON(w, http.StatusOK, payloads.ChallengePayload{Challenge: challenge})
+}
+
+// CreateChallenge receives a ChallengeInput and returns the created challenge in a ChallengePayload.
+func (chh *ChallengesHandler) CreateChallenge(w http.ResponseWriter, r *http.Request) {
+	var input inputs.ChallengeInput
+	if !decodeInput(w, r, chh.r, &input) {
+		return
+	}
+
+	challenge := challengeFromInput(&input)
+
+	err := chh.teamService.CreateChallenge(r.Context(), challenge)
+	if err == structures.ErrInvalidChallenge {
+		chh.r.JSON(w, http.StatusUnprocessableEntity, payloads.ChallengePayload{
+			Error: "Challenges must end after they start.",
+		})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to create challenge: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	chh.r.JSON(w, http.StatusCreated, payloads.ChallengePayload{Challenge: challenge})
+}
+
+// UpdateChallenge receives a ChallengeInput and replaces the challenge with it.
+func (chh *ChallengesHandler) UpdateChallenge(w http.ResponseWriter, r *http.Request) {
+	var input inputs.ChallengeInput
+	if !decodeInput(w, r, chh.r, &input) {
+		return
+	}
+
+	challenge := challengeFromInput(&input)
+
+	err := chh.teamService.UpdateChallenge(r.Context(), chi.URLParam(r, "id"), challenge)
+	if err == structures.ErrNoChallenge {
+		chh.r.JSON(w, http.StatusNotFound, payloads.ChallengePayload{Error: "Challenge not found."})
+		return
+	} else if err == structures.ErrInvalidChallenge {
+		chh.r.JSON(w, http.StatusUnprocessableEntity, payloads.ChallengePayload{
+			Error: "Challenges must end after they start.",
+		})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to update challenge: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	chh.r.JSON(w, http.StatusOK, payloads.ChallengePayload{Challenge: challenge})
+}
+
+func (chh *ChallengesHandler) DeleteChallenge(w http.ResponseWriter, r *http.Request) {
+	err := chh.teamService.DeleteChallenge(r.Context(), chi.URLParam(r, "id"))
+	if err == structures.ErrNoChallenge {
+		chh.r.JSON(w, http.StatusNotFound, payloads.ChallengePayload{Error: "Challenge not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func challengeFromInput(input *inputs.ChallengeInput) *structures.Challenge {
+	return &structures.Challenge{
+		Name:         input.Name,
+		Description:  input.Description,
+		Metric:       input.Metric,
+		Goal:         input.Goal,
+		StartsAt:     input.StartsAt,
+		EndsAt:       input.EndsAt,
+		DisposalType: input.DisposalType,
+	}
+}
+
+func GetChallengesRouter(ctx context.Context, render *render.Render, tms *services.TeamService) chi.Router {
+	r := chi.NewRouter()
+
+	challengesHandler := ChallengesHandler{r: render, teamService: tms}
+
+	r.Get("/", challengesHandler.GetChallenges)
+	r.Post("/", challengesHandler.CreateChallenge)
+	r.Get("/{id}", challengesHandler.GetChallenge)
+	r.Put("/{id}", challengesHandler.UpdateChallenge)
+	r.Delete("/{id}", challengesHandler.DeleteChallenge)
+
+	return r
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+type DataExportHandler struct {
+	r                 *render.Render
+	dataExportService *services.DataExportService
+}
+
+// GetExport returns an archive of the current user's data, starting one if needed.
+// It responds with 200 and a download link once the export is ready, and with 202
+// while it's still being generated, in which case the client should ask again later.
+func (deh *DataExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	export, err := deh.dataExportService.Request(r.Context(), user)
+	if err != nil {
+		fmt.Printf("Failed to export data of user %v: %v\n", user.Id, err)
+		deh.r.JSON(w, http.StatusInternalServerError, payloads.DataExportPayload{Error: "Failed to export data."})
+		return
+	}
+
+	if export.Status == structures.EXPORT_PENDING {
+		w.Header().Set("Retry-After", "10")
+		deh.r.JSON(w, http.StatusAccepted, payloads.DataExportPayload{Export: export})
+		return
+	}
+
+	deh.r.JSON(w, http.StatusOK, payloads.DataExportPayload{Export: export})
+}
@@ -0,0 +1,265 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+const (
+	defaultFeedLimit = 20
+	maxFeedLimit     = 100
+)
+
+type FriendsHandler struct {
+	r              *render.Render
+	dbService      *services.DatabaseService
+	friendService  *services.FriendService
+	profileService *services.ProfileService
+	feedService    *services.FeedService
+}
+
+// GetFollowing returns the users the current user follows, latest first.
+// Users the current user isn't allowed to see are listed without their name.
+func (fh *FriendsHandler) GetFollowing(w http.ResponseWriter, r *http.Request) {
+	fh.listFollows(w, r, true)
+}
+
+// GetFollowers returns the users following the current user, latest first.
+// Users the current user isn't allowed to see are listed without their name.
+func (fh *FriendsHandler) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	fh.listFollows(w, r, false)
+}
+
+func (fh *FriendsHandler) listFollows(w http.ResponseWriter, r *http.Request, following bool) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	followed, err := fh.friendService.Following(r.Context(), user.Id)
+	if err != nil {
+		fmt.Printf("Failed to get users followed by user %v: %v\n", user.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	followers, err := fh.friendService.Followers(r.Context(), user.Id)
+	if err != nil {
+		fmt.Printf("Failed to get followers of user %v: %v\n", user.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	followedIds := make(map[string]bool, len(followed))
+	for _, follow := range followed {
+		followedIds[follow.FolloweeId] = true
+	}
+
+	followerIds := make(map[string]bool, len(followers))
+	for _, follow := range followers {
+		followerIds[follow.FollowerId] = true
+	}
+
+	follows, ids := followers, make([]string, len(followers))
+	for i, follow := range followers {
+		ids[i] = follow.FollowerId
+	}
+	if following {
+		follows, ids = followed, make([]string, len(followed))
+		for i, follow := range followed {
+			ids[i] = follow.FolloweeId
+		}
+	}
+
+	users, err := fh.dbService.GetUsersByIds(ids)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entries := []structures.FollowEntry{}
+	for i, follow := range follows {
+		other, found := users[ids[i]]
+		if !found {
+			continue
+		}
+
+		mutual := followedIds[other.Id] && followerIds[other.Id]
+		entry := structures.FollowEntry{Mutual: mutual, Since: follow.CreatedAt}
+
+		if fh.profileService.CanViewFriend(user, other, mutual) {
+			entry.Name = other.Name
+			entry.Username = other.Username
+		} else {
+			entry.Hidden = true
+		}
+
+		entries = append(entries, entry)
+	}
+
+	fh.r.JSON(w, http.StatusOK, payloads.GetFollowsPayload{Users: entries})
+}
+
+// Follow receives a FollowUserInput and makes the current user follow that user.
+// Users who blocked the current user, or were blocked by them, are reported as not found.
+func (fh *FriendsHandler) Follow(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.FollowUserInput
+	if !decodeInput(w, r, fh.r, &input) {
+		return
+	}
+
+	target, err := fh.dbService.GetUserByUsername(input.Username)
+	if err == nil {
+		err = fh.friendService.Follow(r.Context(), user, target)
+	}
+
+	if err == structures.ErrNoUser {
+		fh.r.JSON(w, http.StatusNotFound, payloads.FollowPayload{Error: "User not found."})
+		return
+	} else if err == structures.ErrCannotFollowSelf {
+		fh.r.JSON(w, http.StatusBadRequest, payloads.FollowPayload{Error: "You can't follow yourself."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to follow user %v: %v\n", input.Username, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fh.r.JSON(w, http.StatusOK, payloads.FollowPayload{Success: true})
+}
+
+// Unfollow makes the current user stop following the user with the given username.
+func (fh *FriendsHandler) Unfollow(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	target, err := fh.dbService.GetUserByUsername(chi.URLParam(r, "username"))
+	if err == structures.ErrNoUser {
+		fh.r.JSON(w, http.StatusNotFound, payloads.FollowPayload{Error: "User not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = fh.friendService.Unfollow(r.Context(), user.Id, target.Id)
+	if err != nil {
+		fmt.Printf("Failed to unfollow user %v: %v\n", target.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBlocked returns the usernames of the users the current user blocked.
+func (fh *FriendsHandler) GetBlocked(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	users, err := fh.dbService.GetUsersByIds(user.Blocked)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usernames := []string{}
+	for _, id := range user.Blocked {
+		if blocked, found := users[id]; found && !blocked.IsDeleted {
+			usernames = append(usernames, blocked.Username)
+		}
+	}
+
+	fh.r.JSON(w, http.StatusOK, payloads.GetBlockedPayload{Usernames: usernames})
+}
+
+// Block receives a BlockUserInput and blocks that user. They stop following the current
+// user and the other way around, and can no longer see them anywhere.
+func (fh *FriendsHandler) Block(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.BlockUserInput
+	if !decodeInput(w, r, fh.r, &input) {
+		return
+	}
+
+	target, err := fh.dbService.GetUserByUsername(input.Username)
+	if err == nil {
+		err = fh.friendService.Block(r.Context(), user, target)
+	}
+
+	if err == structures.ErrNoUser {
+		fh.r.JSON(w, http.StatusNotFound, payloads.FollowPayload{Error: "User not found."})
+		return
+	} else if err == structures.ErrCannotFollowSelf {
+		fh.r.JSON(w, http.StatusBadRequest, payloads.FollowPayload{Error: "You can't block yourself."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to block user %v: %v\n", input.Username, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fh.r.JSON(w, http.StatusOK, payloads.FollowPayload{Success: true})
+}
+
+// Unblock unblocks the user with the given username.
+func (fh *FriendsHandler) Unblock(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	target, err := fh.dbService.GetUserByUsername(chi.URLParam(r, "username"))
+	if err == structures.ErrNoUser {
+		fh.r.JSON(w, http.StatusNotFound, payloads.FollowPayload{Error: "User not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = fh.friendService.Unblock(r.Context(), user, target.Id)
+	if err != nil {
+		fmt.Printf("Failed to unblock user %v: %v\n", target.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFeed returns the latest claims, badges and streak milestones of the users the current
+// user follows and is allowed to see. Pass the `next` cursor of a page as `before` to get the
+// following one, and `limit` sets how many events are returned.
+func (fh *FriendsHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+	query := r.URL.Query()
+
+	limit := defaultFeedLimit
+	if query.Has("limit") {
+		l, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || l < 1 || l > maxFeedLimit {
+			http.Error(w, fmt.Sprintf("Limit must be between 1 and %d.", maxFeedLimit), http.StatusBadRequest)
+			return
+		}
+
+		limit = l
+	}
+
+	events, next, err := fh.feedService.Feed(r.Context(), user, query.Get("before"), limit)
+	if err == structures.ErrInvalidDatabaseId {
+		http.Error(w, "Invalid cursor.", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to get feed of user %v: %v\n", user.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fh.r.JSON(w, http.StatusOK, payloads.GetFeedPayload{Events: events, Next: next})
+}
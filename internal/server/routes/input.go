@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/structures/payloads"
+	"unreal.sh/echo/internal/validation"
+)
+
+// decodeInput decodes the JSON request body into input and validates it against
+// the rules declared on its struct tags.
+// On failure it writes a ValidationErrorPayload and returns false, in which case
+// the handler should return immediately.
+func decodeInput(w http.ResponseWriter, r *http.Request, rnd *render.Render, input any) bool {
+	err := json.NewDecoder(r.Body).Decode(input)
+	if err != nil {
+		fmt.Printf("Failed to decode input: %v\n", err)
+		rnd.JSON(w, http.StatusBadRequest, payloads.ValidationErrorPayload{Error: "Invalid input."})
+		return false
+	}
+
+	err = validation.Validate(input)
+
+	var fieldErrors validation.Errors
+	if errors.As(err, &fieldErrors) {
+		rnd.JSON(w, http.StatusUnprocessableEntity, payloads.ValidationErrorPayload{
+			Error:  "Validation failed.",
+			Fields: fieldErrors,
+		})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+const (
+	defaultJobRunLimit = 20
+	maxJobRunLimit     = 200
+)
+
+type JobsHandler struct {
+	r                *render.Render
+	schedulerService *services.SchedulerService
+}
+
+// GetJobs lists the scheduled jobs, with when they run next and how they last ran.
+func (jh *JobsHandler) GetJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := jh.schedulerService.ListJobs(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jh.r.JSON(w, http.StatusOK, payloads.GetJobsPayload{Jobs: jobs})
+}
+
+// GetRuns lists the latest runs of a job, with their status and duration. The `limit` query
+// parameter sets how many are returned.
+func (jh *JobsHandler) GetRuns(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := defaultJobRunLimit
+	if query.Has("limit") {
+		l, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || l < 1 || l > maxJobRunLimit {
+			http.Error(w, fmt.Sprintf("Limit must be between 1 and %d.", maxJobRunLimit), http.StatusBadRequest)
+			return
+		}
+
+		limit = l
+	}
+
+	runs, err := jh.schedulerService.ListRuns(r.Context(), chi.URLParam(r, "name"), limit)
+	if err == structures.ErrNoJob {
+		jh.r.JSON(w, http.StatusNotFound, payloads.GetJobRunsPayload{Error: "Job not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jh.r.JSON(w, http.StatusOK, payloads.GetJobRunsPayload{Runs: runs})
+}
+
+// RunJob makes a job due right away, instead of waiting for its next scheduled time.
+func (jh *JobsHandler) RunJob(w http.ResponseWriter, r *http.Request) {
+	job, err := jh.schedulerService.Trigger(r.Context(), chi.URLParam(r, "name"))
+	if err == structures.ErrNoJob {
+		jh.r.JSON(w, http.StatusNotFound, payloads.JobPayload{Error: "Job not found."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to trigger job: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jh.r.JSON(w, http.StatusAccepted, payloads.JobPayload{Job: job})
+}
+
+func GetJobsRouter(ctx context.Context, render *render.Render, scs *services.SchedulerService) chi.Router {
+	r := chi.NewRouter()
+
+	jobsHandler := JobsHandler{r: render, schedulerService: scs}
+
+	r.Get("/", jobsHandler.GetJobs)
+	r.Get("/{name}/runs", jobsHandler.GetRuns)
+	r.Post("/{name}/run", jobsHandler.RunJob)
+
+	return r
+}
@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+const (
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 100
+)
+
+type LeaderboardsHandler struct {
+	r                  *render.Render
+	leaderboardService *services.LeaderboardService
+}
+
+// GetLeaderboard returns the top users or teams of a leaderboard, along with the requesting user's
+// rank, or their team's. The leaderboard is picked with the `group` (users, teams), `metric` (credits,
+// weight), `period` (weekly, monthly, all), `type` (a DisposalType) and `region` query parameters;
+// `limit` sets how many entries are returned.
+func (lh *LeaderboardsHandler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+	query := r.URL.Query()
+
+	group := structures.LeaderboardGroup(query.Get("group"))
+	if group == "" {
+		group = structures.GROUP_USERS
+	} else if group != structures.GROUP_USERS && group != structures.GROUP_TEAMS {
+		http.Error(w, "Invalid group.", http.StatusBadRequest)
+		return
+	}
+
+	metric := structures.LeaderboardMetric(query.Get("metric"))
+	if metric == "" {
+		metric = structures.METRIC_CREDITS
+	} else if !slices.Contains([]structures.LeaderboardMetric{structures.METRIC_CREDITS, structures.METRIC_WEIGHT}, metric) {
+		http.Error(w, "Invalid metric.", http.StatusBadRequest)
+		return
+	}
+
+	period := structures.LeaderboardPeriod(query.Get("period"))
+	if period == "" {
+		period = structures.PERIOD_WEEKLY
+	} else if !slices.Contains([]structures.LeaderboardPeriod{structures.PERIOD_WEEKLY, structures.PERIOD_MONTHLY,
+		structures.PERIOD_ALL_TIME}, period) {
+		http.Error(w, "Invalid period.", http.StatusBadRequest)
+		return
+	}
+
+	var disposalType *structures.DisposalType
+	if query.Has("type") {
+		t, err := strconv.Atoi(query.Get("type"))
+		if err != nil || t < int(structures.RECYCLABLE) || t > int(structures.ELECTRONIC) {
+			http.Error(w, "Invalid disposal type.", http.StatusBadRequest)
+			return
+		}
+
+		dt := structures.DisposalType(t)
+		disposalType = &dt
+	}
+
+	limit := defaultLeaderboardLimit
+	if query.Has("limit") {
+		l, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || l < 1 || l > maxLeaderboardLimit {
+			http.Error(w, fmt.Sprintf("Limit must be between 1 and %d.", maxLeaderboardLimit), http.StatusBadRequest)
+			return
+		}
+
+		limit = l
+	}
+
+	board, entries, me, err := lh.leaderboardService.Get(r.Context(), user, group, metric, period, disposalType,
+		query.Get("region"), limit)
+	if err != nil {
+		fmt.Printf("Failed to get leaderboard: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lh.r.JSON(w, http.StatusOK, payloads.LeaderboardPayload{Leaderboard: board, Entries: entries, Me: me})
+}
+
+func GetLeaderboardsRouter(ctx context.Context, render *render.Render, ls *services.LeaderboardService) chi.Router {
+	r := chi.NewRouter()
+
+	leaderboardsHandler := LeaderboardsHandler{r: render, leaderboardService: ls}
+
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/", leaderboardsHandler.GetLeaderboard)
+
+	return r
+}
@@ -2,7 +2,6 @@ package routes
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -27,8 +26,21 @@ import (
 type MeHandler struct {
 	r *render.Render
 
-	dbService   *services.DatabaseService
-	userService *services.UserService
+	dbService       *services.DatabaseService
+	userService     *services.UserService
+	profileService  *services.ProfileService
+	stationsService *services.StationsService
+
+	achievementService *services.AchievementService
+	streakService      *services.StreakService
+	impactService      *services.ImpactService
+	campaignService    *services.CampaignService
+	referralService    *services.ReferralService
+	feedService        *services.FeedService
+	outboxService      *services.OutboxService
+
+	notificationService *services.NotificationService
+	disposalService     *services.DisposalService
 }
 
 // GetProfile returns the profile of the currently authenticated user.
@@ -59,10 +71,7 @@ func (mh *MeHandler) RegisterDisposal(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
 
 	var input inputs.RegisterDisposalInput
-
-	err := json.NewDecoder(r.Body).Decode(&input)
-	if err != nil {
-		http.Error(w, "Invalid input.", http.StatusBadRequest)
+	if !decodeInput(w, r, mh.r, &input) {
 		return
 	}
 
@@ -76,12 +85,34 @@ func (mh *MeHandler) RegisterDisposal(w http.ResponseWriter, r *http.Request) {
 		Token:      uuid.New().String(),
 		IsClaimed:  false,
 		Disposals:  input.Disposals,
+		CreatedAt:  time.Now().Unix(),
+	}
+	disposal.ExpiresAt = mh.disposalService.ClaimExpiresAt(disposal.CreatedAt)
+
+	if input.StationId != "" {
+		station, found := mh.stationsService.GetStation(input.StationId)
+		if !found {
+			http.Error(w, "Station not found.", http.StatusBadRequest)
+			return
+		}
+
+		disposal.StationId = station.StationId
+		disposal.Region = station.Region
 	}
 
 	disposal.Credits = utils.Sum(disposal.Disposals, func(d structures.Disposal) float32 { return d.Credits })
 	disposal.Weight = utils.Sum(disposal.Disposals, func(d structures.Disposal) float32 { return d.Weight })
 
-	err = mh.dbService.InsertDisposal(&disposal)
+	err := mh.dbService.WithTransaction(r.Context(), func(ctx context.Context) error {
+		disposal.Id = ""
+
+		err := mh.dbService.InsertDisposal(ctx, &disposal)
+		if err != nil {
+			return err
+		}
+
+		return mh.outboxService.Add(ctx, structures.WEBHOOK_DISPOSAL_REGISTERED, withoutToken(disposal))
+	})
 	if err != nil {
 		fmt.Printf("Failed to insert disposal: %v\n", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -97,11 +128,7 @@ func (mh *MeHandler) ClaimDisposal(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
 
 	var input inputs.ClaimDisposalInput
-
-	err := json.NewDecoder(r.Body).Decode(&input)
-	if err != nil {
-		fmt.Printf("Failed to decode input: %v\n", err)
-		http.Error(w, "Invalid input.", http.StatusBadRequest)
+	if !decodeInput(w, r, mh.r, &input) {
 		return
 	}
 
@@ -122,20 +149,32 @@ func (mh *MeHandler) ClaimDisposal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = mh.dbService.UpdateDisposal(input.DisposalToken, bson.M{"$set": bson.M{"is_claimed": true, "user_id": user.Id}})
-	if err != nil {
-		fmt.Printf("Failed to update disposal: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	claimedAt := time.Now().Unix()
+
+	if disposal.IsExpired || (disposal.ExpiresAt != 0 && claimedAt >= disposal.ExpiresAt) {
+		fmt.Printf("Disposal claim expired: %v\n", disposal.Token)
+		http.Error(w, "Disposal claim expired.", http.StatusGone)
 		return
 	}
 
-	err = mh.dbService.UpdateUserById(user.Id, bson.M{"$inc": bson.M{"credits": disposal.Credits}})
-	if err != nil {
-		fmt.Printf("Failed to update user credits: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	impact := mh.impactService.Compute(disposal.Disposals)
+
+	claim := bson.M{
+		"is_claimed": true,
+		"user_id":    user.Id,
+		"claimed_at": claimedAt,
+		"impact":     impact,
+	}
+	if user.TeamId != "" {
+		claim["team_id"] = user.TeamId
 	}
 
+	disposal.IsClaimed = true
+	disposal.UserId = user.Id
+	disposal.ClaimedAt = claimedAt
+	disposal.Impact = &impact
+	disposal.TeamId = user.TeamId
+
 	weight, unit := getLargestUnit(disposal.Weight)
 
 	typeToName := map[structures.DisposalType]string{
@@ -162,22 +201,117 @@ func (mh *MeHandler) ClaimDisposal(w http.ResponseWriter, r *http.Request) {
 		UserId:          user.Id,
 		ClaimId:         disposal.Id,
 		Credits:         disposal.Credits,
-		Timestamp:       time.Now().Unix(),
+		Timestamp:       claimedAt,
 		Description:     transactionDescription,
 	}
 
-	err = mh.dbService.LinkTransactionToUserById(&transaction, user.Id)
-	if err != nil {
-		fmt.Printf("Failed to link transaction to user: %v\n", err)
+	// Claiming, crediting the user with the claim and its campaign bonuses, and telling
+	// subscribers about it share a transaction where the database supports them. Either way,
+	// only one concurrent claim can find the disposal unclaimed, so it is never paid out twice.
+	var campaignBonuses []structures.Transaction
+	err = mh.dbService.WithTransaction(r.Context(), func(ctx context.Context) error {
+		err := mh.dbService.ClaimDisposal(ctx, input.DisposalToken, claim)
+		if err != nil {
+			return err
+		}
+
+		err = mh.dbService.CreditUserById(ctx, &transaction, user.Id)
+		if err != nil {
+			return err
+		}
+
+		campaignBonuses, err = mh.campaignService.Apply(ctx, user, disposal, claimedAt)
+		if err != nil {
+			return err
+		}
+
+		return mh.outboxService.Add(ctx, structures.WEBHOOK_DISPOSAL_CLAIMED, withoutToken(*disposal))
+	})
+	if err == structures.ErrDisposalAlreadyClaimed {
+		fmt.Printf("Disposal already claimed: %v\n", disposal.Token)
+		http.Error(w, "Disposal already claimed.", http.StatusConflict)
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to claim disposal: %v\n", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	payload := payloads.ClaimDisposalPayload{Success: true, Disposal: disposal}
+	// The claim went through either way, so failing to update streaks, award badges, publish
+	// to followers' feeds or notify the user only gets logged.
+	mh.publish(r, &structures.Event{UserId: user.Id, Type: structures.EVENT_CLAIM, CreatedAt: claimedAt,
+		Weight: disposal.Weight})
+
+	bonuses, milestones, err := mh.streakService.Record(r.Context(), user, claimedAt)
+	if err != nil {
+		fmt.Printf("Failed to record streak: %v\n", err)
+	}
+	if bonuses == nil {
+		bonuses = []structures.Transaction{}
+	}
+
+	for _, milestone := range milestones {
+		mh.publish(r, &structures.Event{UserId: user.Id, Type: structures.EVENT_STREAK, CreatedAt: claimedAt,
+			StreakType: milestone.Type, StreakLength: milestone.Length})
+	}
+
+	bonuses = append(bonuses, campaignBonuses...)
+
+	referralBonuses, err := mh.referralService.Reward(r.Context(), user, claimedAt)
+	if err != nil {
+		fmt.Printf("Failed to reward referral: %v\n", err)
+	}
+	bonuses = append(bonuses, referralBonuses...)
+
+	badges, err := mh.achievementService.Evaluate(r.Context(), user)
+	if err != nil {
+		fmt.Printf("Failed to evaluate achievements: %v\n", err)
+		badges = []structures.Achievement{}
+	}
+
+	for _, badge := range badges {
+		mh.publish(r, &structures.Event{UserId: user.Id, Type: structures.EVENT_BADGE, CreatedAt: claimedAt,
+			BadgeId: badge.Id, BadgeName: badge.Name})
+	}
+
+	credits := disposal.Credits + utils.Sum(bonuses, func(t structures.Transaction) float32 { return t.Credits })
+
+	err = mh.notificationService.Notify(r.Context(), user.Id, &structures.Notification{
+		Category: structures.NOTIFY_CREDITS,
+		Title:    "Credits received",
+		Body:     fmt.Sprintf("You earned %.2f credits for your disposal.", credits),
+		Data:     map[string]string{"claim_id": disposal.Id},
+	})
+	if err != nil {
+		fmt.Printf("Failed to notify user %v of their claim: %v\n", user.Id, err)
+	}
+
+	payload := payloads.ClaimDisposalPayload{
+		Success:  true,
+		Disposal: disposal,
+		Badges:   badges,
+		Bonuses:  bonuses,
+		Impact:   &impact,
+	}
 
 	mh.r.JSON(w, http.StatusOK, payload)
 }
 
+// publish adds an event to the current user's followers' feeds, logging any failure.
+func (mh *MeHandler) publish(r *http.Request, event *structures.Event) {
+	err := mh.feedService.Publish(r.Context(), event)
+	if err != nil {
+		fmt.Printf("Failed to publish %v event of user %v: %v\n", event.Type, event.UserId, err)
+	}
+}
+
+// withoutToken returns the disposal as it is sent to subscribers. The token is left out,
+// since anyone holding it could claim the disposal.
+func withoutToken(disposal structures.DisposalClaim) structures.DisposalClaim {
+	disposal.Token = ""
+	return disposal
+}
+
 func (mh *MeHandler) GetAvatar(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
 
@@ -196,6 +330,70 @@ func (mh *MeHandler) GetAvatar(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GetImpact returns the environmental impact of the current user's claims, and of everyone's.
+func (mh *MeHandler) GetImpact(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	userImpact, err := mh.impactService.GetUserImpact(r.Context(), user.Id)
+	if err != nil {
+		fmt.Printf("Failed to get user impact: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	platformImpact, err := mh.impactService.GetPlatformImpact(r.Context())
+	if err != nil {
+		fmt.Printf("Failed to get platform impact: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mh.r.JSON(w, http.StatusOK, payloads.GetImpactPayload{User: userImpact, Platform: platformImpact})
+}
+
+// UpdatePrivacy sets who can see the current user on public profiles and leaderboards.
+// It receives an UpdatePrivacyInput and returns the updated GetEcobucksProfilePayload.
+func (mh *MeHandler) UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.UpdatePrivacyInput
+	if !decodeInput(w, r, mh.r, &input) {
+		return
+	}
+
+	err := mh.profileService.SetVisibility(user, input.Visibility)
+	if err != nil {
+		fmt.Printf("Failed to update visibility: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mh.r.JSON(w, http.StatusOK, payloads.GetEcobucksProfilePayload{Profile: user.ToProfile()})
+}
+
+// UpdateTimezone sets the time zone the current user's streaks are counted in.
+// It receives an UpdateTimezoneInput and returns the updated GetEcobucksProfilePayload.
+// Streaks already running keep their current deadline, and follow the new time zone from the next claim.
+func (mh *MeHandler) UpdateTimezone(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.UpdateTimezoneInput
+	if !decodeInput(w, r, mh.r, &input) {
+		return
+	}
+
+	err := mh.dbService.UpdateUserById(user.Id, bson.M{"$set": bson.M{"timezone": input.Timezone}})
+	if err != nil {
+		fmt.Printf("Failed to update timezone: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user.Timezone = input.Timezone
+
+	mh.r.JSON(w, http.StatusOK, payloads.GetEcobucksProfilePayload{Profile: user.ToProfile()})
+}
+
 func (mh *MeHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
 
@@ -256,19 +454,86 @@ func (mh *MeHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 	mh.r.JSON(w, http.StatusOK, payloads.UploadAvatarPayload{Success: true})
 }
 
-func GetMeRouter(ctx context.Context, render *render.Render, us *services.UserService, db *services.DatabaseService) chi.Router {
+func GetMeRouter(ctx context.Context, render *render.Render, us *services.UserService, db *services.DatabaseService,
+	as *services.AuthService, tfs *services.TwoFactorService, ss *services.SessionService, ats *services.ApiTokenService,
+	ads *services.AccountDeletionService, des *services.DataExportService, ps *services.ProfileService,
+	sts *services.StationsService, achs *services.AchievementService, strs *services.StreakService,
+	is *services.ImpactService, cs *services.CampaignService, rs *services.ReferralService,
+	mcs *services.MerchantService, frs *services.FriendService, fds *services.FeedService,
+	obs *services.OutboxService, ns *services.NotificationService, dss *services.DisposalService) chi.Router {
 	r := chi.NewRouter()
 
-	meHandler := MeHandler{r: render, userService: us, dbService: db}
-
-	r.Get("/", meHandler.GetProfile)
-
-	r.Get("/avatar", meHandler.GetAvatar)
-	r.Put("/avatar", meHandler.UploadAvatar)
-
-	r.Get("/disposals", meHandler.GetDisposals)
-	r.Put("/disposals", meHandler.RegisterDisposal)
-	r.Post("/disposals", meHandler.ClaimDisposal)
+	meHandler := MeHandler{
+		r:                  render,
+		userService:        us,
+		dbService:          db,
+		profileService:     ps,
+		stationsService:    sts,
+		achievementService: achs,
+		streakService:      strs,
+		impactService:      is,
+		campaignService:    cs,
+		referralService:    rs,
+		feedService:        fds,
+		outboxService:      obs,
+
+		notificationService: ns,
+		disposalService:     dss,
+	}
+	accountHandler := AccountHandler{r: render, authService: as, twoFactorService: tfs, accountDeletionService: ads}
+	dataExportHandler := DataExportHandler{r: render, dataExportService: des}
+	referralsHandler := ReferralsHandler{r: render, referralService: rs}
+	vouchersHandler := VouchersHandler{r: render, merchantService: mcs}
+	friendsHandler := FriendsHandler{r: render, dbService: db, friendService: frs, profileService: ps, feedService: fds}
+	notificationsHandler := NotificationsHandler{r: render, notificationService: ns}
+
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/", meHandler.GetProfile)
+
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Put("/privacy", meHandler.UpdatePrivacy)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Put("/timezone", meHandler.UpdateTimezone)
+
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/referrals", referralsHandler.GetReferrals)
+
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/following", friendsHandler.GetFollowing)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Post("/following", friendsHandler.Follow)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Delete("/following/{username}", friendsHandler.Unfollow)
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/followers", friendsHandler.GetFollowers)
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/blocked", friendsHandler.GetBlocked)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Post("/blocked", friendsHandler.Block)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Delete("/blocked/{username}", friendsHandler.Unblock)
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/feed", friendsHandler.GetFeed)
+
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/notifications", notificationsHandler.GetNotifications)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Post("/notifications/read", notificationsHandler.MarkAllRead)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).
+		Post("/notifications/{id}/read", notificationsHandler.MarkRead)
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).
+		Get("/notifications/preferences", notificationsHandler.GetPreferences)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).
+		Put("/notifications/preferences/{category}", notificationsHandler.UpdatePreference)
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/devices", notificationsHandler.GetDevices)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Post("/devices", notificationsHandler.RegisterDevice)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Delete("/devices/{id}", notificationsHandler.RemoveDevice)
+
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/avatar", meHandler.GetAvatar)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Put("/avatar", meHandler.UploadAvatar)
+
+	r.With(middleware.RequireScope(structures.SCOPE_READ_DISPOSALS)).Get("/disposals", meHandler.GetDisposals)
+	r.With(middleware.RequireScope(structures.SCOPE_READ_DISPOSALS)).Get("/impact", meHandler.GetImpact)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_DISPOSALS), middleware.RequireTwoFactor(tfs)).
+		Put("/disposals", meHandler.RegisterDisposal)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_DISPOSALS)).Post("/disposals", meHandler.ClaimDisposal)
+
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/vouchers", vouchersHandler.GetVouchers)
+	r.With(middleware.RequireSession).Post("/vouchers", vouchersHandler.IssueVoucher)
+
+	r.With(middleware.RequireSession).Delete("/", accountHandler.DeleteAccount)
+	r.With(middleware.RequireSession).Delete("/deletion", accountHandler.CancelDeletion)
+	r.With(middleware.RequireSession).Get("/export", dataExportHandler.GetExport)
+
+	r.With(middleware.RequireSession).Mount("/2fa", GetTwoFactorRouter(ctx, render, tfs))
+	r.With(middleware.RequireSession).Mount("/sessions", GetSessionsRouter(ctx, render, ss))
+	r.With(middleware.RequireSession).Mount("/tokens", GetApiTokensRouter(ctx, render, ats))
 
 	return r
 }
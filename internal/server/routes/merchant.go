@@ -0,0 +1,305 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+const defaultRedemptionLimit = 50
+const maxRedemptionLimit = 500
+
+// MerchantHandler serves the merchant side of the API, for the staff of partner businesses.
+// Every route acts on the merchant of the requesting user.
+type MerchantHandler struct {
+	r               *render.Render
+	merchantService *services.MerchantService
+	dbService       *services.DatabaseService
+	outboxService   *services.OutboxService
+}
+
+func (mch *MerchantHandler) GetMerchant(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	merchant, err := mch.merchantService.GetMerchant(r.Context(), user.MerchantId)
+	if err == structures.ErrNoMerchant {
+		mch.r.JSON(w, http.StatusNotFound, payloads.MerchantPayload{Error: "Merchant not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mch.r.JSON(w, http.StatusOK, payloads.MerchantPayload{Merchant: merchant})
+}
+
+// GetOffers lists the merchant's offers, including inactive ones.
+func (mch *MerchantHandler) GetOffers(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	offers, err := mch.merchantService.ListOffers(r.Context(), user.MerchantId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mch.r.JSON(w, http.StatusOK, payloads.GetOffersPayload{Offers: offers})
+}
+
+// CreateOffer receives an OfferInput and returns the created offer in an OfferPayload.
+func (mch *MerchantHandler) CreateOffer(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.OfferInput
+	if !decodeInput(w, r, mch.r, &input) {
+		return
+	}
+
+	offer := offerFromInput(&input)
+
+	err := mch.merchantService.CreateOffer(r.Context(), user.MerchantId, offer)
+	if err != nil {
+		fmt.Printf("Failed to create offer: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mch.r.JSON(w, http.StatusCreated, payloads.OfferPayload{Offer: offer})
+}
+
+// UpdateOffer receives an OfferInput and replaces the offer with it.
+func (mch *MerchantHandler) UpdateOffer(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.OfferInput
+	if !decodeInput(w, r, mch.r, &input) {
+		return
+	}
+
+	offer := offerFromInput(&input)
+
+	err := mch.merchantService.UpdateOffer(r.Context(), user.MerchantId, chi.URLParam(r, "id"), offer)
+	if err == structures.ErrNoOffer {
+		mch.r.JSON(w, http.StatusNotFound, payloads.OfferPayload{Error: "Offer not found."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to update offer: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mch.r.JSON(w, http.StatusOK, payloads.OfferPayload{Offer: offer})
+}
+
+func (mch *MerchantHandler) DeleteOffer(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	err := mch.merchantService.DeleteOffer(r.Context(), user.MerchantId, chi.URLParam(r, "id"))
+	if err == structures.ErrNoOffer {
+		mch.r.JSON(w, http.StatusNotFound, payloads.OfferPayload{Error: "Offer not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ValidateVoucher checks a voucher scanned from a customer's QR code without redeeming it,
+// so the staff can confirm what it's for. It returns a VoucherPayload.
+func (mch *MerchantHandler) ValidateVoucher(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	voucher, err := mch.merchantService.ValidateVoucher(r.Context(), user.MerchantId, chi.URLParam(r, "code"))
+	if err == structures.ErrNoVoucher {
+		mch.r.JSON(w, http.StatusNotFound, payloads.VoucherPayload{
+			Error: "Voucher not found, already redeemed, expired or not valid here.",
+		})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mch.r.JSON(w, http.StatusOK, payloads.VoucherPayload{Voucher: voucher})
+}
+
+// RedeemVoucher burns a voucher scanned from a customer's QR code, taking its credits from them.
+// It receives a RedeemVoucherInput and returns a RedemptionPayload.
+func (mch *MerchantHandler) RedeemVoucher(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.RedeemVoucherInput
+	if !decodeInput(w, r, mch.r, &input) {
+		return
+	}
+
+	// The redemption is only announced to subscribers if it goes through.
+	var redemption *structures.Redemption
+	err := mch.dbService.WithTransaction(r.Context(), func(ctx context.Context) error {
+		var err error
+		redemption, err = mch.merchantService.Redeem(ctx, user, input.Code)
+		if err != nil {
+			return err
+		}
+
+		return mch.outboxService.Add(ctx, structures.WEBHOOK_VOUCHER_REDEEMED, redemption)
+	})
+	if err == structures.ErrNoVoucher {
+		mch.r.JSON(w, http.StatusNotFound, payloads.RedemptionPayload{
+			Error: "Voucher not found, already redeemed, expired or not valid here.",
+		})
+		return
+	} else if err == structures.ErrInsufficientCredits {
+		mch.r.JSON(w, http.StatusPaymentRequired, payloads.RedemptionPayload{
+			Error: "The customer doesn't have enough credits.",
+		})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to redeem voucher: %v\n", err)
+		mch.r.JSON(w, http.StatusInternalServerError, payloads.RedemptionPayload{Error: "Failed to redeem voucher."})
+		return
+	}
+
+	mch.r.JSON(w, http.StatusOK, payloads.RedemptionPayload{Success: true, Redemption: redemption})
+}
+
+// GetRedemptions lists the merchant's redemptions, latest first. The `from` and `to` query
+// parameters bound them by Unix time, and `limit` sets how many are returned.
+func (mch *MerchantHandler) GetRedemptions(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+	query := r.URL.Query()
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultRedemptionLimit
+	if query.Has("limit") {
+		l, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || l < 1 || l > maxRedemptionLimit {
+			http.Error(w, fmt.Sprintf("Limit must be between 1 and %d.", maxRedemptionLimit), http.StatusBadRequest)
+			return
+		}
+
+		limit = l
+	}
+
+	redemptions, err := mch.merchantService.ListRedemptions(r.Context(), user.MerchantId, from, to, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mch.r.JSON(w, http.StatusOK, payloads.GetRedemptionsPayload{Redemptions: redemptions})
+}
+
+// GetSettlements totals the merchant's redemptions by `period` (daily, weekly, monthly),
+// between the `from` and `to` query parameters.
+func (mch *MerchantHandler) GetSettlements(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	period := structures.SettlementPeriod(r.URL.Query().Get("period"))
+	if period == "" {
+		period = structures.SETTLEMENT_MONTHLY
+	} else if !slices.Contains([]structures.SettlementPeriod{structures.SETTLEMENT_DAILY, structures.SETTLEMENT_WEEKLY,
+		structures.SETTLEMENT_MONTHLY}, period) {
+		http.Error(w, "Invalid period.", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+
+	settlements, err := mch.merchantService.Settlements(r.Context(), user.MerchantId, period, from, to)
+	if err != nil {
+		fmt.Printf("Failed to get settlements: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	payload := payloads.GetSettlementsPayload{Period: period, Settlements: settlements}
+	for _, settlement := range settlements {
+		payload.Total.Redemptions += settlement.Redemptions
+		payload.Total.Credits += settlement.Credits
+	}
+	if len(settlements) > 0 {
+		payload.Total.PeriodStart = settlements[len(settlements)-1].PeriodStart
+	}
+
+	mch.r.JSON(w, http.StatusOK, payload)
+}
+
+// parseTimeRange reads the `from` and `to` query parameters as Unix times, responding with
+// 400 if either is invalid. Both default to zero.
+func parseTimeRange(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	query := r.URL.Query()
+	var bounds [2]int64
+
+	for i, name := range []string{"from", "to"} {
+		if !query.Has(name) {
+			continue
+		}
+
+		value, err := strconv.ParseInt(query.Get(name), 10, 64)
+		if err != nil || value < 0 {
+			http.Error(w, "Invalid "+name+" time.", http.StatusBadRequest)
+			return 0, 0, false
+		}
+
+		bounds[i] = value
+	}
+
+	return bounds[0], bounds[1], true
+}
+
+func offerFromInput(input *inputs.OfferInput) *structures.Offer {
+	return &structures.Offer{
+		Title:       input.Title,
+		Description: input.Description,
+		Credits:     input.Credits,
+		Active:      input.Active,
+	}
+}
+
+func GetMerchantRouter(ctx context.Context, render *render.Render, mcs *services.MerchantService,
+	ds *services.DatabaseService, tfs *services.TwoFactorService, obs *services.OutboxService) chi.Router {
+	r := chi.NewRouter()
+
+	r.Use(middleware.RequireMerchant)
+	r.Use(middleware.RequireTwoFactor(tfs))
+
+	merchantHandler := MerchantHandler{r: render, merchantService: mcs, dbService: ds, outboxService: obs}
+
+	read := middleware.RequireScope(structures.SCOPE_READ_MERCHANT)
+	write := middleware.RequireScope(structures.SCOPE_WRITE_MERCHANT)
+
+	r.With(read).Get("/", merchantHandler.GetMerchant)
+
+	r.With(read).Get("/offers", merchantHandler.GetOffers)
+	r.With(write).Post("/offers", merchantHandler.CreateOffer)
+	r.With(write).Put("/offers/{id}", merchantHandler.UpdateOffer)
+	r.With(write).Delete("/offers/{id}", merchantHandler.DeleteOffer)
+
+	r.With(read).Get("/vouchers/{code}", merchantHandler.ValidateVoucher)
+	r.With(write).Post("/redemptions", merchantHandler.RedeemVoucher)
+	r.With(read).Get("/redemptions", merchantHandler.GetRedemptions)
+	r.With(read).Get("/settlements", merchantHandler.GetSettlements)
+
+	return r
+}
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+// MerchantsHandler lets admins onboard partner merchants.
+type MerchantsHandler struct {
+	r               *render.Render
+	dbService       *services.DatabaseService
+	merchantService *services.MerchantService
+}
+
+func (msh *MerchantsHandler) GetMerchants(w http.ResponseWriter, r *http.Request) {
+	merchants, err := msh.merchantService.ListMerchants(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	msh.r.JSON(w, http.StatusOK, payloads.GetMerchantsPayload{Merchants: merchants})
+}
+
+// CreateMerchant receives a CreateMerchantInput, creates the merchant and makes the given user
+// its first staff member. It returns a MerchantPayload.
+func (msh *MerchantsHandler) CreateMerchant(w http.ResponseWriter, r *http.Request) {
+	var input inputs.CreateMerchantInput
+	if !decodeInput(w, r, msh.r, &input) {
+		return
+	}
+
+	owner, err := msh.dbService.GetUserByUsername(input.Username)
+	if err == structures.ErrNoUser {
+		msh.r.JSON(w, http.StatusUnprocessableEntity, payloads.MerchantPayload{Error: "User not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	merchant := structures.Merchant{Name: input.Name, Description: input.Description}
+
+	err = msh.merchantService.CreateMerchant(r.Context(), &merchant, owner)
+	if err != nil {
+		fmt.Printf("Failed to create merchant: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	msh.r.JSON(w, http.StatusCreated, payloads.MerchantPayload{Merchant: &merchant})
+}
+
+// AddMember receives an AddMerchantMemberInput and adds the user to the merchant's staff.
+func (msh *MerchantsHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	var input inputs.AddMerchantMemberInput
+	if !decodeInput(w, r, msh.r, &input) {
+		return
+	}
+
+	user, err := msh.dbService.GetUserByUsername(input.Username)
+	if err == structures.ErrNoUser {
+		msh.r.JSON(w, http.StatusUnprocessableEntity, payloads.MerchantPayload{Error: "User not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = msh.merchantService.AddMember(r.Context(), chi.URLParam(r, "id"), user)
+	if err == structures.ErrNoMerchant {
+		msh.r.JSON(w, http.StatusNotFound, payloads.MerchantPayload{Error: "Merchant not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetMerchantsRouter(ctx context.Context, render *render.Render, db *services.DatabaseService,
+	mcs *services.MerchantService) chi.Router {
+	r := chi.NewRouter()
+
+	merchantsHandler := MerchantsHandler{r: render, dbService: db, merchantService: mcs}
+
+	r.Get("/", merchantsHandler.GetMerchants)
+	r.Post("/", merchantsHandler.CreateMerchant)
+	r.Post("/{id}/members", merchantsHandler.AddMember)
+
+	return r
+}
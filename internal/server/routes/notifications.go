@@ -0,0 +1,198 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+const (
+	defaultNotificationLimit = 20
+	maxNotificationLimit     = 100
+)
+
+type NotificationsHandler struct {
+	r                   *render.Render
+	notificationService *services.NotificationService
+}
+
+// GetNotifications returns the current user's inbox, newest first, with how many notifications
+// are unread. Passing `unread=true` leaves out the ones already read, `limit` sets the page
+// size and `before` takes the `next` cursor of the previous page.
+func (nh *NotificationsHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+	query := r.URL.Query()
+
+	limit := defaultNotificationLimit
+	if query.Has("limit") {
+		l, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || l < 1 || l > maxNotificationLimit {
+			http.Error(w, fmt.Sprintf("Limit must be between 1 and %d.", maxNotificationLimit), http.StatusBadRequest)
+			return
+		}
+
+		limit = l
+	}
+
+	notifications, next, err := nh.notificationService.List(r.Context(), user.Id, query.Get("unread") == "true",
+		query.Get("before"), limit)
+	if err == structures.ErrInvalidDatabaseId {
+		http.Error(w, "Invalid cursor.", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to get notifications of user %v: %v\n", user.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	unread, err := nh.notificationService.CountUnread(r.Context(), user.Id)
+	if err != nil {
+		fmt.Printf("Failed to count unread notifications of user %v: %v\n", user.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	nh.r.JSON(w, http.StatusOK, payloads.GetNotificationsPayload{
+		Notifications: notifications,
+		Unread:        unread,
+		Next:          next,
+	})
+}
+
+// MarkRead marks one of the current user's notifications as read.
+func (nh *NotificationsHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	err := nh.notificationService.MarkRead(r.Context(), user.Id, chi.URLParam(r, "id"))
+	if err == structures.ErrNoNotification {
+		http.Error(w, "Notification not found.", http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to mark notification as read: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MarkAllRead marks every notification of the current user as read.
+func (nh *NotificationsHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	err := nh.notificationService.MarkAllRead(r.Context(), user.Id)
+	if err != nil {
+		fmt.Printf("Failed to mark notifications of user %v as read: %v\n", user.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPreferences returns how the current user wants to hear about every category of notifications.
+func (nh *NotificationsHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	nh.r.JSON(w, http.StatusOK, payloads.NotificationPreferencesPayload{
+		Preferences: nh.notificationService.Preferences(user),
+	})
+}
+
+// UpdatePreference receives an UpdateNotificationPreferenceInput and sets whether notifications
+// of a category show up in the inbox, and whether they're pushed to the user's devices.
+func (nh *NotificationsHandler) UpdatePreference(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	category := structures.NotificationCategory(chi.URLParam(r, "category"))
+	if !slices.Contains(structures.NotificationCategories, category) {
+		nh.r.JSON(w, http.StatusNotFound, payloads.NotificationPreferencesPayload{Error: "Unknown category."})
+		return
+	}
+
+	var input inputs.UpdateNotificationPreferenceInput
+	if !decodeInput(w, r, nh.r, &input) {
+		return
+	}
+
+	preference := structures.NotificationPreference{Category: category, InApp: input.InApp, Push: input.Push}
+
+	err := nh.notificationService.UpdatePreference(user, preference)
+	if err != nil {
+		fmt.Printf("Failed to update notification preferences of user %v: %v\n", user.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if user.NotificationPreferences == nil {
+		user.NotificationPreferences = map[structures.NotificationCategory]structures.NotificationPreference{}
+	}
+	user.NotificationPreferences[category] = preference
+
+	nh.r.JSON(w, http.StatusOK, payloads.NotificationPreferencesPayload{
+		Preferences: nh.notificationService.Preferences(user),
+	})
+}
+
+// GetDevices lists the current user's devices registered for push notifications.
+func (nh *NotificationsHandler) GetDevices(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	devices, err := nh.notificationService.ListDevices(r.Context(), user.Id)
+	if err != nil {
+		fmt.Printf("Failed to get devices of user %v: %v\n", user.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	nh.r.JSON(w, http.StatusOK, payloads.GetDevicesPayload{Devices: devices})
+}
+
+// RegisterDevice receives a RegisterDeviceInput with the token the push provider gave the
+// device, and starts pushing notifications to it.
+func (nh *NotificationsHandler) RegisterDevice(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.RegisterDeviceInput
+	if !decodeInput(w, r, nh.r, &input) {
+		return
+	}
+
+	device := structures.Device{Platform: input.Platform, Token: input.Token, Name: input.Name}
+
+	err := nh.notificationService.RegisterDevice(r.Context(), user.Id, &device)
+	if err != nil {
+		fmt.Printf("Failed to register device of user %v: %v\n", user.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	nh.r.JSON(w, http.StatusCreated, payloads.DevicePayload{Device: &device})
+}
+
+// RemoveDevice stops pushing notifications to one of the current user's devices.
+func (nh *NotificationsHandler) RemoveDevice(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	err := nh.notificationService.RemoveDevice(r.Context(), user.Id, chi.URLParam(r, "id"))
+	if err == structures.ErrNoDevice {
+		http.Error(w, "Device not found.", http.StatusNotFound)
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to remove device: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+type ReferralsHandler struct {
+	r               *render.Render
+	referralService *services.ReferralService
+}
+
+// GetReferrals returns the current user's referral code, generating it for accounts that
+// predate referrals, along with the users who signed up with it and whether they were rewarded.
+func (rh *ReferralsHandler) GetReferrals(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	code, err := rh.referralService.EnsureCode(r.Context(), user)
+	if err != nil {
+		fmt.Printf("Failed to generate referral code for user %v: %v\n", user.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	referrals, err := rh.referralService.ListByReferrer(r.Context(), user.Id)
+	if err != nil {
+		fmt.Printf("Failed to get referrals of user %v: %v\n", user.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	payload := payloads.GetReferralsPayload{
+		Code:         code,
+		MaxReferrals: rh.referralService.MaxPerUser(),
+		Referrals:    referrals,
+	}
+
+	for _, referral := range referrals {
+		switch referral.Status {
+		case structures.REFERRAL_PENDING:
+			payload.Pending++
+		case structures.REFERRAL_REWARDED:
+			payload.Rewarded++
+		}
+	}
+
+	rh.r.JSON(w, http.StatusOK, payload)
+}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+type SessionsHandler struct {
+	r              *render.Render
+	sessionService *services.SessionService
+}
+
+// GetSessions lists the devices the current user is logged in on.
+// It returns a GetSessionsPayload, with the session of the current request marked.
+func (sh *SessionsHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+	current := r.Context().Value(middleware.SessionContextKey).(*structures.Session)
+
+	sessions, err := sh.sessionService.ListByUser(user.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == current.Id
+	}
+
+	sh.r.JSON(w, http.StatusOK, payloads.GetSessionsPayload{Sessions: sessions})
+}
+
+// RevokeSession logs the current user out of one of their sessions.
+func (sh *SessionsHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	err := sh.sessionService.Revoke(user.Id, chi.URLParam(r, "id"))
+	if err == structures.ErrNoSession {
+		http.Error(w, "Session not found.", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetSessionsRouter(ctx context.Context, render *render.Render, ss *services.SessionService) chi.Router {
+	r := chi.NewRouter()
+
+	sessionsHandler := SessionsHandler{r: render, sessionService: ss}
+
+	r.Get("/", sessionsHandler.GetSessions)
+	r.Delete("/{id}", sessionsHandler.RevokeSession)
+
+	return r
+}
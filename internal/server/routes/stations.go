@@ -2,7 +2,6 @@ package routes
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -22,7 +21,7 @@ type StationsHandler struct {
 // GetStations returns a list of all registered stations.
 // It returns a GetEcobucksStationsPayload with a list of LocationClaims.
 func (sh *StationsHandler) GetStations(w http.ResponseWriter, r *http.Request) {
-	sh.r.JSON(w, http.StatusOK, sh.stationsService.Locations)
+	sh.r.JSON(w, http.StatusOK, sh.stationsService.GetLocations())
 }
 
 func (sh *StationsHandler) RegisterStation(w http.ResponseWriter, r *http.Request) {
@@ -36,10 +35,7 @@ func (sh *StationsHandler) RegisterStation(w http.ResponseWriter, r *http.Reques
 
 	// Parse station from request body
 	var input inputs.RegisterEcobucksStationInput
-
-	err := json.NewDecoder(r.Body).Decode(&input)
-	if err != nil {
-		http.Error(w, "Invalid input.", http.StatusBadRequest)
+	if !decodeInput(w, r, sh.r, &input) {
 		return
 	}
 
@@ -48,7 +44,7 @@ func (sh *StationsHandler) RegisterStation(w http.ResponseWriter, r *http.Reques
 }
 
 func GetStationsRouter(ctx context.Context, render *render.Render,
-	ss *services.StationsService) chi.Router {
+	ss *services.StationsService, tfs *services.TwoFactorService) chi.Router {
 	r := chi.NewRouter()
 
 	stationsHandler := StationsHandler{
@@ -56,8 +52,9 @@ func GetStationsRouter(ctx context.Context, render *render.Render,
 		stationsService: ss,
 	}
 
-	r.Get("/", stationsHandler.GetStations)
-	r.Put("/", stationsHandler.RegisterStation)
+	r.With(middleware.RequireScope(structures.SCOPE_READ_STATIONS)).Get("/", stationsHandler.GetStations)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_STATIONS), middleware.RequireTwoFactor(tfs)).
+		Put("/", stationsHandler.RegisterStation)
 
 	return r
 }
@@ -0,0 +1,151 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+type TeamsHandler struct {
+	r           *render.Render
+	teamService *services.TeamService
+}
+
+// GetTeam returns a team with its totals, its members and what each contributed,
+// and its progress in the latest challenges. The invite code is only shown to members.
+func (th *TeamsHandler) GetTeam(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	team, err := th.teamService.Get(r.Context(), chi.URLParam(r, "id"))
+	if err == structures.ErrNoTeam {
+		th.r.JSON(w, http.StatusNotFound, payloads.GetTeamPayload{Error: "Team not found."})
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if user.TeamId != team.Id {
+		team.InviteCode = ""
+	}
+
+	totals, err := th.teamService.Totals(r.Context(), team.Id)
+	if err != nil {
+		fmt.Printf("Failed to get totals of team %v: %v\n", team.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	members, err := th.teamService.Members(r.Context(), user, team)
+	if err != nil {
+		fmt.Printf("Failed to get members of team %v: %v\n", team.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	challenges, err := th.teamService.Progress(r.Context(), team.Id)
+	if err != nil {
+		fmt.Printf("Failed to get challenges of team %v: %v\n", team.Id, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	th.r.JSON(w, http.StatusOK, payloads.GetTeamPayload{
+		Team:       team,
+		Totals:     totals,
+		Members:    members,
+		Challenges: challenges,
+	})
+}
+
+// CreateTeam receives a CreateTeamInput and makes the current user the owner of a new team.
+// It returns a TeamPayload with the invite code to share.
+func (th *TeamsHandler) CreateTeam(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.CreateTeamInput
+	if !decodeInput(w, r, th.r, &input) {
+		return
+	}
+
+	team := structures.Team{Name: input.Name, Description: input.Description}
+
+	err := th.teamService.Create(r.Context(), user, &team)
+	if err == structures.ErrAlreadyInTeam {
+		th.r.JSON(w, http.StatusConflict, payloads.TeamPayload{Error: "Leave your current team first."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to create team: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	th.r.JSON(w, http.StatusCreated, payloads.TeamPayload{Team: &team})
+}
+
+// JoinTeam receives a JoinTeamInput and adds the current user to the team with that invite code.
+func (th *TeamsHandler) JoinTeam(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.JoinTeamInput
+	if !decodeInput(w, r, th.r, &input) {
+		return
+	}
+
+	team, err := th.teamService.Join(r.Context(), user, input.InviteCode)
+	if err == structures.ErrNoTeam {
+		th.r.JSON(w, http.StatusNotFound, payloads.TeamPayload{Error: "Invalid invite code."})
+		return
+	} else if err == structures.ErrAlreadyInTeam {
+		th.r.JSON(w, http.StatusConflict, payloads.TeamPayload{Error: "Leave your current team first."})
+		return
+	} else if err == structures.ErrTeamFull {
+		th.r.JSON(w, http.StatusConflict, payloads.TeamPayload{Error: "This team is full."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to join team: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	th.r.JSON(w, http.StatusOK, payloads.TeamPayload{Team: team})
+}
+
+// LeaveTeam removes the current user from their team.
+func (th *TeamsHandler) LeaveTeam(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	err := th.teamService.Leave(r.Context(), user)
+	if err == structures.ErrNotInTeam {
+		th.r.JSON(w, http.StatusConflict, payloads.TeamPayload{Error: "You're not in a team."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to leave team: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetTeamsRouter(ctx context.Context, render *render.Render, tms *services.TeamService) chi.Router {
+	r := chi.NewRouter()
+
+	teamsHandler := TeamsHandler{r: render, teamService: tms}
+
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Post("/", teamsHandler.CreateTeam)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Post("/join", teamsHandler.JoinTeam)
+	r.With(middleware.RequireScope(structures.SCOPE_WRITE_PROFILE)).Post("/leave", teamsHandler.LeaveTeam)
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/{id}", teamsHandler.GetTeam)
+
+	return r
+}
@@ -0,0 +1,128 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+type TwoFactorHandler struct {
+	r                *render.Render
+	twoFactorService *services.TwoFactorService
+}
+
+// GetStatus returns whether the current user has 2FA enabled, and whether their roles require it.
+func (tfh *TwoFactorHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	required, err := tfh.twoFactorService.IsRequired(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tfh.r.JSON(w, http.StatusOK, payloads.TwoFactorStatusPayload{Enabled: user.HasTwoFactor(), Required: required})
+}
+
+// BeginEnrollment starts TOTP enrollment, replacing any unfinished one.
+// It returns a TwoFactorEnrollmentPayload with the secret and its provisioning URI.
+func (tfh *TwoFactorHandler) BeginEnrollment(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	secret, uri, err := tfh.twoFactorService.BeginEnrollment(user)
+	if err == structures.ErrTwoFactorAlreadyEnabled {
+		tfh.r.JSON(w, http.StatusConflict, payloads.TwoFactorEnrollmentPayload{Error: "Two-factor authentication is already enabled."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to begin 2FA enrollment: %v\n", err)
+		tfh.r.JSON(w, http.StatusInternalServerError, payloads.TwoFactorEnrollmentPayload{Error: "Failed to begin enrollment."})
+		return
+	}
+
+	tfh.r.JSON(w, http.StatusOK, payloads.TwoFactorEnrollmentPayload{Success: true, Secret: secret, ProvisioningUri: uri})
+}
+
+// ConfirmEnrollment enables 2FA if the given code matches the enrolled secret.
+// It returns a TwoFactorRecoveryCodesPayload.
+func (tfh *TwoFactorHandler) ConfirmEnrollment(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.TwoFactorCodeInput
+	if !decodeInput(w, r, tfh.r, &input) {
+		return
+	}
+
+	codes, err := tfh.twoFactorService.ConfirmEnrollment(user, input.Code)
+	tfh.sendRecoveryCodes(w, codes, err)
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes.
+// It returns a TwoFactorRecoveryCodesPayload.
+func (tfh *TwoFactorHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.TwoFactorCodeInput
+	if !decodeInput(w, r, tfh.r, &input) {
+		return
+	}
+
+	codes, err := tfh.twoFactorService.RegenerateRecoveryCodes(user, input.Code)
+	tfh.sendRecoveryCodes(w, codes, err)
+}
+
+// Disable turns 2FA off for the current user, given a valid TOTP or recovery code.
+func (tfh *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.TwoFactorCodeInput
+	if !decodeInput(w, r, tfh.r, &input) {
+		return
+	}
+
+	err := tfh.twoFactorService.Disable(user, input.Code)
+	if err == structures.ErrInvalidTwoFactorCode || err == structures.ErrTwoFactorNotEnrolled {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to disable 2FA: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (tfh *TwoFactorHandler) sendRecoveryCodes(w http.ResponseWriter, codes []string, err error) {
+	switch err {
+	case nil:
+		tfh.r.JSON(w, http.StatusOK, payloads.TwoFactorRecoveryCodesPayload{Success: true, RecoveryCodes: codes})
+	case structures.ErrInvalidTwoFactorCode, structures.ErrTwoFactorNotEnrolled, structures.ErrTwoFactorAlreadyEnabled:
+		tfh.r.JSON(w, http.StatusBadRequest, payloads.TwoFactorRecoveryCodesPayload{Error: err.Error()})
+	default:
+		fmt.Printf("Failed to generate recovery codes: %v\n", err)
+		tfh.r.JSON(w, http.StatusInternalServerError, payloads.TwoFactorRecoveryCodesPayload{Error: "Failed to generate recovery codes."})
+	}
+}
+
+func GetTwoFactorRouter(ctx context.Context, render *render.Render, tfs *services.TwoFactorService) chi.Router {
+	r := chi.NewRouter()
+
+	twoFactorHandler := TwoFactorHandler{r: render, twoFactorService: tfs}
+
+	r.Get("/", twoFactorHandler.GetStatus)
+	r.Post("/", twoFactorHandler.BeginEnrollment)
+	r.Delete("/", twoFactorHandler.Disable)
+	r.Post("/verify", twoFactorHandler.ConfirmEnrollment)
+	r.Post("/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes)
+
+	return r
+}
@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+type UsersHandler struct {
+	r              *render.Render
+	profileService *services.ProfileService
+}
+
+// GetProfile returns the public profile of another user.
+// It responds with 404 both for unknown users and for users whose visibility hides them.
+func (uh *UsersHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	viewer := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	profile, err := uh.profileService.GetPublicProfile(viewer, chi.URLParam(r, "username"))
+	if err == structures.ErrNoUser {
+		http.Error(w, "User not found.", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	uh.r.JSON(w, http.StatusOK, payloads.GetPublicProfilePayload{Profile: profile})
+}
+
+func GetUsersRouter(ctx context.Context, render *render.Render, ps *services.ProfileService) chi.Router {
+	r := chi.NewRouter()
+
+	usersHandler := UsersHandler{r: render, profileService: ps}
+
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/{username}", usersHandler.GetProfile)
+
+	return r
+}
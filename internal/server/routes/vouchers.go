@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/middleware"
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+// VouchersHandler lets customers spend their credits at partner merchants.
+type VouchersHandler struct {
+	r               *render.Render
+	merchantService *services.MerchantService
+}
+
+// GetOffers lists the active offers of every merchant.
+func (vh *VouchersHandler) GetOffers(w http.ResponseWriter, r *http.Request) {
+	offers, err := vh.merchantService.ListActiveOffers(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	vh.r.JSON(w, http.StatusOK, payloads.GetOffersPayload{Offers: offers})
+}
+
+// GetVouchers lists the current user's vouchers that can still be redeemed.
+func (vh *VouchersHandler) GetVouchers(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	vouchers, err := vh.merchantService.ListVouchers(r.Context(), user.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	vh.r.JSON(w, http.StatusOK, payloads.GetVouchersPayload{Vouchers: vouchers})
+}
+
+// IssueVoucher receives an IssueVoucherInput for an offer or an amount of credits, and returns
+// a VoucherPayload whose code the app shows as a QR code for the merchant to scan.
+func (vh *VouchersHandler) IssueVoucher(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(middleware.UserContextKey).(*structures.User)
+
+	var input inputs.IssueVoucherInput
+	if !decodeInput(w, r, vh.r, &input) {
+		return
+	}
+
+	if (input.OfferId == "") == (input.Credits == 0) {
+		vh.r.JSON(w, http.StatusUnprocessableEntity, payloads.VoucherPayload{
+			Error: "Either an offer or an amount of credits is required.",
+		})
+		return
+	}
+
+	voucher, err := vh.merchantService.IssueVoucher(r.Context(), user, input.OfferId, input.Credits)
+	if err == structures.ErrNoOffer {
+		vh.r.JSON(w, http.StatusNotFound, payloads.VoucherPayload{Error: "Offer not found."})
+		return
+	} else if err == structures.ErrInsufficientCredits {
+		vh.r.JSON(w, http.StatusPaymentRequired, payloads.VoucherPayload{Error: "Not enough credits."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to issue voucher: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	vh.r.JSON(w, http.StatusCreated, payloads.VoucherPayload{Voucher: voucher})
+}
+
+func GetOffersRouter(ctx context.Context, render *render.Render, mcs *services.MerchantService) chi.Router {
+	r := chi.NewRouter()
+
+	vouchersHandler := VouchersHandler{r: render, merchantService: mcs}
+
+	r.With(middleware.RequireScope(structures.SCOPE_READ_PROFILE)).Get("/", vouchersHandler.GetOffers)
+
+	return r
+}
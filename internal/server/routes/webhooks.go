@@ -0,0 +1,183 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/structures/inputs"
+	"unreal.sh/echo/internal/structures/payloads"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+type WebhooksHandler struct {
+	r              *render.Render
+	webhookService *services.WebhookService
+}
+
+// GetEndpoints lists every webhook endpoint, without their secrets.
+func (wh *WebhooksHandler) GetEndpoints(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := wh.webhookService.ListEndpoints(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	wh.r.JSON(w, http.StatusOK, payloads.GetWebhookEndpointsPayload{Endpoints: endpoints})
+}
+
+// CreateEndpoint receives a WebhookEndpointInput and registers the endpoint. The returned
+// WebhookEndpointPayload is the only place the endpoint's signing secret is shown.
+func (wh *WebhooksHandler) CreateEndpoint(w http.ResponseWriter, r *http.Request) {
+	var input inputs.WebhookEndpointInput
+	if !decodeInput(w, r, wh.r, &input) {
+		return
+	}
+
+	endpoint := webhookEndpointFromInput(&input)
+
+	err := wh.webhookService.CreateEndpoint(r.Context(), endpoint)
+	if err == structures.ErrInvalidWebhookEndpoint {
+		wh.r.JSON(w, http.StatusUnprocessableEntity, payloads.WebhookEndpointPayload{
+			Error: "Endpoints need an HTTP or HTTPS URL, and can only subscribe to known events.",
+		})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to create webhook endpoint: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	wh.r.JSON(w, http.StatusCreated, payloads.WebhookEndpointPayload{Endpoint: endpoint})
+}
+
+// UpdateEndpoint receives a WebhookEndpointInput and replaces the endpoint's settings.
+func (wh *WebhooksHandler) UpdateEndpoint(w http.ResponseWriter, r *http.Request) {
+	var input inputs.WebhookEndpointInput
+	if !decodeInput(w, r, wh.r, &input) {
+		return
+	}
+
+	endpoint := webhookEndpointFromInput(&input)
+	endpoint.Id = chi.URLParam(r, "id")
+
+	err := wh.webhookService.UpdateEndpoint(r.Context(), endpoint)
+	if err == structures.ErrNoWebhookEndpoint {
+		wh.r.JSON(w, http.StatusNotFound, payloads.WebhookEndpointPayload{Error: "Endpoint not found."})
+		return
+	} else if err == structures.ErrInvalidWebhookEndpoint {
+		wh.r.JSON(w, http.StatusUnprocessableEntity, payloads.WebhookEndpointPayload{
+			Error: "Endpoints need an HTTP or HTTPS URL, and can only subscribe to known events.",
+		})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to update webhook endpoint: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	wh.r.JSON(w, http.StatusOK, payloads.WebhookEndpointPayload{Endpoint: endpoint})
+}
+
+// DeleteEndpoint removes an endpoint and drops its queued deliveries.
+func (wh *WebhooksHandler) DeleteEndpoint(w http.ResponseWriter, r *http.Request) {
+	err := wh.webhookService.DeleteEndpoint(r.Context(), chi.URLParam(r, "id"))
+	if err == structures.ErrNoWebhookEndpoint {
+		wh.r.JSON(w, http.StatusNotFound, payloads.WebhookEndpointPayload{Error: "Endpoint not found."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to delete webhook endpoint: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeliveries lists the latest deliveries. The `status` query parameter (pending, delivered,
+// dead) and `endpoint` filter them, so `status=dead` shows the dead letters, and `limit` sets
+// how many are returned.
+func (wh *WebhooksHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	status := structures.WebhookDeliveryStatus(query.Get("status"))
+	switch status {
+	case "", structures.DELIVERY_PENDING, structures.DELIVERY_DELIVERED, structures.DELIVERY_DEAD:
+	default:
+		http.Error(w, "Invalid status.", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultDeliveryLimit
+	if query.Has("limit") {
+		l, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || l < 1 || l > maxDeliveryLimit {
+			http.Error(w, fmt.Sprintf("Limit must be between 1 and %d.", maxDeliveryLimit), http.StatusBadRequest)
+			return
+		}
+
+		limit = l
+	}
+
+	deliveries, err := wh.webhookService.ListDeliveries(r.Context(), status, query.Get("endpoint"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	wh.r.JSON(w, http.StatusOK, payloads.GetWebhookDeliveriesPayload{Deliveries: deliveries})
+}
+
+// Redeliver queues a delivery, typically a dead one, to be sent again right away.
+func (wh *WebhooksHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	delivery, err := wh.webhookService.Redeliver(r.Context(), chi.URLParam(r, "id"))
+	if err == structures.ErrNoWebhookDelivery {
+		wh.r.JSON(w, http.StatusNotFound, payloads.WebhookDeliveryPayload{Error: "Delivery not found."})
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to redeliver webhook: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	wh.r.JSON(w, http.StatusAccepted, payloads.WebhookDeliveryPayload{Delivery: delivery})
+}
+
+func webhookEndpointFromInput(input *inputs.WebhookEndpointInput) *structures.WebhookEndpoint {
+	events := input.Events
+	if events == nil {
+		events = []structures.WebhookEventType{}
+	}
+
+	return &structures.WebhookEndpoint{
+		Url:         input.Url,
+		Description: input.Description,
+		Events:      events,
+		Disabled:    input.Disabled,
+	}
+}
+
+func GetWebhooksRouter(ctx context.Context, render *render.Render, whs *services.WebhookService) chi.Router {
+	r := chi.NewRouter()
+
+	webhooksHandler := WebhooksHandler{r: render, webhookService: whs}
+
+	r.Get("/", webhooksHandler.GetEndpoints)
+	r.Post("/", webhooksHandler.CreateEndpoint)
+	r.Put("/{id}", webhooksHandler.UpdateEndpoint)
+	r.Delete("/{id}", webhooksHandler.DeleteEndpoint)
+	r.Get("/deliveries", webhooksHandler.GetDeliveries)
+	r.Post("/deliveries/{id}/redeliver", webhooksHandler.Redeliver)
+
+	return r
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/unrolled/render"
+
+	"unreal.sh/echo/internal/server/services"
+)
+
+type WellKnownHandler struct {
+	r                 *render.Render
+	signingKeyService *services.SigningKeyService
+}
+
+// GetJWKS returns the public keys that tokens are signed with, so partners can verify them.
+func (wh *WellKnownHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	wh.r.JSON(w, http.StatusOK, wh.signingKeyService.JWKS())
+}
+
+func GetWellKnownRouter(ctx context.Context, render *render.Render, sks *services.SigningKeyService) chi.Router {
+	r := chi.NewRouter()
+
+	wellKnownHandler := WellKnownHandler{r: render, signingKeyService: sks}
+
+	r.Get("/jwks.json", wellKnownHandler.GetJWKS)
+
+	return r
+}
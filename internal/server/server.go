@@ -3,15 +3,19 @@ package server
 import (
 	"context"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/unrolled/render"
 	"go.uber.org/zap"
 
+	"unreal.sh/echo/internal/cron"
 	"unreal.sh/echo/internal/server/middleware"
 	"unreal.sh/echo/internal/server/routes"
 	"unreal.sh/echo/internal/server/services"
+	"unreal.sh/echo/internal/utils"
 )
 
 func Start(ctx context.Context, logger *zap.SugaredLogger) {
@@ -19,12 +23,42 @@ func Start(ctx context.Context, logger *zap.SugaredLogger) {
 	dbService := services.DatabaseService{}
 	dbService.Init(ctx)
 
+	err := utils.SetTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		panic("Failed to read trusted proxies: " + err.Error())
+	}
+
 	// Initialize services.
 	hashService := services.HashService{}
-	hashService.Init(ctx)
+	err = hashService.Init(ctx)
+	if err != nil {
+		panic("Failed to initialize hash service: " + err.Error())
+	}
+
+	signingKeyService := services.SigningKeyService{}
+	err = signingKeyService.Init(ctx)
+	if err != nil {
+		panic("Failed to initialize signing key service: " + err.Error())
+	}
+
+	webhookService := services.WebhookService{}
+	err = webhookService.Init(ctx, &dbService)
+	if err != nil {
+		panic("Failed to initialize webhook service: " + err.Error())
+	}
+
+	webhookService.Start(ctx)
+
+	outboxService := services.OutboxService{}
+	err = outboxService.Init(ctx, &dbService, &webhookService)
+	if err != nil {
+		panic("Failed to initialize outbox service: " + err.Error())
+	}
+
+	outboxService.Start(ctx)
 
 	authService := services.AuthService{}
-	err := authService.Init(ctx, &dbService, &hashService)
+	err = authService.Init(ctx, &dbService, &hashService, &signingKeyService, &outboxService)
 	if err != nil {
 		panic("Failed to initialize auth service: " + err.Error())
 	}
@@ -38,6 +72,153 @@ func Start(ctx context.Context, logger *zap.SugaredLogger) {
 	stationsService := services.StationsService{}
 	stationsService.Init(ctx)
 
+	twoFactorService := services.TwoFactorService{}
+	err = twoFactorService.Init(ctx, &dbService)
+	if err != nil {
+		panic("Failed to initialize two-factor service: " + err.Error())
+	}
+
+	loginThrottleService := services.LoginThrottleService{}
+	err = loginThrottleService.Init(ctx, &dbService, logger)
+	if err != nil {
+		panic("Failed to initialize login throttle service: " + err.Error())
+	}
+
+	sessionService := services.SessionService{}
+	err = sessionService.Init(ctx, &dbService)
+	if err != nil {
+		panic("Failed to initialize session service: " + err.Error())
+	}
+
+	oidcService := services.OidcService{}
+	err = oidcService.Init(ctx, &dbService, &outboxService, &sessionService)
+	if err != nil {
+		panic("Failed to initialize OIDC service: " + err.Error())
+	}
+
+	apiTokenService := services.ApiTokenService{}
+	err = apiTokenService.Init(ctx, &dbService)
+	if err != nil {
+		panic("Failed to initialize API token service: " + err.Error())
+	}
+
+	notificationService := services.NotificationService{}
+	err = notificationService.Init(ctx, &dbService)
+	if err != nil {
+		panic("Failed to initialize notification service: " + err.Error())
+	}
+
+	dataExportService := services.DataExportService{}
+	err = dataExportService.Init(ctx, &dbService, &userService, &sessionService)
+	if err != nil {
+		panic("Failed to initialize data export service: " + err.Error())
+	}
+
+	friendService := services.FriendService{}
+	err = friendService.Init(ctx, &dbService)
+	if err != nil {
+		panic("Failed to initialize friend service: " + err.Error())
+	}
+
+	profileService := services.ProfileService{}
+	err = profileService.Init(ctx, &dbService, &userService, &friendService)
+	if err != nil {
+		panic("Failed to initialize profile service: " + err.Error())
+	}
+
+	feedService := services.FeedService{}
+	err = feedService.Init(ctx, &dbService, &friendService, &profileService)
+	if err != nil {
+		panic("Failed to initialize feed service: " + err.Error())
+	}
+
+	achievementService := services.AchievementService{}
+	err = achievementService.Init(ctx, &dbService)
+	if err != nil {
+		panic("Failed to initialize achievement service: " + err.Error())
+	}
+
+	streakService := services.StreakService{}
+	err = streakService.Init(ctx, &dbService)
+	if err != nil {
+		panic("Failed to initialize streak service: " + err.Error())
+	}
+
+	impactService := services.ImpactService{}
+	err = impactService.Init(ctx, &dbService)
+	if err != nil {
+		panic("Failed to initialize impact service: " + err.Error())
+	}
+
+	campaignService := services.CampaignService{}
+	err = campaignService.Init(ctx, &dbService)
+	if err != nil {
+		panic("Failed to initialize campaign service: " + err.Error())
+	}
+
+	teamService := services.TeamService{}
+	err = teamService.Init(ctx, &dbService, &profileService)
+	if err != nil {
+		panic("Failed to initialize team service: " + err.Error())
+	}
+
+	merchantService := services.MerchantService{}
+	err = merchantService.Init(ctx, &dbService, &notificationService)
+	if err != nil {
+		panic("Failed to initialize merchant service: " + err.Error())
+	}
+
+	referralService := services.ReferralService{}
+	err = referralService.Init(ctx, &dbService, &sessionService, &notificationService)
+	if err != nil {
+		panic("Failed to initialize referral service: " + err.Error())
+	}
+
+	accountDeletionService := services.AccountDeletionService{}
+	err = accountDeletionService.Init(ctx, &dbService, &userService, &sessionService, &apiTokenService,
+		&dataExportService, &referralService, &merchantService, &teamService, &friendService, &feedService,
+		&notificationService)
+	if err != nil {
+		panic("Failed to initialize account deletion service: " + err.Error())
+	}
+
+	leaderboardService := services.LeaderboardService{}
+	err = leaderboardService.Init(ctx, &dbService, &profileService, &teamService)
+	if err != nil {
+		panic("Failed to initialize leaderboard service: " + err.Error())
+	}
+
+	disposalService := services.DisposalService{}
+	err = disposalService.Init(ctx, &dbService, &notificationService, &outboxService)
+	if err != nil {
+		panic("Failed to initialize disposal service: " + err.Error())
+	}
+
+	schedulerService := services.SchedulerService{}
+	err = schedulerService.Init(ctx, &dbService)
+	if err != nil {
+		panic("Failed to initialize scheduler service: " + err.Error())
+	}
+
+	jobs := []services.Job{
+		{Name: "expire-stations", Schedule: cron.Every(time.Minute), Local: true, Run: stationsService.RemoveExpired},
+		{Name: "refresh-leaderboards", Schedule: cron.Every(leaderboardService.RefreshInterval()),
+			Run: leaderboardService.Refresh},
+		{Name: "delete-accounts", Schedule: cron.MustParse("@hourly"), Run: accountDeletionService.ProcessDue},
+		{Name: "purge-api-tokens", Schedule: cron.MustParse("0 4 * * *"), Run: apiTokenService.PurgeExpired},
+		{Name: "reconcile-balances", Schedule: cron.MustParse("30 4 * * *"), Run: dbService.ReconcileBalances},
+		{Name: "expire-claim-tokens", Schedule: cron.MustParse("@hourly"), Run: disposalService.ExpireUnclaimed},
+	}
+
+	for _, job := range jobs {
+		err = schedulerService.Register(ctx, job)
+		if err != nil {
+			panic("Failed to register " + job.Name + " job: " + err.Error())
+		}
+	}
+
+	schedulerService.Start(ctx)
+
 	r := chi.NewRouter()
 	render := render.Render{}
 
@@ -47,14 +228,29 @@ func Start(ctx context.Context, logger *zap.SugaredLogger) {
 
 	r.Group(func(r chi.Router) {
 		r.Use(chiMiddleware.Logger)
-		r.Use(middleware.ValidateToken(&authService))
-		r.Use(middleware.RequireAuthentication(&authService))
+		r.Use(middleware.ValidateToken(&authService, &apiTokenService))
+		r.Use(middleware.RequireAuthentication(&authService, &sessionService))
 
-		r.Mount("/me", routes.GetMeRouter(ctx, &render, &userService, &dbService))
-		r.Mount("/stations", routes.GetStationsRouter(ctx, &render, &stationsService))
+		r.Mount("/me", routes.GetMeRouter(ctx, &render, &userService, &dbService, &authService,
+			&twoFactorService, &sessionService, &apiTokenService, &accountDeletionService, &dataExportService,
+			&profileService, &stationsService, &achievementService, &streakService,
+			&impactService, &campaignService, &referralService, &merchantService, &friendService, &feedService,
+			&outboxService, &notificationService, &disposalService))
+		r.Mount("/users", routes.GetUsersRouter(ctx, &render, &profileService))
+		r.Mount("/teams", routes.GetTeamsRouter(ctx, &render, &teamService))
+		r.Mount("/leaderboards", routes.GetLeaderboardsRouter(ctx, &render, &leaderboardService))
+		r.Mount("/achievements", routes.GetAchievementsRouter(ctx, &render, &achievementService))
+		r.Mount("/stations", routes.GetStationsRouter(ctx, &render, &stationsService, &twoFactorService))
+		r.Mount("/offers", routes.GetOffersRouter(ctx, &render, &merchantService))
+		r.Mount("/merchant", routes.GetMerchantRouter(ctx, &render, &merchantService, &dbService,
+			&twoFactorService, &outboxService))
+		r.Mount("/admin", routes.GetAdminRouter(ctx, &render, &dbService, &twoFactorService, &campaignService,
+			&merchantService, &teamService, &webhookService, &schedulerService))
 	})
 
-	r.Mount("/auth", routes.GetAuthRouter(ctx, &render, &authService))
+	r.Mount("/.well-known", routes.GetWellKnownRouter(ctx, &render, &signingKeyService))
+	r.Mount("/auth", routes.GetAuthRouter(ctx, &render, &authService, &twoFactorService, &loginThrottleService,
+		&oidcService, &sessionService, &referralService))
 
 	http.ListenAndServe(":4000", r)
 
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
+)
+
+// deletionLease is how long an account being anonymized is claimed for, before another
+// attempt is made if it wasn't finished.
+const deletionLease = 1 * time.Hour
+
+// AccountDeletionService deletes accounts on request, after a grace period during which
+// the user can change their mind.
+//
+// Deleting an account anonymizes it rather than removing it: personal data is erased,
+// and the ledger and disposals are moved to a new pseudonymous ID, so platform-wide
+// statistics stay correct without being traceable to the person.
+type AccountDeletionService struct {
+	gracePeriod time.Duration
+
+	dbService       *DatabaseService
+	userService     *UserService
+	sessionService  *SessionService
+	apiTokenService *ApiTokenService
+
+	dataExportService *DataExportService
+	referralService   *ReferralService
+	merchantService   *MerchantService
+	teamService       *TeamService
+	friendService     *FriendService
+	feedService       *FeedService
+
+	notificationService *NotificationService
+}
+
+// Init reads the grace period, in days, from ACCOUNT_DELETION_GRACE_DAYS, defaulting to 14.
+func (ads *AccountDeletionService) Init(ctx context.Context, dbService *DatabaseService, userService *UserService,
+	sessionService *SessionService, apiTokenService *ApiTokenService, dataExportService *DataExportService,
+	referralService *ReferralService, merchantService *MerchantService, teamService *TeamService,
+	friendService *FriendService, feedService *FeedService, notificationService *NotificationService) error {
+	days, err := strconv.Atoi(utils.GetenvOr("ACCOUNT_DELETION_GRACE_DAYS", "14"))
+	if err != nil || days < 0 {
+		return errors.New("invalid ACCOUNT_DELETION_GRACE_DAYS environment variable")
+	}
+
+	ads.gracePeriod = time.Duration(days) * 24 * time.Hour
+
+	ads.dbService = dbService
+	ads.userService = userService
+	ads.sessionService = sessionService
+	ads.apiTokenService = apiTokenService
+	ads.dataExportService = dataExportService
+	ads.referralService = referralService
+	ads.merchantService = merchantService
+	ads.teamService = teamService
+	ads.friendService = friendService
+	ads.feedService = feedService
+	ads.notificationService = notificationService
+
+	return nil
+}
+
+// Schedule marks the user's account for deletion once the grace period is over,
+// and returns when that will happen.
+func (ads *AccountDeletionService) Schedule(user *structures.User) (int64, error) {
+	if user.DeletionScheduledAt != 0 {
+		return 0, structures.ErrDeletionAlreadyScheduled
+	}
+
+	scheduledAt := time.Now().Add(ads.gracePeriod).Unix()
+
+	err := ads.dbService.UpdateUserById(user.Id, bson.M{"$set": bson.M{"deletion_scheduled_at": scheduledAt}})
+	if err != nil {
+		return 0, err
+	}
+
+	fmt.Printf("Scheduled deletion of user %v.\n", user.Id)
+
+	return scheduledAt, nil
+}
+
+// Cancel unschedules the deletion of the user's account. It returns ErrDeletionInProgress
+// once anonymizing the account has begun.
+func (ads *AccountDeletionService) Cancel(user *structures.User) error {
+	if user.DeletionScheduledAt == 0 {
+		return structures.ErrDeletionNotScheduled
+	}
+
+	objectId, err := primitive.ObjectIDFromHex(user.Id)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	res, err := ads.dbService.collection(UserCollectionName).UpdateOne(context.Background(),
+		bson.M{"_id": objectId, "deletion_scheduled_at": bson.M{"$exists": true}, "deletion_started": bson.M{"$ne": true}},
+		bson.M{"$unset": bson.M{"deletion_scheduled_at": ""}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return structures.ErrDeletionInProgress
+	}
+
+	fmt.Printf("Cancelled deletion of user %v.\n", user.Id)
+
+	return nil
+}
+
+// ProcessDue anonymizes every account whose grace period is over. It returns an error if any
+// of them couldn't be anonymized, after trying the others.
+func (ads *AccountDeletionService) ProcessDue(ctx context.Context) error {
+	users := ads.dbService.collection(UserCollectionName)
+	failed := 0
+
+	for {
+		// Claim one account at a time by pushing its schedule back, so replicas running this
+		// concurrently don't collide, and a crash midway is retried once the lease runs out.
+		// The pseudonym is only picked once, so retries don't leave duplicate records behind.
+		now := time.Now()
+
+		var user structures.User
+		err := users.FindOneAndUpdate(ctx,
+			bson.M{"deletion_scheduled_at": bson.M{"$gt": 0, "$lte": now.Unix()}},
+			bson.A{bson.M{"$set": bson.M{
+				"deletion_scheduled_at": now.Add(deletionLease).Unix(),
+				"deletion_pseudonym":    bson.M{"$ifNull": bson.A{"$deletion_pseudonym", primitive.NewObjectID().Hex()}},
+			}}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&user)
+
+		if err == mongo.ErrNoDocuments {
+			break
+		} else if err != nil {
+			fmt.Printf("Failed to find accounts due for deletion: %v\n", err)
+			return err
+		}
+
+		err = ads.anonymize(ctx, &user)
+		if err != nil {
+			fmt.Printf("Failed to anonymize user %v: %v\n", user.Id, err)
+			failed++
+			continue
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to anonymize %d accounts", failed)
+	}
+
+	return nil
+}
+
+// anonymize replaces the user with a pseudonymous record holding only their ledger,
+// and moves their disposals over to it.
+func (ads *AccountDeletionService) anonymize(ctx context.Context, user *structures.User) error {
+	pseudonymId := user.DeletionPseudonym
+
+	pseudonym, err := primitive.ObjectIDFromHex(pseudonymId)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	objectId, err := primitive.ObjectIDFromHex(user.Id)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	// The user may have cancelled since the account was claimed. Marking the deletion as started
+	// only while it is still scheduled, as claimed, keeps Cancel from succeeding past this point.
+	res, err := ads.dbService.collection(UserCollectionName).UpdateOne(ctx,
+		bson.M{"_id": objectId, "deletion_scheduled_at": user.DeletionScheduledAt},
+		bson.M{"$set": bson.M{"deletion_started": true}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		fmt.Printf("Deletion of user %v was cancelled, keeping the account.\n", user.Id)
+		return nil
+	}
+
+	transactions := utils.Map(user.Transactions, func(t structures.Transaction, i int) structures.Transaction {
+		t.UserId = pseudonymId
+		return t
+	})
+
+	anonymized := bson.M{
+		"_id":          pseudonym,
+		"name":         "Deleted user",
+		"username":     "deleted-" + pseudonymId,
+		"credits":      user.Credits,
+		"is_operator":  false,
+		"is_admin":     false,
+		"transactions": transactions,
+		"is_deleted":   true,
+	}
+
+	// Write the pseudonymous record before anything is removed, so a failure leaves the account intact.
+	_, err = ads.dbService.collection(UserCollectionName).ReplaceOne(ctx, bson.M{"_id": pseudonym}, anonymized,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	disposals := ads.dbService.collection(DisposalCollectionName)
+
+	_, err = disposals.UpdateMany(ctx, bson.M{"user_id": user.Id}, bson.M{"$set": bson.M{"user_id": pseudonymId}})
+	if err != nil {
+		return err
+	}
+
+	_, err = disposals.UpdateMany(ctx, bson.M{"operator_id": user.Id}, bson.M{"$set": bson.M{"operator_id": pseudonymId}})
+	if err != nil {
+		return err
+	}
+
+	err = ads.teamService.Leave(ctx, user)
+	if err != nil && err != structures.ErrNotInTeam {
+		return err
+	}
+
+	err = ads.merchantService.AnonymizeUser(ctx, user.Id, pseudonymId)
+	if err != nil {
+		return err
+	}
+
+	err = ads.userService.DeleteAvatar(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	err = ads.dataExportService.DeleteAllByUser(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	err = ads.referralService.DeleteAllByUser(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	err = ads.friendService.DeleteAllByUser(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	err = ads.feedService.DeleteAllByUser(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	err = ads.notificationService.DeleteAllByUser(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	err = ads.sessionService.RevokeAllByUser(user.Id)
+	if err != nil {
+		return err
+	}
+
+	err = ads.apiTokenService.RevokeAllByUser(user.Id)
+	if err != nil {
+		return err
+	}
+
+	_, err = ads.dbService.collection(UserCollectionName).DeleteOne(ctx, bson.M{"_id": objectId})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Anonymized user %v as %v.\n", user.Id, pseudonymId)
+
+	return nil
+}
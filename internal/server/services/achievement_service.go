@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/config"
+	"unreal.sh/echo/internal/structures"
+)
+
+const AchievementCollectionName = "achievements"
+
+// AchievementService awards badges for what users recycle. Achievements are loaded once,
+// from the JSON file at ACHIEVEMENTS_FILE if set, and from the achievements collection otherwise.
+// If the collection is empty too, the default achievements are used.
+type AchievementService struct {
+	achievements []structures.Achievement
+
+	dbService *DatabaseService
+}
+
+func (achs *AchievementService) Init(ctx context.Context, dbService *DatabaseService) error {
+	achs.dbService = dbService
+	achs.achievements = []structures.Achievement{}
+
+	if path := os.Getenv("ACHIEVEMENTS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal(data, &achs.achievements)
+		if err != nil {
+			return fmt.Errorf("invalid achievements file: %w", err)
+		}
+	} else {
+		cursor, err := dbService.collection(AchievementCollectionName).Find(ctx, bson.M{})
+		if err != nil {
+			return err
+		}
+
+		err = cursor.All(ctx, &achs.achievements)
+		if err != nil {
+			return err
+		}
+
+		if len(achs.achievements) == 0 {
+			err = json.Unmarshal(config.Achievements, &achs.achievements)
+			if err != nil {
+				return fmt.Errorf("invalid default achievements: %w", err)
+			}
+		}
+	}
+
+	for _, achievement := range achs.achievements {
+		switch achievement.Rule.Type {
+		case structures.RULE_CLAIM_COUNT, structures.RULE_TOTAL_WEIGHT,
+			structures.RULE_CONSECUTIVE_DAYS, structures.RULE_DISTINCT_STATIONS:
+		default:
+			return fmt.Errorf("achievement %s has unknown rule type %q", achievement.Id, achievement.Rule.Type)
+		}
+	}
+
+	fmt.Printf("Loaded %d achievements.\n", len(achs.achievements))
+
+	return nil
+}
+
+// List returns every achievement that can be earned.
+func (achs *AchievementService) List() []structures.Achievement {
+	return achs.achievements
+}
+
+// Evaluate checks the user's claims against every achievement they haven't earned yet,
+// records the ones they now meet on the user, and returns them.
+func (achs *AchievementService) Evaluate(ctx context.Context, user *structures.User) ([]structures.Achievement, error) {
+	pending := make([]structures.Achievement, 0)
+	for _, achievement := range achs.achievements {
+		if !slices.Contains(user.Badges, achievement.Id) {
+			pending = append(pending, achievement)
+		}
+	}
+
+	if len(pending) == 0 {
+		return []structures.Achievement{}, nil
+	}
+
+	cursor, err := achs.dbService.collection(DisposalCollectionName).Find(ctx,
+		bson.M{"user_id": user.Id, "is_claimed": true},
+		options.Find().SetProjection(bson.M{"disposals": 1, "station_id": 1, "claimed_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var claims []structures.DisposalClaim
+	err = cursor.All(ctx, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	earned := make([]structures.Achievement, 0)
+	for _, achievement := range pending {
+		if measureRule(achievement.Rule, claims) >= achievement.Rule.Threshold {
+			earned = append(earned, achievement)
+		}
+	}
+
+	if len(earned) == 0 {
+		return earned, nil
+	}
+
+	ids := make([]string, len(earned))
+	for i, achievement := range earned {
+		ids[i] = achievement.Id
+	}
+
+	err = achs.dbService.UpdateUserById(user.Id, bson.M{"$addToSet": bson.M{"badges": bson.M{"$each": ids}}})
+	if err != nil {
+		return nil, err
+	}
+
+	user.Badges = append(user.Badges, ids...)
+
+	fmt.Printf("User %v earned %v.\n", user.Id, ids)
+
+	return earned, nil
+}
+
+// measureRule returns the value a rule's threshold is compared against, given all of a user's claims.
+func measureRule(rule structures.AchievementRule, claims []structures.DisposalClaim) float64 {
+	switch rule.Type {
+	case structures.RULE_CLAIM_COUNT:
+		count := 0
+		for _, claim := range claims {
+			if matchesDisposalType(rule, claim) {
+				count++
+			}
+		}
+		return float64(count)
+
+	case structures.RULE_TOTAL_WEIGHT:
+		var weight float64
+		for _, claim := range claims {
+			for _, disposal := range claim.Disposals {
+				if rule.DisposalType == nil || disposal.DisposalType == *rule.DisposalType {
+					weight += float64(disposal.Weight)
+				}
+			}
+		}
+		return weight
+
+	case structures.RULE_CONSECUTIVE_DAYS:
+		days := make([]int64, 0, len(claims))
+		for _, claim := range claims {
+			if claim.ClaimedAt != 0 && matchesDisposalType(rule, claim) {
+				days = append(days, claim.ClaimedAt/int64((24*time.Hour).Seconds()))
+			}
+		}
+		return float64(longestRun(days))
+
+	case structures.RULE_DISTINCT_STATIONS:
+		stations := make(map[string]bool)
+		for _, claim := range claims {
+			if claim.StationId != "" && matchesDisposalType(rule, claim) {
+				stations[claim.StationId] = true
+			}
+		}
+		return float64(len(stations))
+	}
+
+	return 0
+}
+
+// matchesDisposalType reports whether a claim counts towards a rule, that is,
+// whether it contains the rule's disposal type, if it has one.
+func matchesDisposalType(rule structures.AchievementRule, claim structures.DisposalClaim) bool {
+	if rule.DisposalType == nil {
+		return true
+	}
+
+	return slices.ContainsFunc(claim.Disposals, func(d structures.Disposal) bool {
+		return d.DisposalType == *rule.DisposalType
+	})
+}
+
+// longestRun returns the length of the longest sequence of consecutive numbers, ignoring duplicates.
+func longestRun(days []int64) int {
+	slices.Sort(days)
+	days = slices.Compact(days)
+
+	longest, current := 0, 0
+	for i, day := range days {
+		if i > 0 && day == days[i-1]+1 {
+			current++
+		} else {
+			current = 1
+		}
+		longest = max(longest, current)
+	}
+
+	return longest
+}
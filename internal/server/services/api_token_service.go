@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+const ApiTokenCollectionName = "api_tokens"
+
+// apiTokenTouchInterval throttles how often a token's last used time is written.
+const apiTokenTouchInterval = 5 * time.Minute
+
+type ApiTokenService struct {
+	dbService *DatabaseService
+}
+
+func (ats *ApiTokenService) Init(ctx context.Context, dbService *DatabaseService) error {
+	ats.dbService = dbService
+
+	_, err := dbService.collection(ApiTokenCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create api token indexes: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Create issues a new personal access token for the user.
+// It returns the token itself, which isn't stored and can't be retrieved again.
+func (ats *ApiTokenService) Create(userId string, name string, scopes []structures.Scope, expiresIn time.Duration) (string, *structures.ApiToken, error) {
+	token := structures.ApiTokenPrefix + randomUrlString(32)
+	now := time.Now()
+
+	apiToken := structures.ApiToken{
+		UserId:    userId,
+		Name:      name,
+		Hint:      token[len(token)-4:],
+		Hash:      hashApiToken(token),
+		Scopes:    scopes,
+		CreatedAt: now.Unix(),
+	}
+
+	if expiresIn > 0 {
+		apiToken.ExpiresAt = now.Add(expiresIn).Unix()
+	}
+
+	res, err := ats.dbService.collection(ApiTokenCollectionName).InsertOne(context.Background(), apiToken)
+	if err != nil {
+		fmt.Printf("Failed to create api token for user %v: %v\n", userId, err)
+		return "", nil, err
+	}
+
+	apiToken.Id = res.InsertedID.(primitive.ObjectID).Hex()
+
+	fmt.Printf("Created api token %v for user %v.\n", apiToken.Id, userId)
+
+	return token, &apiToken, nil
+}
+
+// Authenticate returns the token record and its owner for a personal access token.
+// It returns ErrNoApiToken if the token is unknown, revoked or expired.
+func (ats *ApiTokenService) Authenticate(token string) (*structures.ApiToken, *structures.User, error) {
+	var apiToken structures.ApiToken
+
+	err := ats.dbService.collection(ApiTokenCollectionName).FindOne(context.Background(),
+		bson.M{"hash": hashApiToken(token)}).Decode(&apiToken)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, structures.ErrNoApiToken
+	} else if err != nil {
+		fmt.Printf("Failed to get api token: %v\n", err)
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if apiToken.ExpiresAt != 0 && now.Unix() >= apiToken.ExpiresAt {
+		return nil, nil, structures.ErrNoApiToken
+	}
+
+	user, err := ats.dbService.GetUserById(apiToken.UserId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if now.Sub(time.Unix(apiToken.LastUsedAt, 0)) >= apiTokenTouchInterval {
+		objectId, _ := primitive.ObjectIDFromHex(apiToken.Id)
+		_, err = ats.dbService.collection(ApiTokenCollectionName).UpdateOne(context.Background(),
+			bson.M{"_id": objectId}, bson.M{"$set": bson.M{"last_used_at": now.Unix()}})
+		if err != nil {
+			fmt.Printf("Failed to touch api token %v: %v\n", apiToken.Id, err)
+		}
+	}
+
+	return &apiToken, user, nil
+}
+
+// ListByUser returns every personal access token of the user, newest first.
+func (ats *ApiTokenService) ListByUser(userId string) ([]structures.ApiToken, error) {
+	result := []structures.ApiToken{}
+
+	cur, err := ats.dbService.collection(ApiTokenCollectionName).Find(context.Background(),
+		bson.M{"user_id": userId}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		fmt.Printf("Failed to get api tokens for user %v: %v\n", userId, err)
+		return nil, err
+	}
+
+	err = cur.All(context.Background(), &result)
+	if err != nil {
+		fmt.Printf("Failed to get api tokens for user %v: %v\n", userId, err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Revoke deletes one of the user's personal access tokens.
+func (ats *ApiTokenService) Revoke(userId string, tokenId string) error {
+	objectId, err := primitive.ObjectIDFromHex(tokenId)
+	if err != nil {
+		return structures.ErrNoApiToken
+	}
+
+	res, err := ats.dbService.collection(ApiTokenCollectionName).DeleteOne(context.Background(),
+		bson.M{"_id": objectId, "user_id": userId})
+	if err != nil {
+		fmt.Printf("Failed to revoke api token %v: %v\n", tokenId, err)
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return structures.ErrNoApiToken
+	}
+
+	fmt.Printf("Revoked api token %v of user %v.\n", tokenId, userId)
+
+	return nil
+}
+
+// RevokeAllByUser deletes every personal access token of the user.
+func (ats *ApiTokenService) RevokeAllByUser(userId string) error {
+	_, err := ats.dbService.collection(ApiTokenCollectionName).DeleteMany(context.Background(), bson.M{"user_id": userId})
+	if err != nil {
+		fmt.Printf("Failed to revoke api tokens of user %v: %v\n", userId, err)
+		return err
+	}
+
+	return nil
+}
+
+// PurgeExpired deletes the tokens that expired. Authenticate already rejects them, so this only
+// keeps them from piling up.
+func (ats *ApiTokenService) PurgeExpired(ctx context.Context) error {
+	res, err := ats.dbService.collection(ApiTokenCollectionName).DeleteMany(ctx,
+		bson.M{"expires_at": bson.M{"$gt": 0, "$lte": time.Now().Unix()}})
+	if err != nil {
+		fmt.Printf("Failed to purge expired api tokens: %v\n", err)
+		return err
+	}
+
+	if res.DeletedCount > 0 {
+		fmt.Printf("Purged %d expired api tokens.\n", res.DeletedCount)
+	}
+
+	return nil
+}
+
+// hashApiToken hashes a personal access token for storage.
+// Tokens are random, so a fast hash is enough to protect them at rest.
+func hashApiToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
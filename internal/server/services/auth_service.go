@@ -2,31 +2,36 @@ package services
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"os"
+	"time"
 
 	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+
 	"unreal.sh/echo/internal/structures"
 )
 
-type AuthService struct {
-	secretKey *string
+const (
+	// accessTokenLifetime is how long an access token is valid before it has to be refreshed.
+	accessTokenLifetime = 1 * time.Hour
 
-	dbService   *DatabaseService
-	hashService *HashService
-}
-
-func (as *AuthService) Init(ctx context.Context, dbService *DatabaseService, hashService *HashService) error {
-	secret, found := os.LookupEnv("JWT_SECURITY_KEY")
-	if !found {
-		return errors.New("missing JWT_SECURITY_KEY environment variable")
-	}
+	// mfaTokenLifetime is how long a user has to enter their 2FA code after their password.
+	mfaTokenLifetime = 5 * time.Minute
+)
 
-	as.secretKey = &secret
+type AuthService struct {
+	dbService         *DatabaseService
+	hashService       *HashService
+	signingKeyService *SigningKeyService
+	outboxService     *OutboxService
+}
 
+func (as *AuthService) Init(ctx context.Context, dbService *DatabaseService, hashService *HashService,
+	signingKeyService *SigningKeyService, outboxService *OutboxService) error {
 	as.dbService = dbService
 	as.hashService = hashService
+	as.signingKeyService = signingKeyService
+	as.outboxService = outboxService
 
 	return nil
 }
@@ -52,15 +57,63 @@ func (as *AuthService) Authenticate(username string, password string) (*structur
 		return nil, structures.ErrInvalidCredentials
 	}
 
+	as.upgradePasswordHash(user, password)
+
 	return user, nil
 }
 
+// VerifyPassword checks the password of an already authenticated user, to confirm sensitive actions.
+// Users who only sign in through an external identity provider have no password, so it always
+// fails for them; they have to confirm some other way.
+func (as *AuthService) VerifyPassword(user *structures.User, password string) error {
+	if !user.HasPassword() {
+		return structures.ErrInvalidCredentials
+	}
+
+	match, err := as.hashService.ComparePasswordAndHash(user.PasswordHash, password)
+	if err != nil {
+		return err
+	}
+
+	if !match {
+		return structures.ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// upgradePasswordHash re-hashes the password of a freshly authenticated user if their
+// stored hash was created with weaker parameters than the current ones.
+// Failures are logged and otherwise ignored, as the login itself already succeeded.
+func (as *AuthService) upgradePasswordHash(user *structures.User, password string) {
+	needsRehash, err := as.hashService.NeedsRehash(user.PasswordHash)
+	if err != nil || !needsRehash {
+		return
+	}
+
+	hash, err := as.hashService.HashPassword(password)
+	if err != nil {
+		fmt.Printf("Failed to rehash password for user %s: %v\n", user.Username, err)
+		return
+	}
+
+	err = as.dbService.UpdateUserById(user.Id, bson.M{"$set": bson.M{"password_hash": hash}})
+	if err != nil {
+		fmt.Printf("Failed to store rehashed password for user %s: %v\n", user.Username, err)
+		return
+	}
+
+	user.PasswordHash = hash
+
+	fmt.Printf("Upgraded password hash parameters for user %s.\n", user.Username)
+}
+
 // CreateAccount creates a new account with the given name, username, and password.
-// It returns nil on success, and an error on failure.
+// It returns the created user on success, and ErrUserAlreadyExists if the username is taken.
 func (as *AuthService) CreateAccount(name string, username string, password string) (structures.User, error) {
-	_, err := as.dbService.GetUserByUsername(username)
-	if err == nil {
-		return structures.User{}, structures.ErrUserAlreadyExists
+	// The limit is in bytes, like the maxbytes rule on CreateAccountInput, since that is what gets hashed.
+	if len(password) == 0 || len(password) > 72 {
+		return structures.User{}, structures.ErrInvalidPasswordLength
 	}
 
 	hash, err := as.hashService.HashPassword(password)
@@ -79,7 +132,19 @@ func (as *AuthService) CreateAccount(name string, username string, password stri
 		IsOperator:   false,
 	}
 
-	err = as.dbService.CreateUser(user)
+	// The unique index on usernames rejects duplicates, even between concurrent signups.
+	// Subscribers only hear about the signup if the user is created.
+	err = as.dbService.WithTransaction(context.Background(), func(ctx context.Context) error {
+		user.Id = ""
+
+		err := as.dbService.CreateUser(ctx, &user)
+		if err != nil {
+			return err
+		}
+
+		return as.outboxService.Add(ctx, structures.WEBHOOK_USER_CREATED,
+			map[string]string{"user_id": user.Id, "provider": "password"})
+	})
 	if err != nil {
 		return structures.User{}, err
 	}
@@ -87,30 +152,73 @@ func (as *AuthService) CreateAccount(name string, username string, password stri
 	return user, nil
 }
 
-func (as *AuthService) GenerateToken(u *structures.User) (string, error) {
-	claims := structures.UserClaims{
-		UserId:         u.Id,
-		StandardClaims: jwt.StandardClaims{},
+// GenerateTokenPair issues an access token and a refresh token for the given session.
+// Access tokens are short-lived; the refresh token is exchanged for new ones at POST /auth/refresh.
+func (as *AuthService) GenerateTokenPair(u *structures.User, sessionId string) (string, string, error) {
+	now := time.Now()
+
+	accessToken, err := as.signingKeyService.Sign(structures.UserClaims{
+		UserId:    u.Id,
+		SessionId: sessionId,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(accessTokenLifetime).Unix(),
+		},
+	})
+	if err != nil {
+		return "", "", err
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	refreshToken, err := as.signingKeyService.Sign(structures.UserClaims{
+		UserId:    u.Id,
+		SessionId: sessionId,
+		Refresh:   true,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(SessionLifetime).Unix(),
+		},
+	})
+	if err != nil {
+		return "", "", err
+	}
 
-	return accessToken.SignedString([]byte(*as.secretKey))
+	return accessToken, refreshToken, nil
 }
 
-func (as *AuthService) GenerateRefreshToken(claims jwt.StandardClaims) (string, error) {
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// GenerateMfaToken issues a short-lived token for a user who entered a correct password
+// but still has to provide a 2FA code. It is rejected everywhere but at POST /auth/2fa.
+func (as *AuthService) GenerateMfaToken(u *structures.User) (string, error) {
+	claims := structures.UserClaims{
+		UserId:     u.Id,
+		MfaPending: true,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(mfaTokenLifetime).Unix(),
+		},
+	}
 
-	return refreshToken.SignedString([]byte(*as.secretKey))
+	return as.signingKeyService.Sign(claims)
+}
+
+// ParseMfaToken returns the user a token issued by GenerateMfaToken belongs to.
+func (as *AuthService) ParseMfaToken(mfaToken string) (*structures.User, error) {
+	parsedMfaToken, err := jwt.ParseWithClaims(mfaToken, &structures.UserClaims{}, as.signingKeyService.Keyfunc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	userClaims := parsedMfaToken.Claims.(*structures.UserClaims)
+	if !parsedMfaToken.Valid || !userClaims.MfaPending {
+		return nil, structures.ErrInvalidToken
+	}
+
+	return as.dbService.GetUserById(userClaims.UserId)
 }
 
 func (as *AuthService) ParseAccessToken(accessToken string) (*structures.User, *structures.UserClaims, error) {
 	fmt.Println("ParseAccessToken reached.")
 
-	parsedAccessToken, err := jwt.ParseWithClaims(accessToken, &structures.UserClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(*as.secretKey), nil
-		})
+	parsedAccessToken, err := jwt.ParseWithClaims(accessToken, &structures.UserClaims{}, as.signingKeyService.Keyfunc)
 
 	if err != nil {
 		return nil, nil, err
@@ -121,6 +229,10 @@ func (as *AuthService) ParseAccessToken(accessToken string) (*structures.User, *
 	}
 
 	userClaims := parsedAccessToken.Claims.(*structures.UserClaims)
+	if userClaims.MfaPending || userClaims.Refresh || userClaims.SessionId == "" {
+		return nil, nil, structures.ErrInvalidToken
+	}
+
 	id := userClaims.UserId
 
 	fmt.Printf("User ID: %s\n", id)
@@ -133,22 +245,28 @@ func (as *AuthService) ParseAccessToken(accessToken string) (*structures.User, *
 	return user, userClaims, nil
 }
 
-func (as *AuthService) ParseRefreshToken(refreshToken string) *jwt.StandardClaims {
-	parsedRefreshToken, _ := jwt.ParseWithClaims(refreshToken, &jwt.StandardClaims{},
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(*as.secretKey), nil
-		})
+// ParseRefreshToken returns the user and claims of a token issued as the refresh half of GenerateTokenPair.
+func (as *AuthService) ParseRefreshToken(refreshToken string) (*structures.User, *structures.UserClaims, error) {
+	parsedRefreshToken, err := jwt.ParseWithClaims(refreshToken, &structures.UserClaims{}, as.signingKeyService.Keyfunc)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return parsedRefreshToken.Claims.(*jwt.StandardClaims)
+	userClaims := parsedRefreshToken.Claims.(*structures.UserClaims)
+	if !parsedRefreshToken.Valid || !userClaims.Refresh || userClaims.SessionId == "" {
+		return nil, nil, structures.ErrInvalidToken
+	}
+
+	user, err := as.dbService.GetUserById(userClaims.UserId)
+	if err != nil {
+		return nil, nil, structures.ErrNoUser
+	}
+
+	return user, userClaims, nil
 }
 
 func (as *AuthService) IsAuthorized(token string) (bool, error) {
-	_, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, structures.ErrInvalidToken
-		}
-		return []byte(*as.secretKey), nil
-	})
+	_, err := jwt.Parse(token, as.signingKeyService.Keyfunc)
 
 	if err != nil {
 		return false, err
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+const CampaignCollectionName = "campaigns"
+
+// CampaignAwardCollectionName holds how many bonus credits each user got from each campaign,
+// to enforce the per-user caps.
+const CampaignAwardCollectionName = "campaign_awards"
+
+type CampaignService struct {
+	dbService *DatabaseService
+}
+
+func (cs *CampaignService) Init(ctx context.Context, dbService *DatabaseService) error {
+	cs.dbService = dbService
+
+	_, err := dbService.collection(CampaignCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "ends_at", Value: 1}, {Key: "starts_at", Value: 1}},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create campaign indexes: %v\n", err)
+		return err
+	}
+
+	_, err = dbService.collection(CampaignAwardCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		fmt.Printf("Failed to create campaign award indexes: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// List returns every campaign, latest first.
+func (cs *CampaignService) List(ctx context.Context) ([]structures.Campaign, error) {
+	cursor, err := cs.dbService.collection(CampaignCollectionName).Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "starts_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	campaigns := []structures.Campaign{}
+	err = cursor.All(ctx, &campaigns)
+
+	return campaigns, err
+}
+
+// Get returns the campaign with the given ID, or ErrNoCampaign.
+func (cs *CampaignService) Get(ctx context.Context, id string) (*structures.Campaign, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, structures.ErrNoCampaign
+	}
+
+	var campaign structures.Campaign
+	err = cs.dbService.collection(CampaignCollectionName).FindOne(ctx, bson.M{"_id": objectId}).Decode(&campaign)
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrNoCampaign
+	}
+
+	return &campaign, err
+}
+
+// Create adds a campaign. It returns ErrInvalidCampaign if it ends before it starts or grants nothing.
+func (cs *CampaignService) Create(ctx context.Context, campaign *structures.Campaign) error {
+	if !isValidCampaign(campaign) {
+		return structures.ErrInvalidCampaign
+	}
+
+	campaign.Id = ""
+	campaign.CreatedAt = time.Now().Unix()
+
+	res, err := cs.dbService.collection(CampaignCollectionName).InsertOne(ctx, campaign)
+	if err != nil {
+		return err
+	}
+
+	campaign.Id = res.InsertedID.(primitive.ObjectID).Hex()
+
+	fmt.Printf("Created campaign %v.\n", campaign.Id)
+
+	return nil
+}
+
+// Update replaces the campaign with the given ID. Bonuses already granted are kept.
+func (cs *CampaignService) Update(ctx context.Context, id string, campaign *structures.Campaign) error {
+	if !isValidCampaign(campaign) {
+		return structures.ErrInvalidCampaign
+	}
+
+	existing, err := cs.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	objectId, _ := primitive.ObjectIDFromHex(id)
+
+	campaign.Id = ""
+	campaign.CreatedAt = existing.CreatedAt
+
+	res, err := cs.dbService.collection(CampaignCollectionName).ReplaceOne(ctx, bson.M{"_id": objectId}, campaign)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return structures.ErrNoCampaign
+	}
+
+	campaign.Id = id
+
+	return nil
+}
+
+// Delete removes the campaign with the given ID. Bonuses already granted are kept.
+func (cs *CampaignService) Delete(ctx context.Context, id string) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return structures.ErrNoCampaign
+	}
+
+	res, err := cs.dbService.collection(CampaignCollectionName).DeleteOne(ctx, bson.M{"_id": objectId})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return structures.ErrNoCampaign
+	}
+
+	_, err = cs.dbService.collection(CampaignAwardCollectionName).DeleteMany(ctx, bson.M{"campaign_id": id})
+
+	return err
+}
+
+// Apply grants the user the bonus of every campaign running at claimedAt that the claim is eligible for,
+// each as its own transaction on the ledger. It returns the transactions added.
+// It is meant to run in the claim's database transaction, so that bonuses count against the caps
+// only if they are granted along with the claim.
+func (cs *CampaignService) Apply(ctx context.Context, user *structures.User, claim *structures.DisposalClaim,
+	claimedAt int64) ([]structures.Transaction, error) {
+	cursor, err := cs.dbService.collection(CampaignCollectionName).Find(ctx, bson.M{
+		"starts_at": bson.M{"$lte": claimedAt},
+		"ends_at":   bson.M{"$gt": claimedAt},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var campaigns []structures.Campaign
+	err = cursor.All(ctx, &campaigns)
+	if err != nil {
+		return nil, err
+	}
+
+	bonuses := []structures.Transaction{}
+
+	for _, campaign := range campaigns {
+		bonus := campaignBonus(&campaign, claim)
+		if bonus <= 0 {
+			continue
+		}
+
+		bonus, err = cs.award(ctx, &campaign, user.Id, bonus)
+		if err != nil {
+			return bonuses, err
+		}
+		if bonus <= 0 {
+			continue
+		}
+
+		transaction := structures.Transaction{
+			TransactionType: structures.BONUS,
+			UserId:          user.Id,
+			ClaimId:         claim.Id,
+			Credits:         bonus,
+			Timestamp:       claimedAt,
+			Description:     "Campaign bonus: " + campaign.Name,
+		}
+
+		err = cs.dbService.CreditUserById(ctx, &transaction, user.Id)
+		if err != nil {
+			return bonuses, err
+		}
+
+		bonuses = append(bonuses, transaction)
+	}
+
+	return bonuses, nil
+}
+
+// award records a bonus against the campaign's cap for the user, and returns how much of it
+// fits under the cap. Concurrent claims are reconciled by only incrementing from the amount read.
+func (cs *CampaignService) award(ctx context.Context, campaign *structures.Campaign, userId string,
+	bonus float32) (float32, error) {
+	awards := cs.dbService.collection(CampaignAwardCollectionName)
+	filter := bson.M{"campaign_id": campaign.Id, "user_id": userId}
+
+	if campaign.CapPerUser <= 0 {
+		_, err := awards.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"credits": bonus}},
+			options.Update().SetUpsert(true))
+		return bonus, err
+	}
+
+	_, err := awards.UpdateOne(ctx, filter, bson.M{"$setOnInsert": bson.M{"credits": float64(0)}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		// Read as float64, as that's how it's stored, so the comparison below is exact.
+		var award struct {
+			Credits float64 `bson:"credits"`
+		}
+
+		err = awards.FindOne(ctx, filter).Decode(&award)
+		if err != nil {
+			return 0, err
+		}
+
+		granted := min(float64(bonus), float64(campaign.CapPerUser)-award.Credits)
+		if granted <= 0 {
+			return 0, nil
+		}
+
+		res, err := awards.UpdateOne(ctx, bson.M{"campaign_id": campaign.Id, "user_id": userId, "credits": award.Credits},
+			bson.M{"$inc": bson.M{"credits": granted}})
+		if err != nil {
+			return 0, err
+		}
+
+		if res.ModifiedCount == 1 {
+			return float32(granted), nil
+		}
+	}
+}
+
+// campaignBonus returns the credits a campaign grants for a claim, before the per-user cap.
+func campaignBonus(campaign *structures.Campaign, claim *structures.DisposalClaim) float32 {
+	if campaign.StationId != "" && campaign.StationId != claim.StationId {
+		return 0
+	}
+	if campaign.Region != "" && campaign.Region != claim.Region {
+		return 0
+	}
+
+	eligible := false
+	var credits float32
+
+	for _, disposal := range claim.Disposals {
+		if campaign.DisposalType == nil || disposal.DisposalType == *campaign.DisposalType {
+			eligible = true
+			credits += disposal.Credits
+		}
+	}
+
+	if !eligible {
+		return 0
+	}
+
+	bonus := campaign.FlatBonus
+	if campaign.Multiplier > 1 {
+		bonus += credits * (campaign.Multiplier - 1)
+	}
+
+	return bonus
+}
+
+func isValidCampaign(campaign *structures.Campaign) bool {
+	return campaign.EndsAt > campaign.StartsAt && (campaign.Multiplier > 1 || campaign.FlatBonus > 0)
+}
@@ -0,0 +1,522 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
+)
+
+const DataExportCollectionName = "data_exports"
+
+const (
+	// dataExportLifetime is how long a finished export can be downloaded.
+	dataExportLifetime = 24 * time.Hour
+
+	// dataExportTimeout is how long an export may take before it is considered lost,
+	// for instance because the server generating it went down.
+	dataExportTimeout = 15 * time.Minute
+
+	// dataExportWait is how long a request waits for an export before answering that it's still pending.
+	// Most accounts are small enough to be exported within it.
+	dataExportWait = 3 * time.Second
+)
+
+// exportedFollow is a follow of or by the user, with the IDs the API leaves out.
+type exportedFollow struct {
+	FollowerId string `json:"follower_id"`
+	FolloweeId string `json:"followee_id"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// exportedReferral is a referral the user made or signed up with. The client it was made from
+// is only included for the user's own signup, since it describes the referee.
+type exportedReferral struct {
+	structures.Referral
+
+	ReferrerId string `json:"referrer_id"`
+	RefereeId  string `json:"referee_id"`
+	Ip         string `json:"ip,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+// exportedDevice is a device registered for push notifications, with its push token.
+type exportedDevice struct {
+	structures.Device
+
+	Token string `json:"token"`
+}
+
+// DataExportService assembles everything stored about a user into a ZIP archive,
+// uploaded to its own bucket and downloaded through short-lived presigned links.
+type DataExportService struct {
+	bucketName string
+
+	dbService      *DatabaseService
+	userService    *UserService
+	sessionService *SessionService
+
+	presignClient *s3.PresignClient
+}
+
+func (des *DataExportService) Init(ctx context.Context, dbService *DatabaseService, userService *UserService,
+	sessionService *SessionService) error {
+	bucketName, found := os.LookupEnv("DATA_EXPORT_S3_BUCKET")
+	if !found {
+		return errors.New("missing DATA_EXPORT_S3_BUCKET environment variable")
+	}
+	des.bucketName = bucketName
+
+	des.dbService = dbService
+	des.userService = userService
+	des.sessionService = sessionService
+
+	des.presignClient = s3.NewPresignClient(userService.S3Client)
+
+	// Only one export per user can be pending at a time, even across replicas.
+	_, err := dbService.collection(DataExportCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+				bson.M{"status": structures.EXPORT_PENDING}),
+		},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create data export indexes: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Request returns the user's latest export if it's ready or still being generated,
+// and starts a new one otherwise. Ready exports come with a download link.
+func (des *DataExportService) Request(ctx context.Context, user *structures.User) (*structures.DataExport, error) {
+	export, err := des.latest(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if export != nil && export.Status == structures.EXPORT_PENDING &&
+		time.Unix(export.CreatedAt, 0).Add(dataExportTimeout).Before(time.Now()) {
+		err = des.fail(export)
+		if err != nil {
+			return nil, err
+		}
+		export.Status = structures.EXPORT_FAILED
+	}
+
+	if export == nil || export.Status == structures.EXPORT_FAILED {
+		export, err = des.start(user)
+		if mongo.IsDuplicateKeyError(err) {
+			// Another request started one in the meantime.
+			export, err = des.latest(ctx, user.Id)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch export.Status {
+	case structures.EXPORT_FAILED:
+		return nil, structures.ErrDataExportFailed
+	case structures.EXPORT_READY:
+		err = des.sign(ctx, export)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return export, nil
+}
+
+// DeleteAllByUser removes the user's exports from storage.
+func (des *DataExportService) DeleteAllByUser(ctx context.Context, userId string) error {
+	collection := des.dbService.collection(DataExportCollectionName)
+
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userId})
+	if err != nil {
+		return err
+	}
+
+	var exports []structures.DataExport
+	err = cursor.All(ctx, &exports)
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		_, err = des.userService.S3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: &des.bucketName,
+			Key:    &export.Key,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = collection.DeleteMany(ctx, bson.M{"user_id": userId})
+
+	return err
+}
+
+// latest returns the user's most recent export that hasn't expired, or nil if there is none.
+func (des *DataExportService) latest(ctx context.Context, userId string) (*structures.DataExport, error) {
+	var export structures.DataExport
+
+	err := des.dbService.collection(DataExportCollectionName).FindOne(ctx,
+		bson.M{"user_id": userId, "expires_at": bson.M{"$gt": time.Now()}},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&export)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	} else if err != nil {
+		fmt.Printf("Failed to get data export for user %v: %v\n", userId, err)
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// start records a new pending export and generates it in the background, waiting for it
+// a little in case it's quick. The unique index rejects it if one is already pending.
+func (des *DataExportService) start(user *structures.User) (*structures.DataExport, error) {
+	now := time.Now()
+
+	export := structures.DataExport{
+		UserId:    user.Id,
+		Status:    structures.EXPORT_PENDING,
+		Key:       fmt.Sprintf("exports/%s/%s.zip", user.Id, randomUrlString(16)),
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(dataExportTimeout + dataExportLifetime),
+	}
+
+	res, err := des.dbService.collection(DataExportCollectionName).InsertOne(context.Background(), export)
+	if err != nil {
+		return nil, err
+	}
+
+	export.Id = res.InsertedID.(primitive.ObjectID).Hex()
+
+	finished := make(chan structures.DataExport, 1)
+
+	go func(export structures.DataExport) {
+		ctx, cancel := context.WithTimeout(context.Background(), dataExportTimeout)
+		defer cancel()
+
+		err := des.generate(ctx, &export)
+		if err != nil {
+			fmt.Printf("Failed to export data of user %v: %v\n", export.UserId, err)
+			des.fail(&export)
+			export.Status = structures.EXPORT_FAILED
+		} else {
+			fmt.Printf("Exported data of user %v.\n", export.UserId)
+		}
+
+		finished <- export
+	}(export)
+
+	select {
+	case export = <-finished:
+	case <-time.After(dataExportWait):
+	}
+
+	return &export, nil
+}
+
+// fail marks a pending export as failed, so a new one can be started.
+func (des *DataExportService) fail(export *structures.DataExport) error {
+	objectId, err := primitive.ObjectIDFromHex(export.Id)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	_, err = des.dbService.collection(DataExportCollectionName).UpdateOne(context.Background(),
+		bson.M{"_id": objectId, "status": structures.EXPORT_PENDING},
+		bson.M{"$set": bson.M{"status": structures.EXPORT_FAILED}})
+
+	return err
+}
+
+// sign sets a download link on a ready export, valid until the export expires.
+func (des *DataExportService) sign(ctx context.Context, export *structures.DataExport) error {
+	request, err := des.presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: &des.bucketName,
+		Key:    &export.Key,
+	}, s3.WithPresignExpires(time.Until(export.ExpiresAt)))
+	if err != nil {
+		return err
+	}
+
+	export.DownloadUrl = request.URL
+
+	return nil
+}
+
+// generate builds the user's archive, uploads it and marks the export as ready.
+func (des *DataExportService) generate(ctx context.Context, export *structures.DataExport) error {
+	user, err := des.dbService.GetUserById(export.UserId)
+	if err != nil {
+		return err
+	}
+
+	disposals, err := des.dbService.GetDisposalsByUserId(user.Id)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := des.sessionService.ListByUser(user.Id)
+	if err != nil {
+		return err
+	}
+
+	avatar, err := des.userService.GetAvatar(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+
+	follows, err := findAll[structures.Follow](ctx, des.dbService.collection(FollowCollectionName),
+		bson.M{"$or": bson.A{bson.M{"follower_id": user.Id}, bson.M{"followee_id": user.Id}}})
+	if err != nil {
+		return err
+	}
+
+	events, err := findAll[structures.Event](ctx, des.dbService.collection(EventCollectionName),
+		bson.M{"user_id": user.Id})
+	if err != nil {
+		return err
+	}
+
+	referrals, err := findAll[structures.Referral](ctx, des.dbService.collection(ReferralCollectionName),
+		bson.M{"$or": bson.A{bson.M{"referrer_id": user.Id}, bson.M{"referee_id": user.Id}}})
+	if err != nil {
+		return err
+	}
+
+	devices, err := findAll[structures.Device](ctx, des.dbService.collection(DeviceCollectionName),
+		bson.M{"user_id": user.Id})
+	if err != nil {
+		return err
+	}
+
+	notifications, err := findAll[structures.Notification](ctx, des.dbService.collection(NotificationCollectionName),
+		bson.M{"user_id": user.Id})
+	if err != nil {
+		return err
+	}
+
+	vouchers, err := findAll[structures.Voucher](ctx, des.dbService.collection(VoucherCollectionName),
+		bson.M{"user_id": user.Id})
+	if err != nil {
+		return err
+	}
+
+	redemptions, err := findAll[structures.Redemption](ctx, des.dbService.collection(RedemptionCollectionName),
+		bson.M{"user_id": user.Id})
+	if err != nil {
+		return err
+	}
+
+	blocked := user.Blocked
+	if blocked == nil {
+		blocked = []string{}
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+
+	err = errors.Join(
+		writeJsonFile(zw, "profile.json", user.ToProfile()),
+		writeJsonFile(zw, "transactions.json", user.Transactions),
+		writeCsvFile(zw, "transactions.csv",
+			[]string{"type", "claim_id", "credits", "timestamp", "description"},
+			user.Transactions, func(t structures.Transaction) []string {
+				return []string{string(t.TransactionType), t.ClaimId, formatFloat(t.Credits),
+					formatTime(t.Timestamp), t.Description}
+			}),
+		writeJsonFile(zw, "disposals.json", disposals),
+		writeCsvFile(zw, "disposals.csv",
+			[]string{"id", "token", "operator_id", "credits", "weight", "disposal_types"},
+			disposals, func(d structures.DisposalClaim) []string {
+				types := ""
+				for i, disposal := range d.Disposals {
+					if i > 0 {
+						types += " "
+					}
+					types += strconv.Itoa(int(disposal.DisposalType))
+				}
+				return []string{d.Id, d.Token, d.OperatorId, formatFloat(d.Credits), formatFloat(d.Weight), types}
+			}),
+		writeJsonFile(zw, "sessions.json", sessions),
+		writeCsvFile(zw, "sessions.csv",
+			[]string{"id", "device_name", "user_agent", "ip", "created_at", "last_used_at"},
+			sessions, func(s structures.Session) []string {
+				return []string{s.Id, s.DeviceName, s.UserAgent, s.Ip, formatTime(s.CreatedAt), formatTime(s.LastUsedAt)}
+			}),
+		writeJsonFile(zw, "follows.json", utils.Map(follows, func(f structures.Follow, i int) exportedFollow {
+			return exportedFollow{FollowerId: f.FollowerId, FolloweeId: f.FolloweeId, CreatedAt: f.CreatedAt}
+		})),
+		writeJsonFile(zw, "blocked.json", blocked),
+		writeJsonFile(zw, "feed_events.json", events),
+		writeJsonFile(zw, "referrals.json", utils.Map(referrals, func(r structures.Referral, i int) exportedReferral {
+			exported := exportedReferral{Referral: r, ReferrerId: r.ReferrerId, RefereeId: r.RefereeId}
+			if r.RefereeId == user.Id {
+				exported.Ip, exported.UserAgent, exported.DeviceName = r.Ip, r.UserAgent, r.DeviceName
+			}
+			return exported
+		})),
+		writeJsonFile(zw, "devices.json", utils.Map(devices, func(d structures.Device, i int) exportedDevice {
+			return exportedDevice{Device: d, Token: d.Token}
+		})),
+		writeJsonFile(zw, "notifications.json", notifications),
+		writeJsonFile(zw, "vouchers.json", vouchers),
+		writeJsonFile(zw, "redemptions.json", redemptions),
+	)
+	if err != nil {
+		return err
+	}
+
+	if avatar != nil {
+		extension := ""
+		extensions, _ := mime.ExtensionsByType(http.DetectContentType(avatar))
+		if len(extensions) > 0 {
+			extension = extensions[0]
+		}
+
+		file, err := zw.Create("avatar" + extension)
+		if err != nil {
+			return err
+		}
+
+		_, err = file.Write(avatar)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+
+	size := int64(archive.Len())
+	contentType := "application/zip"
+	contentDisposition := fmt.Sprintf("attachment; filename=\"echo-%s-%s.zip\"",
+		user.Username, time.Now().Format("2006-01-02"))
+
+	_, err = des.userService.S3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:             &des.bucketName,
+		Key:                &export.Key,
+		Body:               bytes.NewReader(archive.Bytes()),
+		ContentLength:      &size,
+		ContentType:        &contentType,
+		ContentDisposition: &contentDisposition,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	export.Status = structures.EXPORT_READY
+	export.Size = size
+	export.CompletedAt = now.Unix()
+	export.ExpiresAt = now.Add(dataExportLifetime)
+
+	objectId, err := primitive.ObjectIDFromHex(export.Id)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	_, err = des.dbService.collection(DataExportCollectionName).UpdateOne(ctx, bson.M{"_id": objectId},
+		bson.M{"$set": bson.M{
+			"status":       export.Status,
+			"size":         export.Size,
+			"completed_at": export.CompletedAt,
+			"expires_at":   export.ExpiresAt,
+		}})
+
+	return err
+}
+
+// findAll returns the documents of the collection matching the filter, or an empty slice.
+func findAll[T any](ctx context.Context, collection *mongo.Collection, filter bson.M) ([]T, error) {
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []T{}
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func writeJsonFile(zw *zip.Writer, name string, v any) error {
+	file, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
+
+func writeCsvFile[T any](zw *zip.Writer, name string, header []string, rows []T, row func(T) []string) error {
+	file, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+
+	err = writer.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		err = writer.Write(row(r))
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func formatFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', -1, 32)
+}
+
+func formatTime(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
@@ -15,6 +15,16 @@ import (
 
 const UserCollectionName = "users"
 const DisposalCollectionName = "disposals"
+const SettingsCollectionName = "settings"
+
+const securitySettingsId = "security"
+
+// balanceTolerance is how far a balance can be from its ledger before ReconcileBalances reports it.
+const balanceTolerance = 0.01
+
+// caseInsensitive is the collation used by the unique indexes on usernames and tokens,
+// and by every query that should hit them.
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
 
 type DatabaseService struct {
 	Client *mongo.Client
@@ -23,6 +33,10 @@ type DatabaseService struct {
 	dbName string
 	dbUser string
 	dbPass string
+
+	// transactions is set when the server is part of a replica set or sharded cluster,
+	// the only deployments that support multi-document transactions.
+	transactions bool
 }
 
 func (ds *DatabaseService) Init(ctx context.Context) {
@@ -63,6 +77,94 @@ func (ds *DatabaseService) Init(ctx context.Context) {
 	ds.Client = client
 
 	fmt.Println("Database connected.")
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err = client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		panic(err)
+	}
+
+	ds.transactions = hello.SetName != "" || hello.Msg == "isdbgrid"
+	if !ds.transactions {
+		fmt.Println("Database is a standalone server; writes that belong together won't run in transactions.")
+	}
+
+	err = ds.EnsureIndexes(ctx)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// EnsureIndexes creates the indexes the services rely on, if they don't already exist.
+// Usernames and disposal tokens are unique regardless of case.
+func (ds *DatabaseService) EnsureIndexes(ctx context.Context) error {
+	db := ds.Client.Database(ds.dbName)
+
+	_, err := db.Collection(UserCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetUnique(true).SetCollation(caseInsensitive),
+	})
+	if err != nil {
+		fmt.Printf("Failed to create username index: %v\n", err)
+		return err
+	}
+
+	_, err = db.Collection(UserCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+			bson.M{"identities": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		fmt.Printf("Failed to create external identity index: %v\n", err)
+		return err
+	}
+
+	_, err = db.Collection(DisposalCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "token", Value: 1}},
+		Options: options.Index().SetUnique(true).SetCollation(caseInsensitive),
+	})
+	if err != nil {
+		fmt.Printf("Failed to create disposal token index: %v\n", err)
+		return err
+	}
+
+	_, err = db.Collection(DisposalCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create disposal user index: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// WithTransaction runs fn in a transaction, retrying it on transient errors, so the writes it
+// makes with the context it is given are committed together or not at all. On a standalone
+// server, which has no transactions, fn runs as is.
+func (ds *DatabaseService) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !ds.transactions {
+		return fn(ctx)
+	}
+
+	session, err := ds.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+
+	return err
+}
+
+func (ds *DatabaseService) collection(name string) *mongo.Collection {
+	return ds.Client.Database(ds.dbName).Collection(name)
 }
 
 func (ds *DatabaseService) GetUserById(id string) (*structures.User, error) {
@@ -95,7 +197,7 @@ func (ds *DatabaseService) GetUserByUsername(username string) (*structures.User,
 	filter := bson.M{"username": username}
 
 	err := ds.Client.Database(ds.dbName).Collection(UserCollectionName).FindOne(
-		context.Background(), filter).Decode(&result)
+		context.Background(), filter, options.FindOne().SetCollation(caseInsensitive)).Decode(&result)
 
 	if err == mongo.ErrNoDocuments {
 		return nil, structures.ErrNoUser
@@ -107,13 +209,86 @@ func (ds *DatabaseService) GetUserByUsername(username string) (*structures.User,
 	return &result, nil
 }
 
-func (ds *DatabaseService) CreateUser(user structures.User) error {
-	_, err := ds.Client.Database(ds.dbName).Collection(UserCollectionName).InsertOne(context.Background(), user)
+// GetUsersByIds returns the users with the given IDs, keyed by ID. Unknown IDs are left out.
+func (ds *DatabaseService) GetUsersByIds(ids []string) (map[string]*structures.User, error) {
+	objectIds := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		objectId, err := primitive.ObjectIDFromHex(id)
+		if err == nil {
+			objectIds = append(objectIds, objectId)
+		}
+	}
+
+	cur, err := ds.collection(UserCollectionName).Find(context.Background(), bson.M{"_id": bson.M{"$in": objectIds}})
+	if err != nil {
+		fmt.Printf("Failed to get users: %v\n", err)
+		return nil, err
+	}
+
+	var result []structures.User
+	err = cur.All(context.Background(), &result)
 	if err != nil {
+		fmt.Printf("Failed to get users: %v\n", err)
+		return nil, err
+	}
+
+	users := make(map[string]*structures.User, len(result))
+	for i := range result {
+		users[result[i].Id] = &result[i]
+	}
+
+	return users, nil
+}
+
+// GetUserByIdentity returns the user linked to the given OpenID Connect provider and subject.
+func (ds *DatabaseService) GetUserByIdentity(provider string, subject string) (*structures.User, error) {
+	var result structures.User
+
+	filter := bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}}}
+
+	err := ds.collection(UserCollectionName).FindOne(context.Background(), filter).Decode(&result)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrNoUser
+	} else if err != nil {
+		fmt.Printf("Failed to get user for identity %v/%v: %v\n", provider, subject, err)
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// LinkIdentityToUserById adds an external identity to the user.
+// It returns ErrIdentityAlreadyLinked if another user already has it.
+func (ds *DatabaseService) LinkIdentityToUserById(identity *structures.ExternalIdentity, userId string) error {
+	err := ds.UpdateUserById(userId, bson.M{"$push": bson.M{"identities": identity}})
+	if mongo.IsDuplicateKeyError(err) {
+		return structures.ErrIdentityAlreadyLinked
+	}
+
+	return err
+}
+
+// CreateUser inserts the given user and sets its Id to the generated ObjectID.
+// It returns ErrUserAlreadyExists if the username is taken, ignoring case.
+func (ds *DatabaseService) CreateUser(ctx context.Context, user *structures.User) error {
+	res, err := ds.Client.Database(ds.dbName).Collection(UserCollectionName).InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return structures.ErrUserAlreadyExists
+	} else if err != nil {
 		fmt.Printf("Failed to create user %v: %v\n", user.Username, err)
 		return err
 	}
 
+	// A user with an Id set is inserted under it, which only happens by mistake, such as a
+	// transaction retried without resetting it.
+	id, ok := res.InsertedID.(primitive.ObjectID)
+	if !ok {
+		fmt.Printf("Created user %v with unexpected id %v.\n", user.Username, res.InsertedID)
+		return structures.ErrInvalidDatabaseId
+	}
+	user.Id = id.Hex()
+
 	fmt.Printf("Created user %v.\n", user.Username)
 
 	return nil
@@ -166,13 +341,46 @@ func (ds *DatabaseService) GetDisposalsByUserId(userId string) ([]structures.Dis
 	return *result, nil
 }
 
-func (ds *DatabaseService) InsertDisposal(disposal *structures.DisposalClaim) error {
-	_, err := ds.Client.Database(ds.dbName).Collection(DisposalCollectionName).InsertOne(context.Background(), disposal)
+// GetTotalWeightByUserId returns the weight of every disposal the user has claimed.
+func (ds *DatabaseService) GetTotalWeightByUserId(userId string) (float32, error) {
+	cur, err := ds.collection(DisposalCollectionName).Aggregate(context.Background(), bson.A{
+		bson.M{"$match": bson.M{"user_id": userId, "is_claimed": true}},
+		bson.M{"$group": bson.M{"_id": nil, "weight": bson.M{"$sum": "$weight"}}},
+	})
+	if err != nil {
+		fmt.Printf("Failed to get total weight for user %v: %v\n", userId, err)
+		return 0, err
+	}
+
+	var result []struct {
+		Weight float64 `bson:"weight"`
+	}
+
+	err = cur.All(context.Background(), &result)
 	if err != nil {
+		fmt.Printf("Failed to get total weight for user %v: %v\n", userId, err)
+		return 0, err
+	}
+
+	if len(result) == 0 {
+		return 0, nil
+	}
+
+	return float32(result[0].Weight), nil
+}
+
+// InsertDisposal inserts the given disposal and sets its Id to the generated ObjectID.
+func (ds *DatabaseService) InsertDisposal(ctx context.Context, disposal *structures.DisposalClaim) error {
+	res, err := ds.Client.Database(ds.dbName).Collection(DisposalCollectionName).InsertOne(ctx, disposal)
+	if mongo.IsDuplicateKeyError(err) {
+		return structures.ErrDisposalAlreadyExists
+	} else if err != nil {
 		fmt.Printf("Failed to insert disposal: %v\n", err)
 		return err
 	}
 
+	disposal.Id = res.InsertedID.(primitive.ObjectID).Hex()
+
 	fmt.Printf("Inserted disposal %v.\n", disposal.Token)
 
 	return nil
@@ -184,7 +392,7 @@ func (ds *DatabaseService) GetDisposalByToken(token string) (*structures.Disposa
 	filter := bson.M{"token": token}
 
 	err := ds.Client.Database(ds.dbName).Collection(DisposalCollectionName).FindOne(
-		context.Background(), filter).Decode(&result)
+		context.Background(), filter, options.FindOne().SetCollation(caseInsensitive)).Decode(&result)
 
 	if err == mongo.ErrNoDocuments {
 		return nil, structures.ErrNoDisposal
@@ -199,9 +407,9 @@ func (ds *DatabaseService) GetDisposalByToken(token string) (*structures.Disposa
 // UpdateDisposal updates a disposal with the given filter and update.
 // Both the filter and update parameters should be MongoDB's BSON objects (primitives).
 // It returns nil on success, and an error on failure.
-func (ds *DatabaseService) UpdateDisposal(disposalToken string, update interface{}) error {
-	r, err := ds.Client.Database(ds.dbName).Collection(DisposalCollectionName).UpdateOne(context.Background(),
-		primitive.M{"token": disposalToken}, update)
+func (ds *DatabaseService) UpdateDisposal(ctx context.Context, disposalToken string, update interface{}) error {
+	r, err := ds.Client.Database(ds.dbName).Collection(DisposalCollectionName).UpdateOne(ctx,
+		primitive.M{"token": disposalToken}, update, options.Update().SetCollation(caseInsensitive))
 
 	if err != nil {
 		fmt.Printf("Failed to update disposal: %v\n", err)
@@ -218,6 +426,24 @@ func (ds *DatabaseService) UpdateDisposal(disposalToken string, update interface
 	return nil
 }
 
+// ClaimDisposal sets the given fields on a disposal that isn't claimed or expired yet. It returns
+// ErrDisposalAlreadyClaimed if it is, so that concurrent claims can't both succeed.
+func (ds *DatabaseService) ClaimDisposal(ctx context.Context, disposalToken string, claim bson.M) error {
+	r, err := ds.collection(DisposalCollectionName).UpdateOne(ctx,
+		bson.M{"token": disposalToken, "is_claimed": false, "is_expired": bson.M{"$ne": true}}, bson.M{"$set": claim},
+		options.Update().SetCollation(caseInsensitive))
+	if err != nil {
+		fmt.Printf("Failed to claim disposal: %v\n", err)
+		return err
+	}
+
+	if r.MatchedCount == 0 {
+		return structures.ErrDisposalAlreadyClaimed
+	}
+
+	return nil
+}
+
 func (ds *DatabaseService) LinkTransactionToUserById(transaction *structures.Transaction, userId string) error {
 	objectId, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
@@ -243,3 +469,105 @@ func (ds *DatabaseService) LinkTransactionToUserById(transaction *structures.Tra
 
 	return nil
 }
+
+// CreditUserById adds the transaction to the user's ledger and its credits to their balance,
+// in a single update.
+func (ds *DatabaseService) CreditUserById(ctx context.Context, transaction *structures.Transaction, userId string) error {
+	objectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	res, err := ds.collection(UserCollectionName).UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{
+		"$inc":  bson.M{"credits": transaction.Credits},
+		"$push": bson.M{"transactions": transaction},
+	})
+	if err != nil {
+		fmt.Printf("Failed to credit user %v: %v\n", userId, err)
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return structures.ErrNoUser
+	}
+
+	return nil
+}
+
+// ReconcileBalances checks that every user's credits add up to their ledger, where SPEND
+// transactions count against them. Mismatches are logged rather than corrected, since the
+// ledger could as well be the one that's wrong, and reported together in the returned error.
+func (ds *DatabaseService) ReconcileBalances(ctx context.Context) error {
+	cur, err := ds.collection(UserCollectionName).Aggregate(ctx, bson.A{
+		bson.M{"$project": bson.M{
+			"credits": bson.M{"$ifNull": bson.A{"$credits", 0}},
+			"ledger": bson.M{"$sum": bson.M{"$map": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$transactions", bson.A{}}},
+				"as":    "t",
+				"in": bson.M{"$cond": bson.A{
+					bson.M{"$eq": bson.A{"$$t.transaction_type", structures.SPEND}},
+					bson.M{"$multiply": bson.A{"$$t.credits", -1}},
+					"$$t.credits",
+				}},
+			}}},
+		}},
+		// Balances are float32, so allow for rounding.
+		bson.M{"$match": bson.M{"$expr": bson.M{
+			"$gt": bson.A{bson.M{"$abs": bson.M{"$subtract": bson.A{"$credits", "$ledger"}}}, balanceTolerance},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var mismatches []struct {
+		Id      primitive.ObjectID `bson:"_id"`
+		Credits float64            `bson:"credits"`
+		Ledger  float64            `bson:"ledger"`
+	}
+
+	err = cur.All(ctx, &mismatches)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range mismatches {
+		fmt.Printf("Balance of user %v is %.2f, but their ledger adds up to %.2f.\n", m.Id.Hex(), m.Credits, m.Ledger)
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%d users have a balance that doesn't match their ledger", len(mismatches))
+	}
+
+	return nil
+}
+
+// GetSecuritySettings returns the platform-wide security settings.
+// If none were saved yet, it returns the zero value.
+func (ds *DatabaseService) GetSecuritySettings() (*structures.SecuritySettings, error) {
+	var result structures.SecuritySettings
+
+	err := ds.collection(SettingsCollectionName).FindOne(context.Background(),
+		bson.M{"_id": securitySettingsId}).Decode(&result)
+
+	if err == mongo.ErrNoDocuments {
+		return &structures.SecuritySettings{}, nil
+	} else if err != nil {
+		fmt.Printf("Failed to get security settings: %v\n", err)
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (ds *DatabaseService) UpdateSecuritySettings(settings *structures.SecuritySettings) error {
+	_, err := ds.collection(SettingsCollectionName).UpdateOne(context.Background(),
+		bson.M{"_id": securitySettingsId}, bson.M{"$set": settings}, options.Update().SetUpsert(true))
+
+	if err != nil {
+		fmt.Printf("Failed to update security settings: %v\n", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
+)
+
+// claimExpiryWarning is how long before a disposal expires unclaimed its operator is told.
+// Lifetimes shorter than twice this are warned about halfway through instead.
+const claimExpiryWarning = 24 * time.Hour
+
+// DisposalService looks after disposals between being registered and claimed.
+type DisposalService struct {
+	// claimLifetime is how long a disposal can be claimed after it was registered.
+	claimLifetime time.Duration
+
+	dbService           *DatabaseService
+	notificationService *NotificationService
+	outboxService       *OutboxService
+}
+
+// Init reads how long claim tokens last, in hours, from CLAIM_TOKEN_LIFETIME_HOURS, defaulting to 72.
+func (dss *DisposalService) Init(ctx context.Context, dbService *DatabaseService,
+	notificationService *NotificationService, outboxService *OutboxService) error {
+	hours, err := strconv.Atoi(utils.GetenvOr("CLAIM_TOKEN_LIFETIME_HOURS", "72"))
+	if err != nil || hours < 1 {
+		return errors.New("invalid CLAIM_TOKEN_LIFETIME_HOURS environment variable")
+	}
+	dss.claimLifetime = time.Duration(hours) * time.Hour
+
+	dss.dbService = dbService
+	dss.notificationService = notificationService
+	dss.outboxService = outboxService
+
+	_, err = dbService.collection(DisposalCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "is_claimed", Value: 1}, {Key: "expires_at", Value: 1}},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create disposal expiry index: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// ClaimExpiresAt returns when a disposal registered at the given time can no longer be claimed.
+func (dss *DisposalService) ClaimExpiresAt(createdAt int64) int64 {
+	return time.Unix(createdAt, 0).Add(dss.claimLifetime).Unix()
+}
+
+// ExpireUnclaimed warns operators about their disposals that are about to expire unclaimed, and
+// marks the disposals nobody claimed in time as expired, announcing each of them to subscribers.
+// Claims already reject those; they are kept so operators still see what they registered.
+// Disposals from before claim tokens expired are left alone.
+func (dss *DisposalService) ExpireUnclaimed(ctx context.Context) error {
+	err := dss.warnExpiring(ctx)
+	if err != nil {
+		return err
+	}
+
+	disposals := dss.dbService.collection(DisposalCollectionName)
+
+	cursor, err := disposals.Find(ctx, bson.M{
+		"is_claimed": false,
+		"is_expired": bson.M{"$ne": true},
+		"expires_at": bson.M{"$gt": 0, "$lte": time.Now().Unix()},
+	})
+	if err != nil {
+		fmt.Printf("Failed to find unclaimed disposals: %v\n", err)
+		return err
+	}
+
+	var unclaimed []structures.DisposalClaim
+	err = cursor.All(ctx, &unclaimed)
+	if err != nil {
+		return err
+	}
+
+	expired := 0
+	for _, disposal := range unclaimed {
+		objectId, _ := primitive.ObjectIDFromHex(disposal.Id)
+
+		// Only the replica that marks the disposal announces it, and a claim made meanwhile wins.
+		marked := false
+		err = dss.dbService.WithTransaction(ctx, func(ctx context.Context) error {
+			marked = false
+
+			res, err := disposals.UpdateOne(ctx,
+				bson.M{"_id": objectId, "is_claimed": false, "is_expired": bson.M{"$ne": true}},
+				bson.M{"$set": bson.M{"is_expired": true}})
+			if err != nil {
+				return err
+			}
+			if res.ModifiedCount == 0 {
+				return nil
+			}
+			marked = true
+
+			event := disposal
+			event.Token = ""
+			event.IsExpired = true
+
+			return dss.outboxService.Add(ctx, structures.WEBHOOK_DISPOSAL_EXPIRED, event)
+		})
+		if err != nil {
+			fmt.Printf("Failed to expire disposal %v: %v\n", disposal.Id, err)
+			return err
+		}
+
+		if marked {
+			expired++
+		}
+	}
+
+	if expired > 0 {
+		fmt.Printf("Expired %d unclaimed disposals.\n", expired)
+	}
+
+	return nil
+}
+
+// warnExpiring notifies the operators of the disposals expiring soon, once for each disposal.
+func (dss *DisposalService) warnExpiring(ctx context.Context) error {
+	disposals := dss.dbService.collection(DisposalCollectionName)
+	now := time.Now()
+	warning := min(claimExpiryWarning, dss.claimLifetime/2)
+
+	cursor, err := disposals.Find(ctx, bson.M{
+		"is_claimed":      false,
+		"expires_at":      bson.M{"$gt": now.Unix(), "$lte": now.Add(warning).Unix()},
+		"expiry_notified": bson.M{"$ne": true},
+	})
+	if err != nil {
+		fmt.Printf("Failed to find expiring disposals: %v\n", err)
+		return err
+	}
+
+	var expiring []structures.DisposalClaim
+	err = cursor.All(ctx, &expiring)
+	if err != nil {
+		return err
+	}
+
+	for _, disposal := range expiring {
+		objectId, _ := primitive.ObjectIDFromHex(disposal.Id)
+
+		// Only the replica that marks the disposal notifies, in case a run overlaps a late one.
+		res, err := disposals.UpdateOne(ctx, bson.M{"_id": objectId, "expiry_notified": bson.M{"$ne": true}},
+			bson.M{"$set": bson.M{"expiry_notified": true}})
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount == 0 {
+			continue
+		}
+
+		hours := int(math.Ceil(time.Unix(disposal.ExpiresAt, 0).Sub(now).Hours()))
+		unit := "hours"
+		if hours == 1 {
+			unit = "hour"
+		}
+
+		body := fmt.Sprintf("A disposal of %.2f credits you registered hasn't been claimed, and expires in %d %s.",
+			disposal.Credits, hours, unit)
+
+		err = dss.notificationService.Notify(ctx, disposal.OperatorId, &structures.Notification{
+			Category: structures.NOTIFY_CLAIM_EXPIRING,
+			Title:    "Disposal expiring",
+			Body:     body,
+			Data:     map[string]string{"disposal_id": disposal.Id},
+		})
+		if err != nil {
+			fmt.Printf("Failed to notify user %v of expiring disposal %v: %v\n", disposal.OperatorId, disposal.Id, err)
+		}
+	}
+
+	return nil
+}
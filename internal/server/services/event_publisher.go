@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+// memoryEventLimit is how many events MemoryEventPublisher keeps.
+const memoryEventLimit = 1000
+
+// EventPublisher sends the events relayed from the outbox to their subscribers.
+type EventPublisher interface {
+	// Publish sends an event. The same event may be published more than once, so subscribers
+	// should use its ID to tell duplicates apart.
+	Publish(ctx context.Context, event *structures.OutboxEvent) error
+}
+
+// MemoryEventPublisher is an EventPublisher that keeps the latest events in memory, for
+// development. It drops events it has already seen.
+type MemoryEventPublisher struct {
+	mu     sync.Mutex
+	events []structures.OutboxEvent
+	seen   map[string]bool
+}
+
+func NewMemoryEventPublisher() *MemoryEventPublisher {
+	return &MemoryEventPublisher{seen: make(map[string]bool)}
+}
+
+func (mp *MemoryEventPublisher) Publish(ctx context.Context, event *structures.OutboxEvent) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if mp.seen[event.Id] {
+		return nil
+	}
+
+	if len(mp.events) == memoryEventLimit {
+		delete(mp.seen, mp.events[0].Id)
+		mp.events = mp.events[1:]
+	}
+
+	mp.events = append(mp.events, *event)
+	mp.seen[event.Id] = true
+
+	return nil
+}
+
+// Events returns the events published so far, oldest first.
+func (mp *MemoryEventPublisher) Events() []structures.OutboxEvent {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return append([]structures.OutboxEvent{}, mp.events...)
+}
+
+// WebhookEventPublisher is an EventPublisher that queues events for the webhook endpoints
+// subscribed to them.
+type WebhookEventPublisher struct {
+	webhookService *WebhookService
+}
+
+func NewWebhookEventPublisher(webhookService *WebhookService) *WebhookEventPublisher {
+	return &WebhookEventPublisher{webhookService: webhookService}
+}
+
+func (wp *WebhookEventPublisher) Publish(ctx context.Context, event *structures.OutboxEvent) error {
+	return wp.webhookService.Enqueue(ctx, &structures.WebhookEvent{
+		Id:        event.Id,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		Data:      json.RawMessage(event.Data),
+	})
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+const EventCollectionName = "events"
+
+// FeedService records what users do and builds feeds from it. Events are stored once per
+// user and feeds are assembled when read, from the events of the users the viewer follows
+// and is allowed to see, so changes to visibility, follows or blocks apply right away.
+type FeedService struct {
+	dbService      *DatabaseService
+	friendService  *FriendService
+	profileService *ProfileService
+}
+
+func (fds *FeedService) Init(ctx context.Context, dbService *DatabaseService, friendService *FriendService,
+	profileService *ProfileService) error {
+	fds.dbService = dbService
+	fds.friendService = friendService
+	fds.profileService = profileService
+
+	_, err := dbService.collection(EventCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create event index: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Publish records an event, timestamping it now unless it already has a time.
+func (fds *FeedService) Publish(ctx context.Context, event *structures.Event) error {
+	if event.CreatedAt == 0 {
+		event.CreatedAt = time.Now().Unix()
+	}
+
+	res, err := fds.dbService.collection(EventCollectionName).InsertOne(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	event.Id = res.InsertedID.(primitive.ObjectID).Hex()
+
+	return nil
+}
+
+// Feed returns up to limit events of the users the viewer follows and can see, latest first.
+// Pass the ID of the last event of a page as before to get the next one. The returned cursor
+// is empty once there are no more events.
+func (fds *FeedService) Feed(ctx context.Context, viewer *structures.User, before string,
+	limit int) ([]structures.Event, string, error) {
+	filter := bson.M{}
+
+	if before != "" {
+		cursor, err := primitive.ObjectIDFromHex(before)
+		if err != nil {
+			return nil, "", structures.ErrInvalidDatabaseId
+		}
+		filter["_id"] = bson.M{"$lt": cursor}
+	}
+
+	following, err := fds.friendService.Following(ctx, viewer.Id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(following) == 0 {
+		return []structures.Event{}, "", nil
+	}
+
+	ids := make([]string, len(following))
+	for i, follow := range following {
+		ids[i] = follow.FolloweeId
+	}
+
+	users, err := fds.dbService.GetUsersByIds(ids)
+	if err != nil {
+		return nil, "", err
+	}
+
+	followers, err := fds.friendService.followerSet(ctx, viewer.Id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	visible := []string{}
+	for id, user := range users {
+		if fds.profileService.CanViewFriend(viewer, user, followers[id]) {
+			visible = append(visible, id)
+		}
+	}
+
+	if len(visible) == 0 {
+		return []structures.Event{}, "", nil
+	}
+
+	filter["user_id"] = bson.M{"$in": visible}
+
+	cursor, err := fds.dbService.collection(EventCollectionName).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	events := []structures.Event{}
+	err = cursor.All(ctx, &events)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := range events {
+		user := users[events[i].UserId]
+		events[i].Name = user.Name
+		events[i].Username = user.Username
+	}
+
+	next := ""
+	if len(events) == limit {
+		next = events[len(events)-1].Id
+	}
+
+	return events, next, nil
+}
+
+// DeleteAllByUser removes the events of the user.
+func (fds *FeedService) DeleteAllByUser(ctx context.Context, userId string) error {
+	_, err := fds.dbService.collection(EventCollectionName).DeleteMany(ctx, bson.M{"user_id": userId})
+
+	return err
+}
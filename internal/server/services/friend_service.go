@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+const FollowCollectionName = "follows"
+
+// FriendService keeps track of who follows whom, and who blocked whom.
+// Users following each other are friends.
+type FriendService struct {
+	dbService *DatabaseService
+}
+
+func (frs *FriendService) Init(ctx context.Context, dbService *DatabaseService) error {
+	frs.dbService = dbService
+
+	_, err := dbService.collection(FollowCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "follower_id", Value: 1}, {Key: "followee_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "followee_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create follow indexes: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Follow makes the user follow the target. Following someone twice is a no-op.
+// It returns ErrNoUser if either user blocked the other.
+func (frs *FriendService) Follow(ctx context.Context, user *structures.User, target *structures.User) error {
+	if user.Id == target.Id {
+		return structures.ErrCannotFollowSelf
+	}
+
+	if target.IsDeleted || user.HasBlocked(target) || target.HasBlocked(user) {
+		return structures.ErrNoUser
+	}
+
+	_, err := frs.dbService.collection(FollowCollectionName).UpdateOne(ctx,
+		bson.M{"follower_id": user.Id, "followee_id": target.Id},
+		bson.M{"$setOnInsert": bson.M{"created_at": time.Now().Unix()}},
+		options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent request created the follow first.
+		return nil
+	}
+
+	return err
+}
+
+// Unfollow makes the user stop following the target, if they did.
+func (frs *FriendService) Unfollow(ctx context.Context, userId string, targetId string) error {
+	_, err := frs.dbService.collection(FollowCollectionName).DeleteOne(ctx,
+		bson.M{"follower_id": userId, "followee_id": targetId})
+
+	return err
+}
+
+// AreFriends reports whether the two users follow each other.
+func (frs *FriendService) AreFriends(ctx context.Context, userId string, otherId string) (bool, error) {
+	count, err := frs.dbService.collection(FollowCollectionName).CountDocuments(ctx, bson.M{"$or": bson.A{
+		bson.M{"follower_id": userId, "followee_id": otherId},
+		bson.M{"follower_id": otherId, "followee_id": userId},
+	}})
+	if err != nil {
+		return false, err
+	}
+
+	return count == 2, nil
+}
+
+// Following returns the follows of the users the user follows, latest first.
+func (frs *FriendService) Following(ctx context.Context, userId string) ([]structures.Follow, error) {
+	return frs.find(ctx, bson.M{"follower_id": userId})
+}
+
+// Followers returns the follows of the users following the user, latest first.
+func (frs *FriendService) Followers(ctx context.Context, userId string) ([]structures.Follow, error) {
+	return frs.find(ctx, bson.M{"followee_id": userId})
+}
+
+func (frs *FriendService) find(ctx context.Context, filter bson.M) ([]structures.Follow, error) {
+	cursor, err := frs.dbService.collection(FollowCollectionName).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	follows := []structures.Follow{}
+	err = cursor.All(ctx, &follows)
+
+	return follows, err
+}
+
+// Block stops the target from seeing or following the user, and removes any follows between them.
+func (frs *FriendService) Block(ctx context.Context, user *structures.User, target *structures.User) error {
+	if user.Id == target.Id {
+		return structures.ErrCannotFollowSelf
+	}
+
+	err := frs.dbService.UpdateUserById(user.Id, bson.M{"$addToSet": bson.M{"blocked": target.Id}})
+	if err != nil {
+		return err
+	}
+
+	if !user.HasBlocked(target) {
+		user.Blocked = append(user.Blocked, target.Id)
+	}
+
+	_, err = frs.dbService.collection(FollowCollectionName).DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"follower_id": user.Id, "followee_id": target.Id},
+		bson.M{"follower_id": target.Id, "followee_id": user.Id},
+	}})
+
+	return err
+}
+
+// Unblock lets the target see and follow the user again. Earlier follows aren't restored.
+func (frs *FriendService) Unblock(ctx context.Context, user *structures.User, targetId string) error {
+	err := frs.dbService.UpdateUserById(user.Id, bson.M{"$pull": bson.M{"blocked": targetId}})
+	if err != nil {
+		return err
+	}
+
+	user.Blocked = slices.DeleteFunc(user.Blocked, func(id string) bool { return id == targetId })
+
+	return nil
+}
+
+// DeleteAllByUser removes the user's follows both ways, and the user from everyone's block lists.
+func (frs *FriendService) DeleteAllByUser(ctx context.Context, userId string) error {
+	_, err := frs.dbService.collection(FollowCollectionName).DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"follower_id": userId},
+		bson.M{"followee_id": userId},
+	}})
+	if err != nil {
+		return err
+	}
+
+	_, err = frs.dbService.collection(UserCollectionName).UpdateMany(ctx,
+		bson.M{"blocked": userId}, bson.M{"$pull": bson.M{"blocked": userId}})
+
+	return err
+}
+
+// followerSet returns the IDs of the users following the user.
+func (frs *FriendService) followerSet(ctx context.Context, userId string) (map[string]bool, error) {
+	cursor, err := frs.dbService.collection(FollowCollectionName).Find(ctx, bson.M{"followee_id": userId},
+		options.Find().SetProjection(bson.M{"follower_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var follows []structures.Follow
+	err = cursor.All(ctx, &follows)
+	if err != nil {
+		return nil, err
+	}
+
+	followers := make(map[string]bool, len(follows))
+	for _, follow := range follows {
+		followers[follow.FollowerId] = true
+	}
+
+	return followers, nil
+}
@@ -5,8 +5,12 @@ import (
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/argon2"
 
@@ -25,16 +29,90 @@ type HashParams struct {
 	keyLength   uint32
 }
 
-func (hs *HashService) Init(ctx context.Context) {
-	params := &HashParams{
+// DefaultHashParams returns the Argon2id parameters used when none are configured.
+func DefaultHashParams() *HashParams {
+	return &HashParams{
 		memory:      64 * 1024,
 		iterations:  3,
 		parallelism: 2,
 		saltLength:  16,
 		keyLength:   32,
 	}
+}
+
+// Init reads the Argon2id parameters from ARGON2_MEMORY (in KiB), ARGON2_ITERATIONS
+// and ARGON2_PARALLELISM, falling back to DefaultHashParams for any that are unset or empty.
+func (hs *HashService) Init(ctx context.Context) error {
+	params := DefaultHashParams()
+
+	if value := os.Getenv("ARGON2_MEMORY"); value != "" {
+		memory, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid ARGON2_MEMORY environment variable: %w", err)
+		}
+		params.memory = uint32(memory)
+	}
+
+	if value := os.Getenv("ARGON2_ITERATIONS"); value != "" {
+		iterations, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid ARGON2_ITERATIONS environment variable: %w", err)
+		}
+		params.iterations = uint32(iterations)
+	}
+
+	if value := os.Getenv("ARGON2_PARALLELISM"); value != "" {
+		parallelism, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return fmt.Errorf("invalid ARGON2_PARALLELISM environment variable: %w", err)
+		}
+		params.parallelism = uint8(parallelism)
+	}
+
+	if params.memory == 0 || params.iterations == 0 || params.parallelism == 0 {
+		return errors.New("argon2 parameters must be greater than zero")
+	}
 
 	hs.params = params
+
+	return nil
+}
+
+// Environment returns the parameters as the environment variables read by Init.
+func (p *HashParams) Environment() []string {
+	return []string{
+		fmt.Sprintf("ARGON2_MEMORY=%d", p.memory),
+		fmt.Sprintf("ARGON2_ITERATIONS=%d", p.iterations),
+		fmt.Sprintf("ARGON2_PARALLELISM=%d", p.parallelism),
+	}
+}
+
+// CalibrateHashParams picks Argon2id parameters that take at least the target duration
+// to hash a password on the current machine.
+// Memory and parallelism are fixed; iterations are raised until the target is reached.
+func CalibrateHashParams(target time.Duration, memory uint32, parallelism uint8) *HashParams {
+	params := DefaultHashParams()
+	params.memory = memory
+	params.parallelism = parallelism
+	params.iterations = 1
+
+	password := []byte("calibration-password")
+	salt := make([]byte, params.saltLength)
+
+	for {
+		start := time.Now()
+		argon2.IDKey(password, salt, params.iterations, params.memory, params.parallelism, params.keyLength)
+		elapsed := time.Since(start)
+
+		if elapsed >= target {
+			return params
+		}
+
+		// Iterations scale roughly linearly, so jump straight to the estimate.
+		perIteration := elapsed / time.Duration(params.iterations)
+		next := uint32(target / max(perIteration, time.Microsecond))
+		params.iterations = max(next, params.iterations+1)
+	}
 }
 
 func (hs *HashService) HashPassword(password string) (encodedHash string, err error) {
@@ -89,6 +167,21 @@ func (hs *HashService) ComparePasswordAndHash(encodedHash string, password strin
 	return false, nil
 }
 
+// NeedsRehash reports whether the encoded hash was created with weaker parameters
+// than the ones currently configured, in which case the password should be hashed again.
+func (hs *HashService) NeedsRehash(encodedHash string) (bool, error) {
+	p, _, _, err := hs.decodeHash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	return p.memory < hs.params.memory ||
+		p.iterations < hs.params.iterations ||
+		p.parallelism < hs.params.parallelism ||
+		p.saltLength < hs.params.saltLength ||
+		p.keyLength < hs.params.keyLength, nil
+}
+
 func (hs *HashService) decodeHash(encodedHash string) (params *HashParams, alt, hash []byte, err error) {
 	vals := strings.Split(encodedHash, "$")
 	if len(vals) != 6 {
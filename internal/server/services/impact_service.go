@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"unreal.sh/echo/config"
+	"unreal.sh/echo/internal/structures"
+)
+
+// platformImpactCacheTime is how long the platform-wide impact is reused before being recomputed.
+const platformImpactCacheTime = 5 * time.Minute
+
+// ImpactService estimates the environmental impact of claims, from a table of factors per
+// disposal type read from IMPACT_FACTORS_FILE, or the defaults in config/impact_factors.json.
+type ImpactService struct {
+	factors map[structures.DisposalType]structures.ImpactFactor
+
+	mu               sync.Mutex
+	platformImpact   structures.Impact
+	platformImpactAt time.Time
+
+	dbService *DatabaseService
+}
+
+func (is *ImpactService) Init(ctx context.Context, dbService *DatabaseService) error {
+	is.dbService = dbService
+
+	data := config.ImpactFactors
+
+	if path := os.Getenv("IMPACT_FACTORS_FILE"); path != "" {
+		file, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		data = file
+	}
+
+	var factors []structures.ImpactFactor
+	err := json.Unmarshal(data, &factors)
+	if err != nil {
+		return fmt.Errorf("invalid impact factors: %w", err)
+	}
+
+	is.factors = make(map[structures.DisposalType]structures.ImpactFactor)
+	for _, factor := range factors {
+		is.factors[factor.DisposalType] = factor
+	}
+
+	return nil
+}
+
+// Compute returns the impact of recycling the given disposals, whose weight is in grams.
+// Disposal types without a factor have no impact.
+func (is *ImpactService) Compute(disposals []structures.Disposal) structures.Impact {
+	var impact structures.Impact
+
+	for _, disposal := range disposals {
+		factor := is.factors[disposal.DisposalType]
+		kilograms := float64(disposal.Weight) / 1000
+
+		impact = impact.Add(structures.Impact{
+			Co2e:   factor.Co2ePerKg * kilograms,
+			Energy: factor.EnergyPerKg * kilograms,
+			Water:  factor.WaterPerKg * kilograms,
+		})
+	}
+
+	return impact
+}
+
+// GetUserImpact adds up the impact stored on every claim of the user.
+func (is *ImpactService) GetUserImpact(ctx context.Context, userId string) (structures.Impact, error) {
+	return is.sumImpact(ctx, bson.M{"user_id": userId, "is_claimed": true})
+}
+
+// GetPlatformImpact adds up the impact stored on every claim. It is cached for a few minutes.
+func (is *ImpactService) GetPlatformImpact(ctx context.Context) (structures.Impact, error) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	if time.Since(is.platformImpactAt) < platformImpactCacheTime {
+		return is.platformImpact, nil
+	}
+
+	impact, err := is.sumImpact(ctx, bson.M{"is_claimed": true})
+	if err != nil {
+		return impact, err
+	}
+
+	is.platformImpact = impact
+	is.platformImpactAt = time.Now()
+
+	return impact, nil
+}
+
+func (is *ImpactService) sumImpact(ctx context.Context, filter bson.M) (structures.Impact, error) {
+	cursor, err := is.dbService.collection(DisposalCollectionName).Aggregate(ctx, bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$group": bson.M{
+			"_id":        nil,
+			"co2e_kg":    bson.M{"$sum": "$impact.co2e_kg"},
+			"energy_kwh": bson.M{"$sum": "$impact.energy_kwh"},
+			"water_l":    bson.M{"$sum": "$impact.water_l"},
+		}},
+	})
+	if err != nil {
+		return structures.Impact{}, err
+	}
+
+	var result []structures.Impact
+	err = cursor.All(ctx, &result)
+	if err != nil || len(result) == 0 {
+		return structures.Impact{}, err
+	}
+
+	return result[0], nil
+}
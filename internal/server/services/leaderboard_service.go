@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
+)
+
+const LeaderboardCollectionName = "leaderboards"
+const LeaderboardEntryCollectionName = "leaderboard_entries"
+
+var leaderboardGroups = []structures.LeaderboardGroup{structures.GROUP_USERS, structures.GROUP_TEAMS}
+
+var leaderboardMetrics = []structures.LeaderboardMetric{structures.METRIC_CREDITS, structures.METRIC_WEIGHT}
+
+var leaderboardPeriods = []structures.LeaderboardPeriod{
+	structures.PERIOD_WEEKLY,
+	structures.PERIOD_MONTHLY,
+	structures.PERIOD_ALL_TIME,
+}
+
+var leaderboardDisposalTypes = []structures.DisposalType{
+	structures.RECYCLABLE,
+	structures.BATTERY,
+	structures.SPONGE,
+	structures.ELECTRONIC,
+}
+
+// LeaderboardService ranks users and teams by what they recycled. Rankings are precomputed
+// with aggregations over claimed disposals, for every combination of metric, period,
+// disposal type and region, and refreshed periodically.
+type LeaderboardService struct {
+	refreshInterval time.Duration
+
+	dbService      *DatabaseService
+	profileService *ProfileService
+	teamService    *TeamService
+}
+
+// Init reads the refresh interval, in minutes, from LEADERBOARD_REFRESH_MINUTES, defaulting to 10.
+func (ls *LeaderboardService) Init(ctx context.Context, dbService *DatabaseService, profileService *ProfileService,
+	teamService *TeamService) error {
+	minutes, err := strconv.Atoi(utils.GetenvOr("LEADERBOARD_REFRESH_MINUTES", "10"))
+	if err != nil || minutes <= 0 {
+		return errors.New("invalid LEADERBOARD_REFRESH_MINUTES environment variable")
+	}
+
+	ls.refreshInterval = time.Duration(minutes) * time.Minute
+
+	ls.dbService = dbService
+	ls.profileService = profileService
+	ls.teamService = teamService
+
+	_, err = dbService.collection(LeaderboardEntryCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "board", Value: 1}, {Key: "generation", Value: 1}, {Key: "rank", Value: 1}}},
+		{Keys: bson.D{{Key: "board", Value: 1}, {Key: "generation", Value: 1}, {Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "board", Value: 1}, {Key: "generation", Value: 1}, {Key: "team_id", Value: 1}}},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create leaderboard indexes: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// RefreshInterval is how often the leaderboards should be refreshed.
+func (ls *LeaderboardService) RefreshInterval() time.Duration {
+	return ls.refreshInterval
+}
+
+// Refresh recomputes every leaderboard.
+func (ls *LeaderboardService) Refresh(ctx context.Context) error {
+	regions, err := ls.dbService.collection(DisposalCollectionName).Distinct(ctx, "region",
+		bson.M{"is_claimed": true, "region": bson.M{"$nin": bson.A{nil, ""}}})
+	if err != nil {
+		return err
+	}
+
+	regionNames := []string{""}
+	for _, region := range regions {
+		if name, ok := region.(string); ok {
+			regionNames = append(regionNames, name)
+		}
+	}
+
+	disposalTypes := []*structures.DisposalType{nil}
+	for i := range leaderboardDisposalTypes {
+		disposalTypes = append(disposalTypes, &leaderboardDisposalTypes[i])
+	}
+
+	now := time.Now()
+
+	for _, group := range leaderboardGroups {
+		for _, metric := range leaderboardMetrics {
+			for _, period := range leaderboardPeriods {
+				for _, disposalType := range disposalTypes {
+					for _, region := range regionNames {
+						board := structures.Leaderboard{
+							Id:           leaderboardKey(group, metric, period, disposalType, region),
+							Group:        group,
+							Metric:       metric,
+							Period:       period,
+							DisposalType: disposalType,
+							Region:       region,
+							PeriodStart:  periodStart(period, now).Unix(),
+						}
+
+						err = ls.refreshBoard(ctx, &board)
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+
+	fmt.Printf("Refreshed leaderboards in %v.\n", time.Since(now))
+
+	return nil
+}
+
+// Get returns the top entries of a leaderboard, and the viewer's own entry, or their team's.
+// Users the viewer isn't allowed to see keep their rank, but are shown as hidden.
+func (ls *LeaderboardService) Get(ctx context.Context, viewer *structures.User, group structures.LeaderboardGroup,
+	metric structures.LeaderboardMetric, period structures.LeaderboardPeriod, disposalType *structures.DisposalType,
+	region string, limit int) (*structures.Leaderboard, []structures.LeaderboardEntry, *structures.LeaderboardEntry, error) {
+	board := structures.Leaderboard{
+		Id:           leaderboardKey(group, metric, period, disposalType, region),
+		Group:        group,
+		Metric:       metric,
+		Period:       period,
+		DisposalType: disposalType,
+		Region:       region,
+	}
+
+	err := ls.dbService.collection(LeaderboardCollectionName).FindOne(ctx, bson.M{"_id": board.Id}).Decode(&board)
+	if err == mongo.ErrNoDocuments {
+		// Not computed yet, or nothing to rank.
+		return &board, []structures.LeaderboardEntry{}, nil, nil
+	} else if err != nil {
+		return nil, nil, nil, err
+	}
+
+	entries := ls.dbService.collection(LeaderboardEntryCollectionName)
+	filter := bson.M{"board": board.Id, "generation": board.Generation}
+
+	cursor, err := entries.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "rank", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	top := []structures.LeaderboardEntry{}
+	err = cursor.All(ctx, &top)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var me *structures.LeaderboardEntry
+	var own structures.LeaderboardEntry
+
+	if group == structures.GROUP_TEAMS {
+		filter["team_id"] = viewer.TeamId
+	} else {
+		filter["user_id"] = viewer.Id
+	}
+
+	if group != structures.GROUP_TEAMS || viewer.TeamId != "" {
+		err = entries.FindOne(ctx, filter).Decode(&own)
+		if err == nil {
+			me = &own
+		} else if err != mongo.ErrNoDocuments {
+			return nil, nil, nil, err
+		}
+	}
+
+	if group == structures.GROUP_TEAMS {
+		err = ls.describeTeams(ctx, top, me)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return &board, top, me, nil
+	}
+
+	userIds := utils.Map(top, func(e structures.LeaderboardEntry, i int) string { return e.UserId })
+
+	users, err := ls.dbService.GetUsersByIds(userIds)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for i := range top {
+		ls.describe(viewer, &top[i], users[top[i].UserId])
+	}
+
+	if me != nil {
+		ls.describe(viewer, me, viewer)
+	}
+
+	return &board, top, me, nil
+}
+
+// describe names the user of an entry, if the viewer is allowed to see them.
+func (ls *LeaderboardService) describe(viewer *structures.User, entry *structures.LeaderboardEntry, user *structures.User) {
+	if user == nil || !ls.profileService.CanView(viewer, user) {
+		entry.Hidden = true
+		return
+	}
+
+	entry.Name = user.Name
+	entry.Username = user.Username
+}
+
+// describeTeams names the teams of the given entries. Teams deleted since the leaderboard
+// was computed are shown as hidden.
+func (ls *LeaderboardService) describeTeams(ctx context.Context, top []structures.LeaderboardEntry,
+	me *structures.LeaderboardEntry) error {
+	teamIds := utils.Map(top, func(e structures.LeaderboardEntry, i int) string { return e.TeamId })
+	if me != nil {
+		teamIds = append(teamIds, me.TeamId)
+	}
+
+	names, err := ls.teamService.GetNames(ctx, teamIds)
+	if err != nil {
+		return err
+	}
+
+	describe := func(entry *structures.LeaderboardEntry) {
+		name, found := names[entry.TeamId]
+		entry.Name = name
+		entry.Hidden = !found
+	}
+
+	for i := range top {
+		describe(&top[i])
+	}
+
+	if me != nil {
+		describe(me)
+	}
+
+	return nil
+}
+
+// refreshBoard ranks users or teams for a single leaderboard into a new generation of entries,
+// then switches the board over to it and removes the previous one.
+func (ls *LeaderboardService) refreshBoard(ctx context.Context, board *structures.Leaderboard) error {
+	board.Generation = primitive.NewObjectID().Hex()
+	board.ComputedAt = time.Now().Unix()
+
+	// Claims made outside of a team don't count towards any team.
+	groupField := "user_id"
+	match := bson.M{"is_claimed": true}
+	if board.Group == structures.GROUP_TEAMS {
+		groupField = "team_id"
+		match["team_id"] = bson.M{"$exists": true}
+	}
+
+	if board.Period != structures.PERIOD_ALL_TIME {
+		match["claimed_at"] = bson.M{"$gte": board.PeriodStart}
+	}
+	if board.Region != "" {
+		match["region"] = board.Region
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": match},
+		bson.M{"$unwind": "$disposals"},
+	}
+
+	if board.DisposalType != nil {
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"disposals.disposaltype": *board.DisposalType}})
+	}
+
+	pipeline = append(pipeline,
+		bson.M{"$group": bson.M{"_id": "$" + groupField, "value": bson.M{"$sum": "$disposals." + string(board.Metric)}}},
+		bson.M{"$setWindowFields": bson.M{
+			"sortBy": bson.M{"value": -1},
+			"output": bson.M{"rank": bson.M{"$rank": bson.M{}}},
+		}},
+		bson.M{"$project": bson.M{
+			"_id":        0,
+			"board":      board.Id,
+			"generation": board.Generation,
+			groupField:   "$_id",
+			"rank":       1,
+			"value":      1,
+		}},
+		bson.M{"$merge": bson.M{"into": LeaderboardEntryCollectionName, "whenNotMatched": "insert"}},
+	)
+
+	cursor, err := ls.dbService.collection(DisposalCollectionName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	cursor.Close(ctx)
+
+	_, err = ls.dbService.collection(LeaderboardCollectionName).ReplaceOne(ctx, bson.M{"_id": board.Id}, board,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	_, err = ls.dbService.collection(LeaderboardEntryCollectionName).DeleteMany(ctx,
+		bson.M{"board": board.Id, "generation": bson.M{"$ne": board.Generation}})
+
+	return err
+}
+
+// leaderboardKey identifies the leaderboard for a combination of filters.
+// Keys of user leaderboards have no group prefix, as they predate team ones.
+func leaderboardKey(group structures.LeaderboardGroup, metric structures.LeaderboardMetric,
+	period structures.LeaderboardPeriod, disposalType *structures.DisposalType, region string) string {
+	typeKey := "all"
+	if disposalType != nil {
+		typeKey = strconv.Itoa(int(*disposalType))
+	}
+
+	key := fmt.Sprintf("%s:%s:%s:%s", metric, period, typeKey, region)
+	if group == structures.GROUP_TEAMS {
+		key = string(group) + ":" + key
+	}
+
+	return key
+}
+
+// periodStart returns when the period containing t started: the last Monday for
+// weekly leaderboards, and the first of the month for monthly ones, both in UTC.
+func periodStart(period structures.LeaderboardPeriod, t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch period {
+	case structures.PERIOD_WEEKLY:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case structures.PERIOD_MONTHLY:
+		return day.AddDate(0, 0, 1-day.Day())
+	default:
+		return time.Unix(0, 0)
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+const LoginAttemptCollectionName = "login_attempts"
+
+// LoginAttemptStore keeps the failed login counters used by LoginThrottleService.
+// Records are forgotten once their ExpiresAt has passed.
+type LoginAttemptStore interface {
+	// Get returns the attempts for the key, or the zero value if there are none.
+	Get(ctx context.Context, key string) (structures.LoginAttempts, error)
+
+	// RecordFailure increments the failures for the key, extends its expiry to expiresAt,
+	// and returns the updated attempts.
+	RecordFailure(ctx context.Context, key string, expiresAt time.Time) (structures.LoginAttempts, error)
+
+	// Lock prevents logins for the key until the given time.
+	Lock(ctx context.Context, key string, until time.Time) error
+
+	// Reset forgets every failure for the key.
+	Reset(ctx context.Context, key string) error
+}
+
+// MemoryLoginAttemptStore is a LoginAttemptStore for a single replica.
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]structures.LoginAttempts
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]structures.LoginAttempts)}
+}
+
+func (ms *MemoryLoginAttemptStore) Get(ctx context.Context, key string) (structures.LoginAttempts, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.get(key), nil
+}
+
+func (ms *MemoryLoginAttemptStore) RecordFailure(ctx context.Context, key string, expiresAt time.Time) (structures.LoginAttempts, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	attempts := ms.get(key)
+	attempts.Key = key
+	attempts.Failures++
+	attempts.ExpiresAt = expiresAt
+	ms.attempts[key] = attempts
+
+	return attempts, nil
+}
+
+func (ms *MemoryLoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	attempts := ms.get(key)
+	attempts.Key = key
+	attempts.LockedUntil = until
+	if attempts.ExpiresAt.Before(until) {
+		attempts.ExpiresAt = until
+	}
+	ms.attempts[key] = attempts
+
+	return nil
+}
+
+func (ms *MemoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.attempts, key)
+
+	return nil
+}
+
+// get returns the unexpired attempts for the key. The caller must hold the lock.
+func (ms *MemoryLoginAttemptStore) get(key string) structures.LoginAttempts {
+	attempts, found := ms.attempts[key]
+	if found && time.Now().After(attempts.ExpiresAt) {
+		delete(ms.attempts, key)
+		return structures.LoginAttempts{}
+	}
+
+	return attempts
+}
+
+// MongoLoginAttemptStore is a LoginAttemptStore shared by every replica.
+// Expired records are removed by a TTL index.
+type MongoLoginAttemptStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoLoginAttemptStore(ctx context.Context, dbService *DatabaseService) (*MongoLoginAttemptStore, error) {
+	collection := dbService.collection(LoginAttemptCollectionName)
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		fmt.Printf("Failed to create login attempts TTL index: %v\n", err)
+		return nil, err
+	}
+
+	return &MongoLoginAttemptStore{collection: collection}, nil
+}
+
+func (ms *MongoLoginAttemptStore) Get(ctx context.Context, key string) (structures.LoginAttempts, error) {
+	var result structures.LoginAttempts
+
+	// The TTL monitor only runs once a minute, so expired records may still be around.
+	filter := bson.M{"_id": key, "expires_at": bson.M{"$gt": time.Now()}}
+
+	err := ms.collection.FindOne(ctx, filter).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return structures.LoginAttempts{}, nil
+	} else if err != nil {
+		return structures.LoginAttempts{}, err
+	}
+
+	return result, nil
+}
+
+func (ms *MongoLoginAttemptStore) RecordFailure(ctx context.Context, key string, expiresAt time.Time) (structures.LoginAttempts, error) {
+	var result structures.LoginAttempts
+
+	// Restart the count if the previous record expired but wasn't removed yet.
+	update := bson.A{bson.M{"$set": bson.M{
+		"failures": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{"$expires_at", time.Now()}},
+			bson.M{"$add": bson.A{"$failures", 1}},
+			1,
+		}},
+		"locked_until": bson.M{"$ifNull": bson.A{"$locked_until", time.Time{}}},
+		"expires_at":   expiresAt,
+	}}}
+
+	err := ms.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&result)
+	if err != nil {
+		return structures.LoginAttempts{}, err
+	}
+
+	return result, nil
+}
+
+func (ms *MongoLoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	update := bson.A{bson.M{"$set": bson.M{
+		"locked_until": until,
+		"expires_at":   bson.M{"$max": bson.A{"$expires_at", until}},
+	}}}
+
+	_, err := ms.collection.UpdateOne(ctx, bson.M{"_id": key}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (ms *MongoLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	_, err := ms.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"unreal.sh/echo/internal/utils"
+)
+
+// throttlePolicy decides how many failures a key gets for free, and when it is locked out.
+type throttlePolicy struct {
+	freeFailures     int
+	lockoutThreshold int
+}
+
+var (
+	usernamePolicy = throttlePolicy{freeFailures: 3, lockoutThreshold: 10}
+
+	// IP addresses are shared by schools and offices, so they get more leeway.
+	ipPolicy = throttlePolicy{freeFailures: 10, lockoutThreshold: 50}
+)
+
+const (
+	// baseLoginDelay is the delay after the first failure past the free ones; it doubles after each one.
+	baseLoginDelay = 1 * time.Second
+
+	// maxLoginDelay is the longest backoff before a key reaches its lockout threshold.
+	maxLoginDelay = 5 * time.Minute
+
+	// lockoutDuration is how long a locked out key stays locked.
+	lockoutDuration = 15 * time.Minute
+
+	// failureWindow is how long failures are remembered after the last one.
+	failureWindow = 1 * time.Hour
+)
+
+// LoginThrottleService slows down and locks out password guessing,
+// counting failures per username and per IP address.
+type LoginThrottleService struct {
+	store  LoginAttemptStore
+	logger *zap.SugaredLogger
+}
+
+// Init selects the store from LOGIN_ATTEMPT_STORE, either "mongo" (default) or "memory".
+func (lts *LoginThrottleService) Init(ctx context.Context, dbService *DatabaseService, logger *zap.SugaredLogger) error {
+	lts.logger = logger
+
+	switch kind := utils.GetenvOr("LOGIN_ATTEMPT_STORE", "mongo"); kind {
+	case "memory":
+		lts.store = NewMemoryLoginAttemptStore()
+	case "mongo":
+		store, err := NewMongoLoginAttemptStore(ctx, dbService)
+		if err != nil {
+			return err
+		}
+		lts.store = store
+	default:
+		return fmt.Errorf("invalid LOGIN_ATTEMPT_STORE environment variable: %s", kind)
+	}
+
+	return nil
+}
+
+// RetryAfter returns how long the client has to wait before trying to log in as username from ip.
+// It returns zero if the attempt is allowed.
+func (lts *LoginThrottleService) RetryAfter(ctx context.Context, username string, ip string) (time.Duration, error) {
+	var wait time.Duration
+
+	for _, key := range throttleKeys(username, ip) {
+		attempts, err := lts.store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+
+		wait = max(wait, time.Until(attempts.LockedUntil))
+	}
+
+	return max(wait, 0), nil
+}
+
+// RecordFailure counts a failed login and applies the backoff, locking the key out past its threshold.
+func (lts *LoginThrottleService) RecordFailure(ctx context.Context, username string, ip string) error {
+	keys := throttleKeys(username, ip)
+	policies := []throttlePolicy{usernamePolicy, ipPolicy}
+
+	for i, key := range keys {
+		policy := policies[i]
+
+		attempts, err := lts.store.RecordFailure(ctx, key, time.Now().Add(failureWindow))
+		if err != nil {
+			return err
+		}
+
+		if attempts.Failures <= policy.freeFailures {
+			continue
+		}
+
+		lockedOut := attempts.Failures >= policy.lockoutThreshold
+
+		delay := lockoutDuration
+		if !lockedOut {
+			// Cap the exponent so the shift can't overflow; the delay is capped below anyway.
+			exponent := min(attempts.Failures-policy.freeFailures-1, 20)
+			delay = min(baseLoginDelay<<exponent, maxLoginDelay)
+		}
+
+		err = lts.store.Lock(ctx, key, time.Now().Add(delay))
+		if err != nil {
+			return err
+		}
+
+		// Failures past the threshold renew the lockout, so each of them is logged too.
+		if lockedOut {
+			lts.logger.Warnw("Login locked out after repeated failures.",
+				"event", "login_lockout",
+				"key", key,
+				"username", username,
+				"ip", ip,
+				"failures", attempts.Failures,
+				"duration", lockoutDuration.String(),
+			)
+		}
+	}
+
+	return nil
+}
+
+// RecordSuccess resets the failures for the username.
+// The IP address counter is kept, so one valid account can't be used to keep guessing others.
+func (lts *LoginThrottleService) RecordSuccess(ctx context.Context, username string) error {
+	return lts.store.Reset(ctx, usernameKey(username))
+}
+
+func throttleKeys(username string, ip string) []string {
+	return []string{usernameKey(username), "ip:" + ip}
+}
+
+func usernameKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
@@ -0,0 +1,601 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
+)
+
+const MerchantCollectionName = "merchants"
+const OfferCollectionName = "offers"
+const VoucherCollectionName = "vouchers"
+const RedemptionCollectionName = "redemptions"
+
+// MerchantService runs the merchant side of Ecobucks: partner businesses define offers,
+// customers get vouchers for them or for an amount of credits, and merchants redeem
+// those vouchers at the point of sale, which takes the credits from the customer.
+type MerchantService struct {
+	voucherTtl time.Duration
+
+	dbService           *DatabaseService
+	notificationService *NotificationService
+}
+
+// Init reads how long vouchers stay valid, in minutes, from VOUCHER_TTL_MINUTES, defaulting to 15.
+func (mcs *MerchantService) Init(ctx context.Context, dbService *DatabaseService,
+	notificationService *NotificationService) error {
+	minutes, err := strconv.Atoi(utils.GetenvOr("VOUCHER_TTL_MINUTES", "15"))
+	if err != nil || minutes <= 0 {
+		return errors.New("invalid VOUCHER_TTL_MINUTES environment variable")
+	}
+
+	mcs.voucherTtl = time.Duration(minutes) * time.Minute
+	mcs.dbService = dbService
+	mcs.notificationService = notificationService
+
+	_, err = dbService.collection(OfferCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "merchant_id", Value: 1}, {Key: "active", Value: 1}},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create offer indexes: %v\n", err)
+		return err
+	}
+
+	// Redeemed vouchers are kept until they expire too; the redemption is the lasting record.
+	_, err = dbService.collection(VoucherCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create voucher indexes: %v\n", err)
+		return err
+	}
+
+	_, err = dbService.collection(RedemptionCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "merchant_id", Value: 1}, {Key: "redeemed_at", Value: -1}}},
+		{Keys: bson.D{{Key: "offer_id", Value: 1}}},
+		{Keys: bson.D{{Key: "voucher_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create redemption indexes: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// ListMerchants returns every merchant, by name.
+func (mcs *MerchantService) ListMerchants(ctx context.Context) ([]structures.Merchant, error) {
+	cursor, err := mcs.dbService.collection(MerchantCollectionName).Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	merchants := []structures.Merchant{}
+	err = cursor.All(ctx, &merchants)
+
+	return merchants, err
+}
+
+// GetMerchant returns the merchant with the given ID, or ErrNoMerchant.
+func (mcs *MerchantService) GetMerchant(ctx context.Context, id string) (*structures.Merchant, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, structures.ErrNoMerchant
+	}
+
+	var merchant structures.Merchant
+	err = mcs.dbService.collection(MerchantCollectionName).FindOne(ctx, bson.M{"_id": objectId}).Decode(&merchant)
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrNoMerchant
+	}
+
+	return &merchant, err
+}
+
+// CreateMerchant adds a merchant run by the given user.
+func (mcs *MerchantService) CreateMerchant(ctx context.Context, merchant *structures.Merchant,
+	owner *structures.User) error {
+	merchant.Id = ""
+	merchant.CreatedAt = time.Now().Unix()
+
+	res, err := mcs.dbService.collection(MerchantCollectionName).InsertOne(ctx, merchant)
+	if err != nil {
+		return err
+	}
+
+	merchant.Id = res.InsertedID.(primitive.ObjectID).Hex()
+
+	fmt.Printf("Created merchant %v.\n", merchant.Id)
+
+	return mcs.AddMember(ctx, merchant.Id, owner)
+}
+
+// AddMember makes the user part of the merchant's staff. A user works for one merchant at most,
+// so this moves them over from any other.
+func (mcs *MerchantService) AddMember(ctx context.Context, merchantId string, user *structures.User) error {
+	_, err := mcs.GetMerchant(ctx, merchantId)
+	if err != nil {
+		return err
+	}
+
+	err = mcs.dbService.UpdateUserById(user.Id, bson.M{"$set": bson.M{"merchant_id": merchantId}})
+	if err != nil {
+		return err
+	}
+
+	user.MerchantId = merchantId
+
+	fmt.Printf("Added user %v to merchant %v.\n", user.Id, merchantId)
+
+	return nil
+}
+
+// ListOffers returns the offers of a merchant, including inactive ones.
+func (mcs *MerchantService) ListOffers(ctx context.Context, merchantId string) ([]structures.Offer, error) {
+	return mcs.findOffers(ctx, bson.M{"merchant_id": merchantId})
+}
+
+// ListActiveOffers returns the offers customers can currently get vouchers for, with their merchant's name.
+func (mcs *MerchantService) ListActiveOffers(ctx context.Context) ([]structures.Offer, error) {
+	offers, err := mcs.findOffers(ctx, bson.M{"active": true})
+	if err != nil {
+		return nil, err
+	}
+
+	merchants, err := mcs.ListMerchants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(merchants))
+	for _, merchant := range merchants {
+		names[merchant.Id] = merchant.Name
+	}
+
+	for i := range offers {
+		offers[i].MerchantName = names[offers[i].MerchantId]
+	}
+
+	return offers, nil
+}
+
+func (mcs *MerchantService) findOffers(ctx context.Context, filter bson.M) ([]structures.Offer, error) {
+	cursor, err := mcs.dbService.collection(OfferCollectionName).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	offers := []structures.Offer{}
+	err = cursor.All(ctx, &offers)
+
+	return offers, err
+}
+
+// GetOffer returns the offer with the given ID, or ErrNoOffer.
+func (mcs *MerchantService) GetOffer(ctx context.Context, id string) (*structures.Offer, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, structures.ErrNoOffer
+	}
+
+	var offer structures.Offer
+	err = mcs.dbService.collection(OfferCollectionName).FindOne(ctx, bson.M{"_id": objectId}).Decode(&offer)
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrNoOffer
+	}
+
+	return &offer, err
+}
+
+// CreateOffer adds an offer to the merchant.
+func (mcs *MerchantService) CreateOffer(ctx context.Context, merchantId string, offer *structures.Offer) error {
+	offer.Id = ""
+	offer.MerchantId = merchantId
+	offer.CreatedAt = time.Now().Unix()
+
+	res, err := mcs.dbService.collection(OfferCollectionName).InsertOne(ctx, offer)
+	if err != nil {
+		return err
+	}
+
+	offer.Id = res.InsertedID.(primitive.ObjectID).Hex()
+
+	return nil
+}
+
+// UpdateOffer replaces one of the merchant's offers. Vouchers already issued keep their price.
+// When an inactive offer is made active again, the customers who redeemed it before are told.
+func (mcs *MerchantService) UpdateOffer(ctx context.Context, merchantId string, id string,
+	offer *structures.Offer) error {
+	existing, err := mcs.GetOffer(ctx, id)
+	if err != nil {
+		return err
+	}
+	if existing.MerchantId != merchantId {
+		return structures.ErrNoOffer
+	}
+
+	objectId, _ := primitive.ObjectIDFromHex(id)
+
+	offer.Id = ""
+	offer.MerchantId = merchantId
+	offer.CreatedAt = existing.CreatedAt
+
+	res, err := mcs.dbService.collection(OfferCollectionName).ReplaceOne(ctx,
+		bson.M{"_id": objectId, "merchant_id": merchantId}, offer)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return structures.ErrNoOffer
+	}
+
+	offer.Id = id
+
+	if !existing.Active && offer.Active {
+		err = mcs.notifyRestocked(ctx, offer)
+		if err != nil {
+			fmt.Printf("Failed to notify customers of offer %v: %v\n", offer.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// notifyRestocked tells every customer who redeemed the offer before that it's available again.
+func (mcs *MerchantService) notifyRestocked(ctx context.Context, offer *structures.Offer) error {
+	userIds, err := mcs.dbService.collection(RedemptionCollectionName).Distinct(ctx, "user_id",
+		bson.M{"offer_id": offer.Id})
+	if err != nil {
+		return err
+	}
+
+	body := offer.Title + " is available again."
+	if merchant, err := mcs.GetMerchant(ctx, offer.MerchantId); err == nil {
+		body = fmt.Sprintf("%s is available again at %s.", offer.Title, merchant.Name)
+	}
+
+	for _, userId := range userIds {
+		id, ok := userId.(string)
+		if !ok {
+			continue
+		}
+
+		err = mcs.notificationService.Notify(ctx, id, &structures.Notification{
+			Category: structures.NOTIFY_REWARDS,
+			Title:    "Back in stock",
+			Body:     body,
+			Data:     map[string]string{"offer_id": offer.Id},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteOffer removes one of the merchant's offers. Vouchers already issued for it can still be redeemed.
+func (mcs *MerchantService) DeleteOffer(ctx context.Context, merchantId string, id string) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return structures.ErrNoOffer
+	}
+
+	res, err := mcs.dbService.collection(OfferCollectionName).DeleteOne(ctx,
+		bson.M{"_id": objectId, "merchant_id": merchantId})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return structures.ErrNoOffer
+	}
+
+	return nil
+}
+
+// IssueVoucher gives the user a voucher for an active offer, or for an amount of credits when
+// offerId is empty. The user must have enough credits now, but they are only taken on redemption.
+func (mcs *MerchantService) IssueVoucher(ctx context.Context, user *structures.User, offerId string,
+	credits float32) (*structures.Voucher, error) {
+	now := time.Now()
+
+	voucher := structures.Voucher{
+		Code:      randomUrlString(24),
+		UserId:    user.Id,
+		Credits:   credits,
+		Status:    structures.VOUCHER_ISSUED,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(mcs.voucherTtl),
+	}
+
+	if offerId != "" {
+		offer, err := mcs.GetOffer(ctx, offerId)
+		if err != nil {
+			return nil, err
+		}
+		if !offer.Active {
+			return nil, structures.ErrNoOffer
+		}
+
+		voucher.OfferId = offer.Id
+		voucher.OfferTitle = offer.Title
+		voucher.MerchantId = offer.MerchantId
+		voucher.Credits = offer.Credits
+	}
+
+	if voucher.Credits <= 0 {
+		return nil, structures.ErrNoOffer
+	}
+
+	if user.Credits < float64(voucher.Credits) {
+		return nil, structures.ErrInsufficientCredits
+	}
+
+	res, err := mcs.dbService.collection(VoucherCollectionName).InsertOne(ctx, voucher)
+	if err != nil {
+		return nil, err
+	}
+
+	voucher.Id = res.InsertedID.(primitive.ObjectID).Hex()
+
+	return &voucher, nil
+}
+
+// ListVouchers returns the user's vouchers that can still be redeemed, latest first.
+func (mcs *MerchantService) ListVouchers(ctx context.Context, userId string) ([]structures.Voucher, error) {
+	cursor, err := mcs.dbService.collection(VoucherCollectionName).Find(ctx,
+		bson.M{"user_id": userId, "status": structures.VOUCHER_ISSUED, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	vouchers := []structures.Voucher{}
+	err = cursor.All(ctx, &vouchers)
+
+	return vouchers, err
+}
+
+// ValidateVoucher returns the voucher with the given code if the merchant could redeem it now,
+// and ErrNoVoucher otherwise.
+func (mcs *MerchantService) ValidateVoucher(ctx context.Context, merchantId string,
+	code string) (*structures.Voucher, error) {
+	var voucher structures.Voucher
+
+	err := mcs.dbService.collection(VoucherCollectionName).FindOne(ctx, redeemableVoucher(merchantId, code)).
+		Decode(&voucher)
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrNoVoucher
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &voucher, nil
+}
+
+// Redeem burns the voucher with the given code at the staff member's merchant: the voucher is
+// used up, its credits are taken from the customer with a SPEND transaction, and a redemption
+// is recorded for the merchant. It returns ErrNoVoucher if the voucher can't be redeemed there,
+// and ErrInsufficientCredits if the customer spent their credits since it was issued.
+func (mcs *MerchantService) Redeem(ctx context.Context, staff *structures.User,
+	code string) (*structures.Redemption, error) {
+	vouchers := mcs.dbService.collection(VoucherCollectionName)
+	now := time.Now().Unix()
+
+	// Marking the voucher as redeemed first means a code scanned twice is only burned once.
+	var voucher structures.Voucher
+	err := vouchers.FindOneAndUpdate(ctx, redeemableVoucher(staff.MerchantId, code),
+		bson.M{"$set": bson.M{"status": structures.VOUCHER_REDEEMED}}).Decode(&voucher)
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrNoVoucher
+	} else if err != nil {
+		return nil, err
+	}
+
+	voucherId, _ := primitive.ObjectIDFromHex(voucher.Id)
+
+	release := func() {
+		_, err := vouchers.UpdateOne(ctx, bson.M{"_id": voucherId},
+			bson.M{"$set": bson.M{"status": structures.VOUCHER_ISSUED}})
+		if err != nil {
+			fmt.Printf("Failed to release voucher %v: %v\n", voucher.Id, err)
+		}
+	}
+
+	redemption := structures.Redemption{
+		MerchantId: staff.MerchantId,
+		VoucherId:  voucher.Id,
+		OfferId:    voucher.OfferId,
+		OfferTitle: voucher.OfferTitle,
+		UserId:     voucher.UserId,
+		Credits:    voucher.Credits,
+		RedeemedAt: now,
+		RedeemedBy: staff.Id,
+	}
+
+	// The redemption is recorded before the customer pays, so the merchant is never left
+	// without a record of a payment, and removed again if the payment fails.
+	redemptions := mcs.dbService.collection(RedemptionCollectionName)
+
+	res, err := redemptions.InsertOne(ctx, redemption)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	redemptionId := res.InsertedID.(primitive.ObjectID)
+	redemption.Id = redemptionId.Hex()
+
+	err = mcs.spend(ctx, &redemption)
+	if err != nil {
+		_, deleteErr := redemptions.DeleteOne(ctx, bson.M{"_id": redemptionId})
+		if deleteErr != nil {
+			fmt.Printf("Failed to remove redemption %v: %v\n", redemption.Id, deleteErr)
+		}
+
+		release()
+		return nil, err
+	}
+
+	fmt.Printf("Merchant %v redeemed voucher %v for %v credits.\n", redemption.MerchantId, voucher.Id,
+		redemption.Credits)
+
+	return &redemption, nil
+}
+
+// spend takes the redemption's credits from the customer and adds the SPEND transaction to their
+// ledger, in a single update that only matches if they still have enough credits.
+func (mcs *MerchantService) spend(ctx context.Context, redemption *structures.Redemption) error {
+	userId, err := primitive.ObjectIDFromHex(redemption.UserId)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	description := "Spent at merchant"
+	if merchant, err := mcs.GetMerchant(ctx, redemption.MerchantId); err == nil {
+		description = "Spent at " + merchant.Name
+	}
+	if redemption.OfferTitle != "" {
+		description += ": " + redemption.OfferTitle
+	}
+
+	transaction := structures.Transaction{
+		TransactionType: structures.SPEND,
+		UserId:          redemption.UserId,
+		Credits:         redemption.Credits,
+		Timestamp:       redemption.RedeemedAt,
+		Description:     description,
+		RedemptionId:    redemption.Id,
+	}
+
+	res, err := mcs.dbService.collection(UserCollectionName).UpdateOne(ctx,
+		bson.M{"_id": userId, "credits": bson.M{"$gte": redemption.Credits}},
+		bson.M{
+			"$inc":  bson.M{"credits": -redemption.Credits},
+			"$push": bson.M{"transactions": transaction},
+		})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return structures.ErrInsufficientCredits
+	}
+
+	return nil
+}
+
+// ListRedemptions returns the merchant's redemptions made between from and to, latest first.
+// A zero to means up to now.
+func (mcs *MerchantService) ListRedemptions(ctx context.Context, merchantId string, from int64, to int64,
+	limit int) ([]structures.Redemption, error) {
+	cursor, err := mcs.dbService.collection(RedemptionCollectionName).Find(ctx,
+		bson.M{"merchant_id": merchantId, "redeemed_at": redemptionRange(from, to)},
+		options.Find().SetSort(bson.D{{Key: "redeemed_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	redemptions := []structures.Redemption{}
+	err = cursor.All(ctx, &redemptions)
+
+	return redemptions, err
+}
+
+// Settlements totals the merchant's redemptions made between from and to by day, week or month,
+// in UTC, latest first. Weeks start on Monday. A zero to means up to now.
+func (mcs *MerchantService) Settlements(ctx context.Context, merchantId string, period structures.SettlementPeriod,
+	from int64, to int64) ([]structures.Settlement, error) {
+	unit := map[structures.SettlementPeriod]string{
+		structures.SETTLEMENT_DAILY:   "day",
+		structures.SETTLEMENT_WEEKLY:  "week",
+		structures.SETTLEMENT_MONTHLY: "month",
+	}[period]
+
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"merchant_id": merchantId, "redeemed_at": redemptionRange(from, to)}},
+		bson.M{"$group": bson.M{
+			"_id": bson.M{"$dateTrunc": bson.M{
+				"date":        bson.M{"$toDate": bson.M{"$multiply": bson.A{"$redeemed_at", 1000}}},
+				"unit":        unit,
+				"startOfWeek": "monday",
+			}},
+			"redemptions": bson.M{"$sum": 1},
+			"credits":     bson.M{"$sum": "$credits"},
+		}},
+		bson.M{"$sort": bson.M{"_id": -1}},
+	}
+
+	cursor, err := mcs.dbService.collection(RedemptionCollectionName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var totals []struct {
+		PeriodStart time.Time `bson:"_id"`
+		Redemptions int       `bson:"redemptions"`
+		Credits     float64   `bson:"credits"`
+	}
+	err = cursor.All(ctx, &totals)
+	if err != nil {
+		return nil, err
+	}
+
+	settlements := make([]structures.Settlement, len(totals))
+	for i, total := range totals {
+		settlements[i] = structures.Settlement{
+			PeriodStart: total.PeriodStart.Unix(),
+			Redemptions: total.Redemptions,
+			Credits:     total.Credits,
+		}
+	}
+
+	return settlements, nil
+}
+
+// AnonymizeUser moves the user's redemptions over to their pseudonym, so merchants' settlements
+// stay correct, and removes their vouchers.
+func (mcs *MerchantService) AnonymizeUser(ctx context.Context, userId string, pseudonymId string) error {
+	_, err := mcs.dbService.collection(RedemptionCollectionName).UpdateMany(ctx, bson.M{"user_id": userId},
+		bson.M{"$set": bson.M{"user_id": pseudonymId}})
+	if err != nil {
+		return err
+	}
+
+	_, err = mcs.dbService.collection(VoucherCollectionName).DeleteMany(ctx, bson.M{"user_id": userId})
+
+	return err
+}
+
+// redeemableVoucher matches the voucher with the given code if the merchant can redeem it now:
+// it was neither redeemed nor expired, and is for one of the merchant's offers or for credits.
+func redeemableVoucher(merchantId string, code string) bson.M {
+	return bson.M{
+		"code":        code,
+		"status":      structures.VOUCHER_ISSUED,
+		"expires_at":  bson.M{"$gt": time.Now()},
+		"merchant_id": bson.M{"$in": bson.A{merchantId, nil}},
+	}
+}
+
+func redemptionRange(from int64, to int64) bson.M {
+	if to == 0 {
+		to = time.Now().Unix()
+	}
+
+	return bson.M{"$gte": from, "$lte": to}
+}
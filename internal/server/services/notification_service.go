@@ -0,0 +1,310 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
+)
+
+const NotificationCollectionName = "notifications"
+const DeviceCollectionName = "devices"
+
+const (
+	// notificationRetention is how long notifications stay in the inbox, read or not.
+	notificationRetention = 90 * 24 * time.Hour
+
+	pushTimeout = 10 * time.Second
+)
+
+// NotificationService tells users about things that happened to their account, through an
+// in-app inbox and push notifications to their registered devices, as each user chose for
+// every category.
+type NotificationService struct {
+	provider PushProvider
+
+	dbService *DatabaseService
+}
+
+// Init selects the push provider from PUSH_PROVIDER: "log" (default), which prints
+// notifications, or "file", which appends them to PUSH_FILE.
+func (ns *NotificationService) Init(ctx context.Context, dbService *DatabaseService) error {
+	switch kind := utils.GetenvOr("PUSH_PROVIDER", "log"); kind {
+	case "log":
+		ns.provider = NewLogPushProvider()
+	case "file":
+		path, found := os.LookupEnv("PUSH_FILE")
+		if !found {
+			return errors.New("PUSH_FILE is required when PUSH_PROVIDER is file")
+		}
+
+		provider, err := NewFilePushProvider(path)
+		if err != nil {
+			return err
+		}
+		ns.provider = provider
+	default:
+		return fmt.Errorf("invalid PUSH_PROVIDER environment variable: %s", kind)
+	}
+
+	ns.dbService = dbService
+
+	_, err := dbService.collection(NotificationCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create notification indexes: %v\n", err)
+		return err
+	}
+
+	_, err = dbService.collection(DeviceCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create device indexes: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Notify adds the notification to the user's inbox and pushes it to their devices, unless
+// they turned either off for its category. Push notifications are sent in the background,
+// and failures to send them are only logged.
+func (ns *NotificationService) Notify(ctx context.Context, userId string, notification *structures.Notification) error {
+	user, err := ns.dbService.GetUserById(userId)
+	if err == structures.ErrNoUser {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if user.IsDeleted {
+		return nil
+	}
+
+	preference := user.NotificationPreference(notification.Category)
+	now := time.Now()
+
+	notification.UserId = userId
+	notification.CreatedAt = now.Unix()
+
+	if preference.InApp {
+		expiresAt := now.Add(notificationRetention)
+		notification.ExpiresAt = &expiresAt
+
+		res, err := ns.dbService.collection(NotificationCollectionName).InsertOne(ctx, notification)
+		if err != nil {
+			return err
+		}
+
+		notification.Id = res.InsertedID.(primitive.ObjectID).Hex()
+	}
+
+	if preference.Push {
+		go ns.push(context.WithoutCancel(ctx), *notification)
+	}
+
+	return nil
+}
+
+// push sends the notification to every device of its user.
+func (ns *NotificationService) push(ctx context.Context, notification structures.Notification) {
+	devices, err := ns.ListDevices(ctx, notification.UserId)
+	if err != nil {
+		fmt.Printf("Failed to get devices of user %v: %v\n", notification.UserId, err)
+		return
+	}
+
+	for _, device := range devices {
+		sendCtx, cancel := context.WithTimeout(ctx, pushTimeout)
+		err := ns.provider.Send(sendCtx, &device, &notification)
+		cancel()
+
+		if err == structures.ErrNoDevice {
+			fmt.Printf("Removing device %v of user %v, which the push provider no longer knows.\n",
+				device.Id, device.UserId)
+
+			err = ns.RemoveDevice(ctx, device.UserId, device.Id)
+			if err != nil && err != structures.ErrNoDevice {
+				fmt.Printf("Failed to remove device %v: %v\n", device.Id, err)
+			}
+		} else if err != nil {
+			fmt.Printf("Failed to push notification to device %v: %v\n", device.Id, err)
+		}
+	}
+}
+
+// List returns the user's notifications, newest first, with the cursor of the following
+// page. When unreadOnly is set, only the ones not marked as read are returned.
+func (ns *NotificationService) List(ctx context.Context, userId string, unreadOnly bool, before string,
+	limit int) ([]structures.Notification, string, error) {
+	filter := bson.M{"user_id": userId}
+
+	if before != "" {
+		cursor, err := primitive.ObjectIDFromHex(before)
+		if err != nil {
+			return nil, "", structures.ErrInvalidDatabaseId
+		}
+		filter["_id"] = bson.M{"$lt": cursor}
+	}
+
+	if unreadOnly {
+		filter["read_at"] = bson.M{"$exists": false}
+	}
+
+	cursor, err := ns.dbService.collection(NotificationCollectionName).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	notifications := []structures.Notification{}
+	err = cursor.All(ctx, &notifications)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(notifications) == limit {
+		next = notifications[len(notifications)-1].Id
+	}
+
+	return notifications, next, nil
+}
+
+// CountUnread returns how many of the user's notifications aren't marked as read.
+func (ns *NotificationService) CountUnread(ctx context.Context, userId string) (int64, error) {
+	return ns.dbService.collection(NotificationCollectionName).CountDocuments(ctx,
+		bson.M{"user_id": userId, "read_at": bson.M{"$exists": false}})
+}
+
+// MarkRead marks one of the user's notifications as read. Marking it again keeps the time it
+// was first read.
+func (ns *NotificationService) MarkRead(ctx context.Context, userId string, id string) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return structures.ErrNoNotification
+	}
+
+	res, err := ns.dbService.collection(NotificationCollectionName).UpdateOne(ctx,
+		bson.M{"_id": objectId, "user_id": userId},
+		bson.A{bson.M{"$set": bson.M{"read_at": bson.M{"$ifNull": bson.A{"$read_at", time.Now().Unix()}}}}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return structures.ErrNoNotification
+	}
+
+	return nil
+}
+
+// MarkAllRead marks every unread notification of the user as read.
+func (ns *NotificationService) MarkAllRead(ctx context.Context, userId string) error {
+	_, err := ns.dbService.collection(NotificationCollectionName).UpdateMany(ctx,
+		bson.M{"user_id": userId, "read_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"read_at": time.Now().Unix()}})
+
+	return err
+}
+
+// Preferences returns the user's preference for every category.
+func (ns *NotificationService) Preferences(user *structures.User) []structures.NotificationPreference {
+	return utils.Map(structures.NotificationCategories,
+		func(category structures.NotificationCategory, i int) structures.NotificationPreference {
+			return user.NotificationPreference(category)
+		})
+}
+
+// UpdatePreference sets how the user wants to hear about a category.
+func (ns *NotificationService) UpdatePreference(user *structures.User,
+	preference structures.NotificationPreference) error {
+	return ns.dbService.UpdateUserById(user.Id, bson.M{"$set": bson.M{
+		"notification_preferences." + string(preference.Category): preference,
+	}})
+}
+
+// RegisterDevice registers a device of the user for push notifications. Registering a token
+// again updates its device, and moves it over if it belonged to another user, such as after
+// signing in with a different account on the same phone.
+func (ns *NotificationService) RegisterDevice(ctx context.Context, userId string, device *structures.Device) error {
+	device.UserId = userId
+	device.CreatedAt = time.Now().Unix()
+
+	var registered structures.Device
+	err := ns.dbService.collection(DeviceCollectionName).FindOneAndUpdate(ctx,
+		bson.M{"token": device.Token},
+		bson.M{"$set": bson.M{
+			"user_id":    device.UserId,
+			"platform":   device.Platform,
+			"name":       device.Name,
+			"created_at": device.CreatedAt,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&registered)
+	if err != nil {
+		return err
+	}
+
+	device.Id = registered.Id
+
+	return nil
+}
+
+// ListDevices returns the devices of the user, latest registered first.
+func (ns *NotificationService) ListDevices(ctx context.Context, userId string) ([]structures.Device, error) {
+	cursor, err := ns.dbService.collection(DeviceCollectionName).Find(ctx, bson.M{"user_id": userId},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []structures.Device{}
+	err = cursor.All(ctx, &devices)
+
+	return devices, err
+}
+
+// RemoveDevice stops push notifications to one of the user's devices.
+func (ns *NotificationService) RemoveDevice(ctx context.Context, userId string, id string) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return structures.ErrNoDevice
+	}
+
+	res, err := ns.dbService.collection(DeviceCollectionName).DeleteOne(ctx, bson.M{"_id": objectId, "user_id": userId})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return structures.ErrNoDevice
+	}
+
+	return nil
+}
+
+// DeleteAllByUser removes the notifications and devices of the user.
+func (ns *NotificationService) DeleteAllByUser(ctx context.Context, userId string) error {
+	_, err := ns.dbService.collection(NotificationCollectionName).DeleteMany(ctx, bson.M{"user_id": userId})
+	if err != nil {
+		return err
+	}
+
+	_, err = ns.dbService.collection(DeviceCollectionName).DeleteMany(ctx, bson.M{"user_id": userId})
+
+	return err
+}
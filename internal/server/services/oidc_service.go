@@ -0,0 +1,536 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
+)
+
+const OidcStateCollectionName = "oidc_states"
+
+// OidcStateLifetime is how long a user has to sign in at the provider.
+const OidcStateLifetime = 10 * time.Minute
+
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9_.]`)
+
+// oidcProvider is an OpenID Connect provider configured through the environment.
+// Its discovery document and signing keys are fetched on first use and cached.
+type oidcProvider struct {
+	name         string
+	issuer       string
+	clientId     string
+	clientSecret string
+	redirectUrl  string
+	scopes       []string
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]interface{}
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+// OidcService signs users in with external OpenID Connect providers,
+// using the authorization code flow with PKCE.
+type OidcService struct {
+	providers  map[string]*oidcProvider
+	httpClient *http.Client
+
+	store oidcStore
+}
+
+// Init reads the providers named in OIDC_PROVIDERS, a comma-separated list.
+// Each provider NAME is configured with OIDC_NAME_ISSUER, OIDC_NAME_CLIENT_ID, OIDC_NAME_CLIENT_SECRET,
+// OIDC_NAME_REDIRECT_URL and, optionally, OIDC_NAME_SCOPES.
+func (ois *OidcService) Init(ctx context.Context, dbService *DatabaseService, outboxService *OutboxService,
+	sessionService *SessionService) error {
+	ois.httpClient = &http.Client{Timeout: 10 * time.Second}
+	ois.providers = make(map[string]*oidcProvider)
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := &oidcProvider{
+			name:         name,
+			clientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			scopes:       strings.Fields(utils.GetenvOr(prefix+"SCOPES", "openid profile email")),
+		}
+
+		for env, target := range map[string]*string{
+			prefix + "ISSUER":       &provider.issuer,
+			prefix + "CLIENT_ID":    &provider.clientId,
+			prefix + "REDIRECT_URL": &provider.redirectUrl,
+		} {
+			value, found := os.LookupEnv(env)
+			if !found {
+				return fmt.Errorf("missing %s environment variable", env)
+			}
+			*target = value
+		}
+
+		ois.providers[name] = provider
+	}
+
+	store, err := newMongoOidcStore(ctx, dbService, outboxService, sessionService)
+	if err != nil {
+		return err
+	}
+	ois.store = store
+
+	return nil
+}
+
+// Start begins a login with the given provider. It returns the URL to send the user to, and a
+// hash of the state that the browser has to bring back to Finish, so that a callback URL can't
+// be used to sign someone else in. If session is set, the identity is linked to its user
+// instead of signing in.
+func (ois *OidcService) Start(ctx context.Context, providerName string, session *structures.Session) (string, string, error) {
+	provider, found := ois.providers[providerName]
+	if !found {
+		return "", "", structures.ErrUnknownOidcProvider
+	}
+
+	discovery, err := ois.discover(ctx, provider)
+	if err != nil {
+		return "", "", err
+	}
+
+	state := structures.OidcState{
+		State:        randomUrlString(32),
+		Provider:     provider.name,
+		Nonce:        randomUrlString(32),
+		CodeVerifier: randomUrlString(64),
+		ExpiresAt:    time.Now().Add(OidcStateLifetime),
+	}
+	if session != nil {
+		state.LinkUserId = session.UserId
+		state.LinkSessionId = session.Id
+	}
+
+	err = ois.store.InsertState(ctx, &state)
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(state.CodeVerifier))
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.clientId)
+	query.Set("redirect_uri", provider.redirectUrl)
+	query.Set("scope", strings.Join(provider.scopes, " "))
+	query.Set("state", state.State)
+	query.Set("nonce", state.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), hashOidcState(state.State), nil
+}
+
+// Finish completes a login started with Start, once the provider redirected back with a code.
+// stateHash is the hash Start returned, as kept by the browser. Links are bound to the session
+// that started them, and fail if it was revoked since. It returns the user the verified identity
+// belongs to, linking or creating one as needed.
+func (ois *OidcService) Finish(ctx context.Context, providerName string, stateValue string, code string,
+	stateHash string) (*structures.User, error) {
+	provider, found := ois.providers[providerName]
+	if !found {
+		return nil, structures.ErrUnknownOidcProvider
+	}
+
+	if subtle.ConstantTimeCompare([]byte(stateHash), []byte(hashOidcState(stateValue))) != 1 {
+		return nil, structures.ErrInvalidOidcState
+	}
+
+	// States are single use, so a callback URL can't be replayed.
+	state, err := ois.store.TakeState(ctx, provider.name, stateValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(state.ExpiresAt) {
+		return nil, structures.ErrInvalidOidcState
+	}
+
+	// The provider's redirect doesn't carry the user's token, so the link relies on the session
+	// it was started from still being around.
+	if state.LinkUserId != "" {
+		_, err = ois.store.GetSession(ctx, state.LinkUserId, state.LinkSessionId)
+		if err == structures.ErrNoSession {
+			return nil, structures.ErrInvalidOidcState
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	idToken, err := ois.exchangeCode(ctx, provider, code, state.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := ois.verifyIdToken(ctx, provider, idToken, state.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := structures.ExternalIdentity{
+		Provider: provider.name,
+		Subject:  claims["sub"].(string),
+		LinkedAt: time.Now().Unix(),
+	}
+	if verified, _ := claims["email_verified"].(bool); verified {
+		identity.Email, _ = claims["email"].(string)
+	}
+
+	user, err := ois.store.GetUserByIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		if state.LinkUserId != "" && state.LinkUserId != user.Id {
+			return nil, structures.ErrIdentityAlreadyLinked
+		}
+		return user, nil
+	} else if err != structures.ErrNoUser {
+		return nil, err
+	}
+
+	if state.LinkUserId != "" {
+		err = ois.store.LinkIdentity(ctx, &identity, state.LinkUserId)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Printf("Linked %v identity to user %v.\n", provider.name, state.LinkUserId)
+
+		return ois.store.GetUserById(ctx, state.LinkUserId)
+	}
+
+	return ois.createUser(ctx, claims, identity)
+}
+
+// createUser creates a user for an identity seen for the first time.
+// The username is derived from the provider's claims, with a random suffix if it is taken.
+func (ois *OidcService) createUser(ctx context.Context, claims jwt.MapClaims, identity structures.ExternalIdentity) (*structures.User, error) {
+	base := ""
+	for _, claim := range []string{"preferred_username", "email", "name"} {
+		if value, _ := claims[claim].(string); value != "" {
+			base, _, _ = strings.Cut(value, "@")
+			break
+		}
+	}
+
+	base = usernameDisallowed.ReplaceAllString(base, "")
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 24 {
+		base = base[:24]
+	}
+
+	name, _ := claims["name"].(string)
+	if name == "" {
+		name = base
+	}
+
+	user := structures.User{
+		Name:         name,
+		Transactions: []structures.Transaction{},
+		Identities:   []structures.ExternalIdentity{identity},
+	}
+
+	username := base
+	for attempt := 0; attempt < 5; attempt++ {
+		user.Username = username
+
+		err := ois.store.CreateUser(ctx, &user)
+		if err == nil {
+			fmt.Printf("Created user %v from %v identity.\n", user.Username, identity.Provider)
+			return &user, nil
+		} else if err != structures.ErrUserAlreadyExists {
+			return nil, err
+		}
+
+		username = fmt.Sprintf("%s%d", base, randomNumber(10000))
+	}
+
+	return nil, structures.ErrFailedToCreateUser
+}
+
+func (ois *OidcService) exchangeCode(ctx context.Context, provider *oidcProvider, code string, verifier string) (string, error) {
+	discovery, err := ois.discover(ctx, provider)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.redirectUrl)
+	form.Set("client_id", provider.clientId)
+	form.Set("code_verifier", verifier)
+	if provider.clientSecret != "" {
+		form.Set("client_secret", provider.clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var response struct {
+		IdToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+
+	err = ois.getJSON(req, &response)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange code with %s: %w", provider.name, err)
+	}
+
+	if response.IdToken == "" {
+		return "", fmt.Errorf("no id_token from %s: %s", provider.name, response.Error)
+	}
+
+	return response.IdToken, nil
+}
+
+func (ois *OidcService) verifyIdToken(ctx context.Context, provider *oidcProvider, idToken string, nonce string) (jwt.MapClaims, error) {
+	discovery, err := ois.discover(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return ois.providerKey(ctx, provider, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token from %s: %w", provider.name, err)
+	}
+
+	if !claims.VerifyIssuer(discovery.Issuer, true) ||
+		!claims.VerifyAudience(provider.clientId, true) ||
+		claims["nonce"] != nonce {
+		return nil, structures.ErrInvalidToken
+	}
+
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return nil, structures.ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func (ois *OidcService) discover(ctx context.Context, provider *oidcProvider) (*oidcDiscovery, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if provider.discovery != nil {
+		return provider.discovery, nil
+	}
+
+	endpoint := strings.TrimSuffix(provider.issuer, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery oidcDiscovery
+	err = ois.getJSON(req, &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", provider.name, err)
+	}
+
+	if discovery.Issuer != provider.issuer {
+		return nil, fmt.Errorf("issuer mismatch for %s: %s", provider.name, discovery.Issuer)
+	}
+
+	provider.discovery = &discovery
+
+	return provider.discovery, nil
+}
+
+// providerKey returns the provider's public key with the given ID,
+// refetching the key set once if it's unknown, as providers rotate their keys.
+func (ois *OidcService) providerKey(ctx context.Context, provider *oidcProvider, kid string) (interface{}, error) {
+	provider.mu.Lock()
+	key, found := provider.keys[kid]
+	provider.mu.Unlock()
+
+	if found {
+		return key, nil
+	}
+
+	discovery, err := ois.discover(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JwksUri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	err = ois.getJSON(req, &set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch keys for %s: %w", provider.name, err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, raw := range set.Keys {
+		id, key, err := parseJWK(raw)
+		if err != nil {
+			fmt.Printf("Skipping key from %s: %v\n", provider.name, err)
+			continue
+		}
+		keys[id] = key
+	}
+
+	provider.mu.Lock()
+	provider.keys = keys
+	provider.mu.Unlock()
+
+	key, found = keys[kid]
+	if !found {
+		return nil, structures.ErrInvalidToken
+	}
+
+	return key, nil
+}
+
+func (ois *OidcService) getJSON(req *http.Request, v any) error {
+	res, err := ois.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// parseJWK parses an RSA, P-256 or Ed25519 public key in JWK format.
+func parseJWK(raw json.RawMessage) (string, interface{}, error) {
+	var jwk struct {
+		KeyType string `json:"kty"`
+		KeyId   string `json:"kid"`
+		Curve   string `json:"crv"`
+		N       string `json:"n"`
+		E       string `json:"e"`
+		X       string `json:"x"`
+		Y       string `json:"y"`
+	}
+
+	err := json.Unmarshal(raw, &jwk)
+	if err != nil {
+		return "", nil, err
+	}
+
+	decode := func(values ...string) ([][]byte, error) {
+		decoded := make([][]byte, len(values))
+		for i, value := range values {
+			decoded[i], err = base64.RawURLEncoding.DecodeString(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return decoded, nil
+	}
+
+	switch {
+	case jwk.KeyType == "RSA":
+		parts, err := decode(jwk.N, jwk.E)
+		if err != nil {
+			return "", nil, err
+		}
+		return jwk.KeyId, &rsa.PublicKey{
+			N: new(big.Int).SetBytes(parts[0]),
+			E: int(new(big.Int).SetBytes(parts[1]).Int64()),
+		}, nil
+	case jwk.KeyType == "EC" && jwk.Curve == "P-256":
+		parts, err := decode(jwk.X, jwk.Y)
+		if err != nil {
+			return "", nil, err
+		}
+		return jwk.KeyId, &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(parts[0]),
+			Y:     new(big.Int).SetBytes(parts[1]),
+		}, nil
+	case jwk.KeyType == "OKP" && jwk.Curve == "Ed25519":
+		parts, err := decode(jwk.X)
+		if err != nil {
+			return "", nil, err
+		}
+		return jwk.KeyId, ed25519.PublicKey(parts[0]), nil
+	}
+
+	return "", nil, errors.New("unsupported key type " + jwk.KeyType)
+}
+
+// hashOidcState returns what the browser keeps of a state, which is useless without the state.
+func hashOidcState(state string) string {
+	hash := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func randomUrlString(n int) string {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func randomNumber(limit int64) int64 {
+	n, err := rand.Int(rand.Reader, big.NewInt(limit))
+	if err != nil {
+		panic(err)
+	}
+	return n.Int64()
+}
@@ -0,0 +1,500 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+const testClientId = "echo"
+
+// testProvider is a stand-in OpenID Connect provider. Tests authorize codes directly with the
+// claims to put in the id_token, and its token endpoint checks the PKCE verifier.
+type testProvider struct {
+	server *httptest.Server
+	key    ed25519.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]testAuthorization
+}
+
+type testAuthorization struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &testProvider{key: key, codes: make(map[string]testAuthorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize",
+			TokenEndpoint:         p.server.URL + "/token",
+			JwksUri:               p.server.URL + "/jwks.json",
+		})
+	})
+	mux.HandleFunc("/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"kid": "test",
+			"x":   base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		}}})
+	})
+	mux.HandleFunc("/token", p.token)
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func (p *testProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	authorization, found := p.codes[r.FormValue("code")]
+	delete(p.codes, r.FormValue("code"))
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !found || base64.RawURLEncoding.EncodeToString(verifier[:]) != authorization.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, authorization.claims)
+	token.Header["kid"] = "test"
+
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+}
+
+// authorize signs the user in at the authorization URL returned by Start, and returns the
+// state and code the provider would redirect back with. The id_token gets the given claims,
+// on top of valid ones for the request.
+func (p *testProvider) authorize(t *testing.T, authorizationUrl string, claims jwt.MapClaims) (string, string) {
+	parsed, err := url.Parse(authorizationUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+
+	issued := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   testClientId,
+		"sub":   "subject",
+		"nonce": query.Get("nonce"),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}
+	for claim, value := range claims {
+		issued[claim] = value
+	}
+
+	code := randomUrlString(16)
+
+	p.mu.Lock()
+	p.codes[code] = testAuthorization{challenge: query.Get("code_challenge"), claims: issued}
+	p.mu.Unlock()
+
+	return query.Get("state"), code
+}
+
+// memoryOidcStore is an oidcStore keeping everything in maps.
+type memoryOidcStore struct {
+	mu       sync.Mutex
+	states   map[string]structures.OidcState
+	sessions map[string]*structures.Session
+	users    map[string]*structures.User
+}
+
+func newMemoryOidcStore() *memoryOidcStore {
+	return &memoryOidcStore{
+		states:   make(map[string]structures.OidcState),
+		sessions: make(map[string]*structures.Session),
+		users:    make(map[string]*structures.User),
+	}
+}
+
+func (ms *memoryOidcStore) InsertState(ctx context.Context, state *structures.OidcState) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.states[state.State] = *state
+	return nil
+}
+
+func (ms *memoryOidcStore) TakeState(ctx context.Context, provider string, value string) (*structures.OidcState, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	state, found := ms.states[value]
+	if !found || state.Provider != provider {
+		return nil, structures.ErrInvalidOidcState
+	}
+	delete(ms.states, value)
+
+	return &state, nil
+}
+
+func (ms *memoryOidcStore) GetSession(ctx context.Context, userId string, sessionId string) (*structures.Session, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	session, found := ms.sessions[sessionId]
+	if !found || session.UserId != userId {
+		return nil, structures.ErrNoSession
+	}
+	return session, nil
+}
+
+func (ms *memoryOidcStore) GetUserById(ctx context.Context, id string) (*structures.User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	user, found := ms.users[id]
+	if !found {
+		return nil, structures.ErrNoUser
+	}
+	return user, nil
+}
+
+func (ms *memoryOidcStore) GetUserByIdentity(ctx context.Context, provider string, subject string) (*structures.User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return ms.userByIdentity(provider, subject)
+}
+
+func (ms *memoryOidcStore) LinkIdentity(ctx context.Context, identity *structures.ExternalIdentity, userId string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, err := ms.userByIdentity(identity.Provider, identity.Subject); err == nil {
+		return structures.ErrIdentityAlreadyLinked
+	}
+
+	user, found := ms.users[userId]
+	if !found {
+		return structures.ErrNoUser
+	}
+	user.Identities = append(user.Identities, *identity)
+
+	return nil
+}
+
+func (ms *memoryOidcStore) CreateUser(ctx context.Context, user *structures.User) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, existing := range ms.users {
+		if existing.Username == user.Username {
+			return structures.ErrUserAlreadyExists
+		}
+	}
+
+	user.Id = fmt.Sprintf("user%d", len(ms.users)+1)
+	ms.users[user.Id] = user
+
+	return nil
+}
+
+func (ms *memoryOidcStore) userByIdentity(provider string, subject string) (*structures.User, error) {
+	for _, user := range ms.users {
+		for _, identity := range user.Identities {
+			if identity.Provider == provider && identity.Subject == subject {
+				return user, nil
+			}
+		}
+	}
+	return nil, structures.ErrNoUser
+}
+
+func newTestOidcService(t *testing.T) (*OidcService, *testProvider, *memoryOidcStore) {
+	p := newTestProvider(t)
+	store := newMemoryOidcStore()
+
+	ois := &OidcService{
+		providers: map[string]*oidcProvider{"test": {
+			name:        "test",
+			issuer:      p.server.URL,
+			clientId:    testClientId,
+			redirectUrl: "https://api.example.com/auth/oidc/test/callback",
+			scopes:      []string{"openid"},
+		}},
+		httpClient: p.server.Client(),
+		store:      store,
+	}
+
+	return ois, p, store
+}
+
+func TestOidcStartUsesPkceS256(t *testing.T) {
+	ois, _, store := newTestOidcService(t)
+
+	authorizationUrl, stateHash, err := ois.Start(context.Background(), "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(authorizationUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+
+	state, found := store.states[query.Get("state")]
+	if !found {
+		t.Fatalf("state %q wasn't stored", query.Get("state"))
+	}
+
+	challenge := sha256.Sum256([]byte(state.CodeVerifier))
+	if got, want := query.Get("code_challenge"), base64.RawURLEncoding.EncodeToString(challenge[:]); got != want {
+		t.Errorf("code_challenge = %q, want %q", got, want)
+	}
+	if got := query.Get("code_challenge_method"); got != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", got)
+	}
+	if query.Get("code_verifier") != "" {
+		t.Error("code_verifier was sent to the authorization endpoint")
+	}
+	if got := query.Get("nonce"); got != state.Nonce {
+		t.Errorf("nonce = %q, want %q", got, state.Nonce)
+	}
+	if stateHash != hashOidcState(state.State) {
+		t.Errorf("state hash = %q, want the hash of the state", stateHash)
+	}
+}
+
+func TestOidcFinishRejectsWrongVerifier(t *testing.T) {
+	ois, p, store := newTestOidcService(t)
+	ctx := context.Background()
+
+	authorizationUrl, stateHash, err := ois.Start(ctx, "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stateValue, code := p.authorize(t, authorizationUrl, nil)
+
+	state := store.states[stateValue]
+	state.CodeVerifier = randomUrlString(64)
+	store.states[stateValue] = state
+
+	_, err = ois.Finish(ctx, "test", stateValue, code, stateHash)
+	if err == nil {
+		t.Fatal("Finish succeeded with a code verifier not matching the challenge")
+	}
+}
+
+func TestOidcFinishCreatesThenFindsUser(t *testing.T) {
+	ois, p, store := newTestOidcService(t)
+	ctx := context.Background()
+
+	login := func() *structures.User {
+		authorizationUrl, stateHash, err := ois.Start(ctx, "test", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stateValue, code := p.authorize(t, authorizationUrl, jwt.MapClaims{
+			"preferred_username": "ada.lovelace@example.com",
+			"name":               "Ada",
+		})
+
+		user, err := ois.Finish(ctx, "test", stateValue, code, stateHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+
+	created := login()
+	if created.Username != "ada.lovelace" || created.Name != "Ada" {
+		t.Errorf("created user %q named %q, want ada.lovelace named Ada", created.Username, created.Name)
+	}
+	if len(created.Identities) != 1 || created.Identities[0].Subject != "subject" {
+		t.Errorf("created user has identities %+v, want the one signed in with", created.Identities)
+	}
+
+	found := login()
+	if found.Id != created.Id {
+		t.Errorf("second login returned user %v, want %v", found.Id, created.Id)
+	}
+	if len(store.users) != 1 {
+		t.Errorf("%d users exist after two logins, want 1", len(store.users))
+	}
+}
+
+func TestOidcFinishLinksUser(t *testing.T) {
+	ois, p, store := newTestOidcService(t)
+	ctx := context.Background()
+
+	user := &structures.User{Username: "ada"}
+	other := &structures.User{Username: "bob"}
+	for _, u := range []*structures.User{user, other} {
+		if err := store.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	other.Identities = []structures.ExternalIdentity{{Provider: "test", Subject: "taken"}}
+
+	session := &structures.Session{Id: "session", UserId: user.Id}
+	store.sessions[session.Id] = session
+
+	// The callback comes from a browser redirect without the user's token, so Finish only has
+	// the session the link was started from to go on.
+	tests := []struct {
+		name    string
+		subject string
+		session *structures.Session
+		err     error
+	}{
+		{"with the session", "new", session, nil},
+		{"again", "new", session, nil},
+		{"linked to another user", "taken", session, structures.ErrIdentityAlreadyLinked},
+		{"after the session was revoked", "revoked", &structures.Session{Id: "revoked", UserId: user.Id},
+			structures.ErrInvalidOidcState},
+		{"with another user's session", "stolen", &structures.Session{Id: "session", UserId: other.Id},
+			structures.ErrInvalidOidcState},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorizationUrl, stateHash, err := ois.Start(ctx, "test", tt.session)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stateValue, code := p.authorize(t, authorizationUrl, jwt.MapClaims{"sub": tt.subject})
+
+			linked, err := ois.Finish(ctx, "test", stateValue, code, stateHash)
+			if err != tt.err {
+				t.Fatalf("Finish returned %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if linked.Id != user.Id {
+				t.Errorf("linked user %v, want %v", linked.Id, user.Id)
+			}
+		})
+	}
+
+	if len(user.Identities) != 1 {
+		t.Errorf("user has %d identities, want 1", len(user.Identities))
+	}
+	if len(other.Identities) != 1 {
+		t.Errorf("other user has %d identities, want 1", len(other.Identities))
+	}
+	if len(store.users) != 2 {
+		t.Errorf("%d users exist, want 2", len(store.users))
+	}
+}
+
+func TestOidcFinishRejectsInvalidState(t *testing.T) {
+	ois, p, store := newTestOidcService(t)
+	ctx := context.Background()
+
+	authorizationUrl, stateHash, err := ois.Start(ctx, "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateValue, code := p.authorize(t, authorizationUrl, nil)
+
+	_, err = ois.Finish(ctx, "test", stateValue, code, "")
+	if err != structures.ErrInvalidOidcState {
+		t.Errorf("Finish without the state hash returned %v, want ErrInvalidOidcState", err)
+	}
+
+	_, err = ois.Finish(ctx, "test", stateValue, code, hashOidcState("other"))
+	if err != structures.ErrInvalidOidcState {
+		t.Errorf("Finish with another state's hash returned %v, want ErrInvalidOidcState", err)
+	}
+
+	_, err = ois.Finish(ctx, "test", stateValue, code, stateHash)
+	if err != nil {
+		t.Fatalf("Finish returned %v", err)
+	}
+
+	_, err = ois.Finish(ctx, "test", stateValue, code, stateHash)
+	if err != structures.ErrInvalidOidcState {
+		t.Errorf("reusing the state returned %v, want ErrInvalidOidcState", err)
+	}
+
+	authorizationUrl, stateHash, err = ois.Start(ctx, "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateValue, code = p.authorize(t, authorizationUrl, nil)
+
+	state := store.states[stateValue]
+	state.ExpiresAt = time.Now().Add(-time.Second)
+	store.states[stateValue] = state
+
+	_, err = ois.Finish(ctx, "test", stateValue, code, stateHash)
+	if err != structures.ErrInvalidOidcState {
+		t.Errorf("Finish with an expired state returned %v, want ErrInvalidOidcState", err)
+	}
+}
+
+func TestOidcFinishRejectsInvalidIdToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"nonce mismatch", jwt.MapClaims{"nonce": "other"}},
+		{"issuer mismatch", jwt.MapClaims{"iss": "https://other.example.com"}},
+		{"audience mismatch", jwt.MapClaims{"aud": "other"}},
+		{"missing subject", jwt.MapClaims{"sub": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ois, p, store := newTestOidcService(t)
+			ctx := context.Background()
+
+			authorizationUrl, stateHash, err := ois.Start(ctx, "test", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stateValue, code := p.authorize(t, authorizationUrl, tt.claims)
+
+			_, err = ois.Finish(ctx, "test", stateValue, code, stateHash)
+			if err != structures.ErrInvalidToken {
+				t.Errorf("Finish returned %v, want ErrInvalidToken", err)
+			}
+			if len(store.users) != 0 {
+				t.Errorf("%d users were created, want 0", len(store.users))
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+// oidcStore keeps what OidcService needs between requests: the states of logins in progress,
+// and the users the identities belong to.
+type oidcStore interface {
+	// InsertState remembers a login until the provider's callback.
+	InsertState(ctx context.Context, state *structures.OidcState) error
+
+	// TakeState removes and returns the state of a login with the provider, so it can only be
+	// used once. It returns ErrInvalidOidcState if there is none.
+	TakeState(ctx context.Context, provider string, value string) (*structures.OidcState, error)
+
+	// GetSession returns ErrNoSession if the session was revoked or has expired.
+	GetSession(ctx context.Context, userId string, sessionId string) (*structures.Session, error)
+
+	GetUserById(ctx context.Context, id string) (*structures.User, error)
+
+	// GetUserByIdentity returns ErrNoUser if no user has the identity.
+	GetUserByIdentity(ctx context.Context, provider string, subject string) (*structures.User, error)
+
+	// LinkIdentity returns ErrIdentityAlreadyLinked if another user already has the identity.
+	LinkIdentity(ctx context.Context, identity *structures.ExternalIdentity, userId string) error
+
+	// CreateUser creates a user who signed up through a provider, and announces the signup.
+	// It returns ErrUserAlreadyExists if the username is taken.
+	CreateUser(ctx context.Context, user *structures.User) error
+}
+
+// mongoOidcStore is the oidcStore of the server, keeping states in their own collection.
+type mongoOidcStore struct {
+	dbService      *DatabaseService
+	outboxService  *OutboxService
+	sessionService *SessionService
+}
+
+func newMongoOidcStore(ctx context.Context, dbService *DatabaseService, outboxService *OutboxService,
+	sessionService *SessionService) (*mongoOidcStore, error) {
+	_, err := dbService.collection(OidcStateCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		fmt.Printf("Failed to create OIDC state TTL index: %v\n", err)
+		return nil, err
+	}
+
+	return &mongoOidcStore{dbService: dbService, outboxService: outboxService, sessionService: sessionService}, nil
+}
+
+func (ms *mongoOidcStore) InsertState(ctx context.Context, state *structures.OidcState) error {
+	_, err := ms.dbService.collection(OidcStateCollectionName).InsertOne(ctx, state)
+	if err != nil {
+		fmt.Printf("Failed to store OIDC state: %v\n", err)
+	}
+
+	return err
+}
+
+func (ms *mongoOidcStore) TakeState(ctx context.Context, provider string, value string) (*structures.OidcState, error) {
+	var state structures.OidcState
+	err := ms.dbService.collection(OidcStateCollectionName).FindOneAndDelete(ctx,
+		bson.M{"_id": value, "provider": provider}).Decode(&state)
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrInvalidOidcState
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+func (ms *mongoOidcStore) GetSession(ctx context.Context, userId string, sessionId string) (*structures.Session, error) {
+	return ms.sessionService.Get(userId, sessionId)
+}
+
+func (ms *mongoOidcStore) GetUserById(ctx context.Context, id string) (*structures.User, error) {
+	return ms.dbService.GetUserById(id)
+}
+
+func (ms *mongoOidcStore) GetUserByIdentity(ctx context.Context, provider string, subject string) (*structures.User, error) {
+	return ms.dbService.GetUserByIdentity(provider, subject)
+}
+
+func (ms *mongoOidcStore) LinkIdentity(ctx context.Context, identity *structures.ExternalIdentity, userId string) error {
+	return ms.dbService.LinkIdentityToUserById(identity, userId)
+}
+
+func (ms *mongoOidcStore) CreateUser(ctx context.Context, user *structures.User) error {
+	provider := ""
+	if len(user.Identities) > 0 {
+		provider = user.Identities[0].Provider
+	}
+
+	return ms.dbService.WithTransaction(ctx, func(ctx context.Context) error {
+		user.Id = ""
+
+		err := ms.dbService.CreateUser(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		return ms.outboxService.Add(ctx, structures.WEBHOOK_USER_CREATED,
+			map[string]string{"user_id": user.Id, "provider": provider})
+	})
+}
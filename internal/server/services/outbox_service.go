@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
+)
+
+const OutboxCollectionName = "outbox"
+
+const (
+	outboxPollInterval = 1 * time.Second
+	outboxLease        = 30 * time.Second
+	outboxMaxBackoff   = 5 * time.Minute
+
+	// outboxRetention is how long published events are kept, to look into what was sent.
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// OutboxService makes sure events are published once the change they describe is saved.
+// Events are added to the outbox in the same transaction as the change, and relayed to the
+// EventPublisher in the background, retrying until it succeeds. Delivery is at least once:
+// an event can be published again if the relay stops before marking it as published.
+type OutboxService struct {
+	publisher EventPublisher
+
+	dbService *DatabaseService
+}
+
+// Init selects the publisher from EVENT_PUBLISHER: "webhook" (default), which queues events
+// for webhook endpoints, "memory" or "nats". The NATS publisher connects to NATS_URL and
+// publishes to JetStream under NATS_SUBJECT_PREFIX, defaulting to "echo".
+func (obs *OutboxService) Init(ctx context.Context, dbService *DatabaseService, webhookService *WebhookService) error {
+	switch kind := utils.GetenvOr("EVENT_PUBLISHER", "webhook"); kind {
+	case "webhook":
+		obs.publisher = NewWebhookEventPublisher(webhookService)
+	case "memory":
+		obs.publisher = NewMemoryEventPublisher()
+	case "nats":
+		natsUrl := os.Getenv("NATS_URL")
+		if natsUrl == "" {
+			return errors.New("NATS_URL is required when EVENT_PUBLISHER is nats")
+		}
+
+		publisher, err := NewNatsEventPublisher(natsUrl, utils.GetenvOr("NATS_SUBJECT_PREFIX", "echo"))
+		if err != nil {
+			return err
+		}
+		obs.publisher = publisher
+	default:
+		return fmt.Errorf("invalid EVENT_PUBLISHER environment variable: %s", kind)
+	}
+
+	obs.dbService = dbService
+
+	_, err := dbService.collection(OutboxCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "published", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create outbox indexes: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Add writes an event to the outbox. Call it with the context given by
+// DatabaseService.WithTransaction so it's only published if the rest of the transaction commits.
+// The data is published as JSON, so it should only hold what subscribers are meant to see.
+func (obs *OutboxService) Add(ctx context.Context, eventType structures.WebhookEventType, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+
+	event := structures.OutboxEvent{
+		Type:          eventType,
+		CreatedAt:     now,
+		Data:          string(encoded),
+		NextAttemptAt: now,
+	}
+
+	_, err = obs.dbService.collection(OutboxCollectionName).InsertOne(ctx, event)
+
+	return err
+}
+
+// Start relays events from the outbox to the publisher, periodically until ctx is done.
+func (obs *OutboxService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+
+		for {
+			obs.ProcessDue(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ProcessDue publishes every unpublished event that is due, oldest first.
+func (obs *OutboxService) ProcessDue(ctx context.Context) {
+	outbox := obs.dbService.collection(OutboxCollectionName)
+
+	for ctx.Err() == nil {
+		// Claim one event at a time by pushing it back for the length of a lease, so replicas
+		// running this concurrently don't both publish it, and a crash midway retries it later.
+		now := time.Now()
+
+		var event structures.OutboxEvent
+		err := outbox.FindOneAndUpdate(ctx,
+			bson.M{"published": false, "next_attempt_at": bson.M{"$lte": now.Unix()}},
+			bson.M{"$set": bson.M{"next_attempt_at": now.Add(outboxLease).Unix()}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "_id", Value: 1}}),
+		).Decode(&event)
+
+		if err == mongo.ErrNoDocuments {
+			return
+		} else if err != nil {
+			fmt.Printf("Failed to find unpublished events: %v\n", err)
+			return
+		}
+
+		err = obs.relay(ctx, &event)
+		if err != nil {
+			fmt.Printf("Failed to update outbox event %v: %v\n", event.Id, err)
+		}
+	}
+}
+
+// relay publishes an event and marks it as published, or schedules a retry with exponential backoff.
+func (obs *OutboxService) relay(ctx context.Context, event *structures.OutboxEvent) error {
+	objectId, err := primitive.ObjectIDFromHex(event.Id)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	outbox := obs.dbService.collection(OutboxCollectionName)
+	attempts := event.Attempts + 1
+
+	publishErr := obs.publisher.Publish(ctx, event)
+	if publishErr == nil {
+		now := time.Now()
+		expiresAt := now.Add(outboxRetention)
+
+		_, err = outbox.UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{
+			"$set":   bson.M{"published": true, "published_at": now.Unix(), "attempts": attempts, "expires_at": expiresAt},
+			"$unset": bson.M{"next_attempt_at": "", "last_error": ""},
+		})
+		return err
+	}
+
+	fmt.Printf("Failed to publish %v event %v: %v\n", event.Type, event.Id, publishErr)
+
+	delay := outboxPollInterval
+	for i := 1; i < attempts && delay < outboxMaxBackoff; i++ {
+		delay *= 2
+	}
+
+	_, err = outbox.UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{"$set": bson.M{
+		"attempts":        attempts,
+		"last_error":      publishErr.Error(),
+		"next_attempt_at": time.Now().Add(min(delay, outboxMaxBackoff)).Unix(),
+	}})
+
+	return err
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+// ProfileService decides who can see whom. Every endpoint that shows a user to
+// someone else should go through CanView.
+type ProfileService struct {
+	dbService     *DatabaseService
+	userService   *UserService
+	friendService *FriendService
+}
+
+func (ps *ProfileService) Init(ctx context.Context, dbService *DatabaseService, userService *UserService,
+	friendService *FriendService) error {
+	ps.dbService = dbService
+	ps.userService = userService
+	ps.friendService = friendService
+
+	return nil
+}
+
+// CanView reports whether the viewer may see the target user.
+// Users can always see themselves, and never see users they blocked or were blocked by.
+func (ps *ProfileService) CanView(viewer *structures.User, target *structures.User) bool {
+	return ps.canView(viewer, target, func() bool {
+		friends, err := ps.friendService.AreFriends(context.Background(), viewer.Id, target.Id)
+		if err != nil {
+			fmt.Printf("Failed to check friendship of users %v and %v: %v\n", viewer.Id, target.Id, err)
+		}
+		return friends
+	})
+}
+
+// CanViewFriend is CanView for callers that already know whether the two users are friends,
+// which saves a lookup per user when going through many of them.
+func (ps *ProfileService) CanViewFriend(viewer *structures.User, target *structures.User, friends bool) bool {
+	return ps.canView(viewer, target, func() bool { return friends })
+}
+
+func (ps *ProfileService) canView(viewer *structures.User, target *structures.User, areFriends func() bool) bool {
+	if target.IsDeleted {
+		return false
+	}
+
+	if viewer != nil && viewer.Id == target.Id {
+		return true
+	}
+
+	if viewer != nil && (viewer.HasBlocked(target) || target.HasBlocked(viewer)) {
+		return false
+	}
+
+	switch target.ProfileVisibility() {
+	case structures.PUBLIC:
+		return true
+	case structures.FRIENDS:
+		return viewer != nil && areFriends()
+	default:
+		return false
+	}
+}
+
+// GetPublicProfile returns the public profile of the user with the given username.
+// It returns ErrNoUser if there is no such user or the viewer isn't allowed to see them,
+// so hidden profiles can't be told apart from missing ones.
+func (ps *ProfileService) GetPublicProfile(viewer *structures.User, username string) (*structures.PublicProfile, error) {
+	user, err := ps.dbService.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ps.CanView(viewer, user) {
+		return nil, structures.ErrNoUser
+	}
+
+	totalWeight, err := ps.dbService.GetTotalWeightByUserId(user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	badges := user.Badges
+	if badges == nil {
+		badges = []string{}
+	}
+
+	return &structures.PublicProfile{
+		Name:        user.Name,
+		Username:    user.Username,
+		AvatarUrl:   ps.userService.AvatarUrl(user.Id),
+		TotalWeight: totalWeight,
+		Badges:      badges,
+	}, nil
+}
+
+// SetVisibility changes who the user is visible to.
+func (ps *ProfileService) SetVisibility(user *structures.User, visibility structures.Visibility) error {
+	err := ps.dbService.UpdateUserById(user.Id, bson.M{"$set": bson.M{"visibility": visibility}})
+	if err != nil {
+		return err
+	}
+
+	user.Visibility = visibility
+
+	return nil
+}
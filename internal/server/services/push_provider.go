@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+// PushProvider delivers push notifications to devices.
+type PushProvider interface {
+	// Send delivers the notification to the device. It returns ErrNoDevice if the provider no
+	// longer knows the device's token, so the device is removed.
+	Send(ctx context.Context, device *structures.Device, notification *structures.Notification) error
+}
+
+// LogPushProvider is a PushProvider that prints notifications instead of sending them, for
+// development.
+type LogPushProvider struct{}
+
+func NewLogPushProvider() *LogPushProvider {
+	return &LogPushProvider{}
+}
+
+func (lp *LogPushProvider) Send(ctx context.Context, device *structures.Device,
+	notification *structures.Notification) error {
+	fmt.Printf("Push to %v device %v of user %v: %v: %v\n", device.Platform, device.Id, device.UserId,
+		notification.Title, notification.Body)
+
+	return nil
+}
+
+// FilePushProvider is a PushProvider that appends notifications to a file, one JSON object per
+// line, so tests and local tools can read what would have been sent.
+type FilePushProvider struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFilePushProvider opens the file for appending, creating it if needed.
+func NewFilePushProvider(path string) (*FilePushProvider, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FilePushProvider{file: file}, nil
+}
+
+func (fp *FilePushProvider) Send(ctx context.Context, device *structures.Device,
+	notification *structures.Notification) error {
+	line, err := json.Marshal(map[string]any{
+		"device_id":    device.Id,
+		"user_id":      device.UserId,
+		"platform":     device.Platform,
+		"token":        device.Token,
+		"notification": notification,
+	})
+	if err != nil {
+		return err
+	}
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	_, err = fp.file.Write(append(line, '\n'))
+
+	return err
+}
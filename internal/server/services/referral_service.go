@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
+)
+
+const ReferralCollectionName = "referrals"
+
+// readableCodeAlphabet leaves out characters that are easily mistaken for one another,
+// for codes people type in or read out to each other.
+const readableCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+const referralCodeLength = 8
+
+// ReferralService rewards users for inviting others. Both get a bonus once the new user
+// claims their first disposal, unless the signup looks like a self-referral or the
+// referrer reached their limit.
+type ReferralService struct {
+	maxPerUser    int
+	referrerBonus float32
+	refereeBonus  float32
+
+	dbService           *DatabaseService
+	sessionService      *SessionService
+	notificationService *NotificationService
+}
+
+// Init reads the limits from the environment: REFERRAL_MAX_PER_USER, the number of referrals
+// a user can be rewarded for, defaulting to 20, and REFERRAL_REFERRER_BONUS and
+// REFERRAL_REFEREE_BONUS, the credits each party gets, both defaulting to 50.
+func (rs *ReferralService) Init(ctx context.Context, dbService *DatabaseService, sessionService *SessionService,
+	notificationService *NotificationService) error {
+	maxPerUser, err := strconv.Atoi(utils.GetenvOr("REFERRAL_MAX_PER_USER", "20"))
+	if err != nil || maxPerUser < 0 {
+		return errors.New("invalid REFERRAL_MAX_PER_USER environment variable")
+	}
+
+	referrerBonus, err := strconv.ParseFloat(utils.GetenvOr("REFERRAL_REFERRER_BONUS", "50"), 32)
+	if err != nil || referrerBonus < 0 {
+		return errors.New("invalid REFERRAL_REFERRER_BONUS environment variable")
+	}
+
+	refereeBonus, err := strconv.ParseFloat(utils.GetenvOr("REFERRAL_REFEREE_BONUS", "50"), 32)
+	if err != nil || refereeBonus < 0 {
+		return errors.New("invalid REFERRAL_REFEREE_BONUS environment variable")
+	}
+
+	rs.maxPerUser = maxPerUser
+	rs.referrerBonus = float32(referrerBonus)
+	rs.refereeBonus = float32(refereeBonus)
+
+	rs.dbService = dbService
+	rs.sessionService = sessionService
+	rs.notificationService = notificationService
+
+	_, err = dbService.collection(UserCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "referral_code", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(
+			bson.M{"referral_code": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		fmt.Printf("Failed to create referral code index: %v\n", err)
+		return err
+	}
+
+	_, err = dbService.collection(ReferralCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "referee_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "referrer_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create referral indexes: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// MaxPerUser returns how many referrals a user can be rewarded for.
+func (rs *ReferralService) MaxPerUser() int {
+	return rs.maxPerUser
+}
+
+// EnsureCode returns the user's referral code, generating one if they don't have one yet.
+func (rs *ReferralService) EnsureCode(ctx context.Context, user *structures.User) (string, error) {
+	if user.ReferralCode != "" {
+		return user.ReferralCode, nil
+	}
+
+	objectId, err := primitive.ObjectIDFromHex(user.Id)
+	if err != nil {
+		return "", structures.ErrInvalidDatabaseId
+	}
+
+	users := rs.dbService.collection(UserCollectionName)
+
+	for attempt := 0; attempt < 5; attempt++ {
+		code := randomReadableCode(referralCodeLength)
+
+		var updated structures.User
+		err = users.FindOneAndUpdate(ctx,
+			bson.M{"_id": objectId, "referral_code": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"referral_code": code}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"referral_code": 1}),
+		).Decode(&updated)
+
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		} else if err == mongo.ErrNoDocuments {
+			// A concurrent request gave the user a code first.
+			err = users.FindOne(ctx, bson.M{"_id": objectId},
+				options.FindOne().SetProjection(bson.M{"referral_code": 1})).Decode(&updated)
+			if err == mongo.ErrNoDocuments {
+				return "", structures.ErrNoUser
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+
+		user.ReferralCode = updated.ReferralCode
+
+		return user.ReferralCode, nil
+	}
+
+	return "", errors.New("failed to generate a unique referral code")
+}
+
+// FindReferrer returns the user a referral code belongs to, or ErrInvalidReferralCode.
+func (rs *ReferralService) FindReferrer(ctx context.Context, code string) (*structures.User, error) {
+	var referrer structures.User
+
+	err := rs.dbService.collection(UserCollectionName).FindOne(ctx, bson.M{
+		"referral_code": strings.ToUpper(strings.TrimSpace(code)),
+		"is_deleted":    bson.M{"$ne": true},
+	}).Decode(&referrer)
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrInvalidReferralCode
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &referrer, nil
+}
+
+// Record saves the referral of a new user, made from the given client. Referrals that look
+// like the referrer signing up again, from the same network or device as one of their
+// sessions or one of their earlier referrals, and those past the referrer's limit, are
+// recorded as rejected and never rewarded.
+func (rs *ReferralService) Record(ctx context.Context, referrer *structures.User, referee *structures.User,
+	ip string, userAgent string, deviceName string) (*structures.Referral, error) {
+	referral := structures.Referral{
+		ReferrerId: referrer.Id,
+		RefereeId:  referee.Id,
+		Status:     structures.REFERRAL_PENDING,
+		Ip:         ip,
+		UserAgent:  userAgent,
+		DeviceName: deviceName,
+		CreatedAt:  time.Now().Unix(),
+	}
+
+	sessions, err := rs.sessionService.ListByUser(referrer.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := rs.ListByReferrer(ctx, referrer.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	counted := 0
+	for _, p := range previous {
+		if p.Status != structures.REFERRAL_REJECTED {
+			counted++
+		}
+	}
+
+	if referrer.Id == referee.Id || rs.sameClient(&referral, sessions, previous) {
+		referral.Status = structures.REFERRAL_REJECTED
+		referral.Reason = "Signed up from the same device or network as the referrer."
+	} else if counted >= rs.maxPerUser {
+		referral.Status = structures.REFERRAL_REJECTED
+		referral.Reason = "The referrer reached the referral limit."
+	}
+
+	res, err := rs.dbService.collection(ReferralCollectionName).InsertOne(ctx, referral)
+	if err != nil {
+		return nil, err
+	}
+
+	referral.Id = res.InsertedID.(primitive.ObjectID).Hex()
+
+	fmt.Printf("Recorded %v referral of user %v by user %v.\n", referral.Status, referee.Id, referrer.Id)
+
+	return &referral, nil
+}
+
+// sameClient reports whether a referral was made with the same user agent, from either the same
+// IP address or the same named device, as one of the referrer's sessions or one of their earlier
+// referrals. An IP address alone isn't enough, since schools, offices and carrier NAT put many
+// people behind one, as does a proxy that isn't configured as trusted.
+func (rs *ReferralService) sameClient(referral *structures.Referral, sessions []structures.Session,
+	previous []structures.Referral) bool {
+	matches := func(ip string, userAgent string, deviceName string) bool {
+		if referral.UserAgent == "" || referral.UserAgent != userAgent {
+			return false
+		}
+
+		return (referral.Ip != "" && referral.Ip == ip) ||
+			(referral.DeviceName != "" && referral.DeviceName == deviceName)
+	}
+
+	for _, session := range sessions {
+		if matches(session.Ip, session.UserAgent, session.DeviceName) {
+			return true
+		}
+	}
+
+	for _, p := range previous {
+		if matches(p.Ip, p.UserAgent, p.DeviceName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reward grants the bonuses of the user's pending referral, if they have one, when they claim
+// a disposal. The referral is only rewarded once, and is marked as rewarded along with granting
+// both bonuses. It returns the transactions added to the user's own ledger.
+func (rs *ReferralService) Reward(ctx context.Context, referee *structures.User,
+	claimedAt int64) ([]structures.Transaction, error) {
+	var referral structures.Referral
+	var referrerBonus, bonus *structures.Transaction
+
+	err := rs.dbService.WithTransaction(ctx, func(ctx context.Context) error {
+		referrerBonus, bonus = nil, nil
+
+		err := rs.dbService.collection(ReferralCollectionName).FindOneAndUpdate(ctx,
+			bson.M{"referee_id": referee.Id, "status": structures.REFERRAL_PENDING},
+			bson.M{"$set": bson.M{"status": structures.REFERRAL_REWARDED, "rewarded_at": claimedAt}},
+		).Decode(&referral)
+		if err != nil {
+			return err
+		}
+
+		// The referrer may have deleted their account since; that only forfeits their own bonus.
+		referrerBonus, err = rs.grant(ctx, referral.ReferrerId, rs.referrerBonus, claimedAt,
+			"Referral bonus for inviting a friend")
+		if err != nil && err != structures.ErrNoUser {
+			return err
+		}
+
+		bonus, err = rs.grant(ctx, referee.Id, rs.refereeBonus, claimedAt, "Referral bonus for joining")
+
+		return err
+	})
+	if err == mongo.ErrNoDocuments {
+		return []structures.Transaction{}, nil
+	} else if err != nil {
+		return []structures.Transaction{}, err
+	}
+
+	fmt.Printf("Rewarded referral of user %v by user %v.\n", referee.Id, referral.ReferrerId)
+
+	if referrerBonus != nil {
+		body := fmt.Sprintf("%s made their first claim, so you earned %.2f credits.", referee.Name,
+			referrerBonus.Credits)
+
+		err = rs.notificationService.Notify(ctx, referral.ReferrerId, &structures.Notification{
+			Category: structures.NOTIFY_CREDITS,
+			Title:    "Referral bonus",
+			Body:     body,
+		})
+		if err != nil {
+			fmt.Printf("Failed to notify user %v of their referral bonus: %v\n", referral.ReferrerId, err)
+		}
+	}
+
+	if bonus == nil {
+		return []structures.Transaction{}, nil
+	}
+
+	return []structures.Transaction{*bonus}, nil
+}
+
+// grant adds a bonus to the user's credits and ledger. It does nothing for a bonus of zero.
+func (rs *ReferralService) grant(ctx context.Context, userId string, credits float32, timestamp int64,
+	description string) (*structures.Transaction, error) {
+	if credits <= 0 {
+		return nil, nil
+	}
+
+	transaction := structures.Transaction{
+		TransactionType: structures.BONUS,
+		UserId:          userId,
+		Credits:         credits,
+		Timestamp:       timestamp,
+		Description:     description,
+	}
+
+	err := rs.dbService.CreditUserById(ctx, &transaction, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transaction, nil
+}
+
+// ListByReferrer returns the referrals made with the user's code, latest first.
+func (rs *ReferralService) ListByReferrer(ctx context.Context, userId string) ([]structures.Referral, error) {
+	cursor, err := rs.dbService.collection(ReferralCollectionName).Find(ctx, bson.M{"referrer_id": userId},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	referrals := []structures.Referral{}
+	err = cursor.All(ctx, &referrals)
+
+	return referrals, err
+}
+
+// DeleteAllByUser removes the referrals the user made or was invited by, along with the
+// client details recorded with them.
+func (rs *ReferralService) DeleteAllByUser(ctx context.Context, userId string) error {
+	_, err := rs.dbService.collection(ReferralCollectionName).DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"referrer_id": userId},
+		bson.M{"referee_id": userId},
+	}})
+
+	return err
+}
+
+func randomReadableCode(n int) string {
+	code := make([]byte, n)
+	for i := range code {
+		code[i] = readableCodeAlphabet[randomNumber(int64(len(readableCodeAlphabet)))]
+	}
+	return string(code)
+}
@@ -0,0 +1,430 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/cron"
+	"unreal.sh/echo/internal/structures"
+)
+
+const JobLeaseCollectionName = "job_leases"
+const JobRunCollectionName = "job_runs"
+
+const (
+	schedulerTickInterval = 15 * time.Second
+	defaultJobTimeout     = 30 * time.Minute
+
+	// jobRunRetention is how long the records of finished runs are kept.
+	jobRunRetention = 30 * 24 * time.Hour
+)
+
+// Job is a task run periodically by the SchedulerService.
+type Job struct {
+	// Name identifies the job across replicas and in its run history.
+	Name     string
+	Schedule cron.Schedule
+
+	// Local jobs run on every replica, for work on in-memory state. Other jobs run on a single
+	// replica at a time.
+	Local bool
+
+	// Timeout cancels the context of runs taking longer, defaulting to 30 minutes.
+	Timeout time.Duration
+
+	Run func(ctx context.Context) error
+}
+
+type scheduledJob struct {
+	Job
+
+	running atomic.Bool
+
+	// nextRunAt is when a local job is due. Other jobs keep it in their lease.
+	nextRunAt time.Time
+}
+
+// jobLease is shared by the replicas to agree on which one runs a job, and when.
+type jobLease struct {
+	Name      string `bson:"_id"`
+	Schedule  string `bson:"schedule"`
+	NextRunAt int64  `bson:"next_run_at"`
+
+	// Holder is the replica that last claimed the job. No other replica runs the job until
+	// LockedUntil, which is cleared once the run is over.
+	Holder      string `bson:"holder,omitempty"`
+	LockedUntil int64  `bson:"locked_until"`
+}
+
+// SchedulerService runs jobs on cron-like schedules. Jobs that aren't local are coordinated
+// through leases stored in the database: whichever replica first claims a due job runs it and
+// moves its lease to the next scheduled time, so each run happens once however many replicas
+// there are. Every run is recorded with its status and duration.
+type SchedulerService struct {
+	replica string
+
+	mu   sync.Mutex
+	jobs []*scheduledJob
+
+	dbService *DatabaseService
+}
+
+func (scs *SchedulerService) Init(ctx context.Context, dbService *DatabaseService) error {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "echo"
+	}
+
+	scs.replica = hostname + "-" + randomUrlString(6)
+	scs.dbService = dbService
+
+	_, err = dbService.collection(JobRunCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "job", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create job run indexes: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Register adds a job, to be run from Start. New jobs are due right away; the others keep the
+// schedule they had before the server restarted, unless it changed.
+func (scs *SchedulerService) Register(ctx context.Context, job Job) error {
+	if job.Name == "" || job.Schedule == nil || job.Run == nil {
+		return errors.New("jobs need a name, a schedule and a function to run")
+	}
+
+	if job.Timeout <= 0 {
+		job.Timeout = defaultJobTimeout
+	}
+
+	scs.mu.Lock()
+	defer scs.mu.Unlock()
+
+	for _, existing := range scs.jobs {
+		if existing.Name == job.Name {
+			return fmt.Errorf("job %v is already registered", job.Name)
+		}
+	}
+
+	now := time.Now()
+	if job.Schedule.Next(now).IsZero() {
+		return fmt.Errorf("the schedule of job %v never matches", job.Name)
+	}
+
+	scheduled := &scheduledJob{Job: job, nextRunAt: now}
+
+	if !job.Local {
+		leases := scs.dbService.collection(JobLeaseCollectionName)
+		spec := job.Schedule.String()
+
+		_, err := leases.UpdateOne(ctx, bson.M{"_id": job.Name},
+			bson.M{"$setOnInsert": bson.M{"schedule": spec, "next_run_at": now.Unix(), "locked_until": int64(0)}},
+			options.Update().SetUpsert(true))
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+
+		_, err = leases.UpdateOne(ctx, bson.M{"_id": job.Name, "schedule": bson.M{"$ne": spec}},
+			bson.M{"$set": bson.M{"schedule": spec, "next_run_at": job.Schedule.Next(now).Unix()}})
+		if err != nil {
+			return err
+		}
+	}
+
+	scs.jobs = append(scs.jobs, scheduled)
+
+	return nil
+}
+
+// Start runs the registered jobs when they're due, until ctx is done.
+func (scs *SchedulerService) Start(ctx context.Context) {
+	fmt.Printf("Starting job scheduler as replica %v.\n", scs.replica)
+
+	go func() {
+		ticker := time.NewTicker(schedulerTickInterval)
+		defer ticker.Stop()
+
+		for {
+			scs.runDue(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// runDue starts every job that is due and isn't already running on this replica.
+func (scs *SchedulerService) runDue(ctx context.Context) {
+	scs.mu.Lock()
+	jobs := append([]*scheduledJob{}, scs.jobs...)
+	scs.mu.Unlock()
+
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if !job.running.CompareAndSwap(false, true) {
+			continue
+		}
+
+		due, err := scs.claim(ctx, job)
+		if err != nil {
+			fmt.Printf("Failed to claim job %v: %v\n", job.Name, err)
+		}
+
+		if !due {
+			job.running.Store(false)
+			continue
+		}
+
+		go scs.run(ctx, job)
+	}
+}
+
+// claim reports whether the job is due, and if so schedules its next run. For jobs that
+// aren't local, it also locks the lease so other replicas don't run the job meanwhile.
+func (scs *SchedulerService) claim(ctx context.Context, job *scheduledJob) (bool, error) {
+	now := time.Now()
+
+	if job.Local {
+		scs.mu.Lock()
+		defer scs.mu.Unlock()
+
+		if now.Before(job.nextRunAt) {
+			return false, nil
+		}
+
+		job.nextRunAt = job.Schedule.Next(now)
+		return true, nil
+	}
+
+	err := scs.dbService.collection(JobLeaseCollectionName).FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":          job.Name,
+			"next_run_at":  bson.M{"$lte": now.Unix()},
+			"locked_until": bson.M{"$lte": now.Unix()},
+		},
+		bson.M{"$set": bson.M{
+			"next_run_at":  job.Schedule.Next(now).Unix(),
+			"holder":       scs.replica,
+			"locked_until": now.Add(job.Timeout + schedulerTickInterval).Unix(),
+		}},
+	).Err()
+
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	// The lock of the previous run could only have run out if its replica stopped midway.
+	_, err = scs.dbService.collection(JobRunCollectionName).UpdateMany(ctx,
+		bson.M{"job": job.Name, "status": structures.JOB_RUNNING},
+		bson.M{"$set": bson.M{
+			"status":     structures.JOB_FAILED,
+			"error":      "abandoned before finishing",
+			"expires_at": now.Add(jobRunRetention),
+		}})
+	if err != nil {
+		fmt.Printf("Failed to close abandoned runs of job %v: %v\n", job.Name, err)
+	}
+
+	return true, nil
+}
+
+// run runs a claimed job and records how it went.
+func (scs *SchedulerService) run(ctx context.Context, job *scheduledJob) {
+	defer job.running.Store(false)
+
+	runs := scs.dbService.collection(JobRunCollectionName)
+	startedAt := time.Now()
+
+	record := structures.JobRun{
+		Job:       job.Name,
+		Replica:   scs.replica,
+		Status:    structures.JOB_RUNNING,
+		StartedAt: startedAt.Unix(),
+	}
+
+	res, err := runs.InsertOne(ctx, record)
+	if err != nil {
+		fmt.Printf("Failed to record run of job %v: %v\n", job.Name, err)
+	}
+
+	runErr := scs.call(ctx, job)
+	finishedAt := time.Now()
+
+	update := bson.M{
+		"status":      structures.JOB_SUCCEEDED,
+		"finished_at": finishedAt.Unix(),
+		"duration_ms": finishedAt.Sub(startedAt).Milliseconds(),
+		"expires_at":  finishedAt.Add(jobRunRetention),
+	}
+
+	if runErr != nil {
+		fmt.Printf("Job %v failed: %v\n", job.Name, runErr)
+
+		update["status"] = structures.JOB_FAILED
+		update["error"] = runErr.Error()
+	}
+
+	if res != nil {
+		_, err = runs.UpdateOne(ctx, bson.M{"_id": res.InsertedID}, bson.M{"$set": update})
+		if err != nil {
+			fmt.Printf("Failed to record run of job %v: %v\n", job.Name, err)
+		}
+	}
+
+	if !job.Local {
+		_, err = scs.dbService.collection(JobLeaseCollectionName).UpdateOne(ctx,
+			bson.M{"_id": job.Name, "holder": scs.replica},
+			bson.M{"$set": bson.M{"locked_until": int64(0)}})
+		if err != nil {
+			fmt.Printf("Failed to release job %v: %v\n", job.Name, err)
+		}
+	}
+}
+
+// call runs the job with its timeout, turning a panic into an error so it doesn't take the
+// server down.
+func (scs *SchedulerService) call(ctx context.Context, job *scheduledJob) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return job.Run(ctx)
+}
+
+// Trigger makes a job due right away, so it runs within the next few seconds. Local jobs are
+// only triggered on this replica.
+func (scs *SchedulerService) Trigger(ctx context.Context, name string) (*structures.JobInfo, error) {
+	job := scs.find(name)
+	if job == nil {
+		return nil, structures.ErrNoJob
+	}
+
+	if job.Local {
+		scs.mu.Lock()
+		job.nextRunAt = time.Now()
+		scs.mu.Unlock()
+	} else {
+		_, err := scs.dbService.collection(JobLeaseCollectionName).UpdateOne(ctx, bson.M{"_id": name},
+			bson.M{"$set": bson.M{"next_run_at": time.Now().Unix()}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return scs.info(ctx, job)
+}
+
+// ListJobs describes every registered job, in the order they were registered.
+func (scs *SchedulerService) ListJobs(ctx context.Context) ([]structures.JobInfo, error) {
+	scs.mu.Lock()
+	jobs := append([]*scheduledJob{}, scs.jobs...)
+	scs.mu.Unlock()
+
+	result := []structures.JobInfo{}
+
+	for _, job := range jobs {
+		info, err := scs.info(ctx, job)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, *info)
+	}
+
+	return result, nil
+}
+
+// ListRuns returns the latest runs of a job, newest first. The runs of local jobs come from
+// every replica.
+func (scs *SchedulerService) ListRuns(ctx context.Context, name string, limit int) ([]structures.JobRun, error) {
+	if scs.find(name) == nil {
+		return nil, structures.ErrNoJob
+	}
+
+	result := []structures.JobRun{}
+
+	cur, err := scs.dbService.collection(JobRunCollectionName).Find(ctx, bson.M{"job": name},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	err = cur.All(ctx, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (scs *SchedulerService) find(name string) *scheduledJob {
+	scs.mu.Lock()
+	defer scs.mu.Unlock()
+
+	for _, job := range scs.jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+
+	return nil
+}
+
+func (scs *SchedulerService) info(ctx context.Context, job *scheduledJob) (*structures.JobInfo, error) {
+	info := structures.JobInfo{
+		Name:     job.Name,
+		Schedule: job.Schedule.String(),
+		Local:    job.Local,
+	}
+
+	if job.Local {
+		scs.mu.Lock()
+		info.NextRunAt = job.nextRunAt.Unix()
+		scs.mu.Unlock()
+	} else {
+		var lease jobLease
+		err := scs.dbService.collection(JobLeaseCollectionName).FindOne(ctx, bson.M{"_id": job.Name}).Decode(&lease)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+
+		info.NextRunAt = lease.NextRunAt
+	}
+
+	var lastRun structures.JobRun
+	err := scs.dbService.collection(JobRunCollectionName).FindOne(ctx, bson.M{"job": job.Name},
+		options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})).Decode(&lastRun)
+	if err == nil {
+		info.LastRun = &lastRun
+	} else if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	return &info, nil
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+const SessionCollectionName = "sessions"
+
+const (
+	// SessionLifetime is how long a session lasts without being refreshed.
+	SessionLifetime = 30 * 24 * time.Hour
+
+	// sessionTouchInterval throttles how often a session's last used time is written.
+	sessionTouchInterval = 5 * time.Minute
+)
+
+type SessionService struct {
+	dbService *DatabaseService
+}
+
+func (ss *SessionService) Init(ctx context.Context, dbService *DatabaseService) error {
+	ss.dbService = dbService
+
+	_, err := dbService.collection(SessionCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create session indexes: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Create records a new session for the user.
+func (ss *SessionService) Create(userId string, deviceName string, userAgent string, ip string) (*structures.Session, error) {
+	now := time.Now()
+
+	session := structures.Session{
+		UserId:     userId,
+		DeviceName: deviceName,
+		UserAgent:  userAgent,
+		Ip:         ip,
+		CreatedAt:  now.Unix(),
+		LastUsedAt: now.Unix(),
+		ExpiresAt:  now.Add(SessionLifetime),
+	}
+
+	res, err := ss.dbService.collection(SessionCollectionName).InsertOne(context.Background(), session)
+	if err != nil {
+		fmt.Printf("Failed to create session for user %v: %v\n", userId, err)
+		return nil, err
+	}
+
+	session.Id = res.InsertedID.(primitive.ObjectID).Hex()
+
+	return &session, nil
+}
+
+// Get returns the user's session with the given ID, or ErrNoSession if it was revoked or expired.
+func (ss *SessionService) Get(userId string, sessionId string) (*structures.Session, error) {
+	var result structures.Session
+
+	objectId, err := primitive.ObjectIDFromHex(sessionId)
+	if err != nil {
+		return nil, structures.ErrNoSession
+	}
+
+	filter := bson.M{"_id": objectId, "user_id": userId, "expires_at": bson.M{"$gt": time.Now()}}
+
+	err = ss.dbService.collection(SessionCollectionName).FindOne(context.Background(), filter).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrNoSession
+	} else if err != nil {
+		fmt.Printf("Failed to get session %v: %v\n", sessionId, err)
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Touch updates the session's last used time, IP address and user agent.
+// It writes at most once every few minutes per session, and only on refresh extends its expiry.
+func (ss *SessionService) Touch(session *structures.Session, userAgent string, ip string, refresh bool) error {
+	now := time.Now()
+	if !refresh && now.Sub(time.Unix(session.LastUsedAt, 0)) < sessionTouchInterval {
+		return nil
+	}
+
+	objectId, err := primitive.ObjectIDFromHex(session.Id)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	filter := bson.M{"_id": objectId}
+	if !refresh {
+		// Another replica may have just touched it.
+		filter["last_used_at"] = bson.M{"$lt": now.Add(-sessionTouchInterval).Unix()}
+	}
+
+	set := bson.M{"last_used_at": now.Unix(), "user_agent": userAgent, "ip": ip}
+	if refresh {
+		set["expires_at"] = now.Add(SessionLifetime)
+	}
+
+	_, err = ss.dbService.collection(SessionCollectionName).UpdateOne(context.Background(), filter, bson.M{"$set": set})
+	if err != nil {
+		fmt.Printf("Failed to touch session %v: %v\n", session.Id, err)
+		return err
+	}
+
+	return nil
+}
+
+// ListByUser returns the user's active sessions, most recently used first.
+func (ss *SessionService) ListByUser(userId string) ([]structures.Session, error) {
+	result := []structures.Session{}
+
+	filter := bson.M{"user_id": userId, "expires_at": bson.M{"$gt": time.Now()}}
+
+	cur, err := ss.dbService.collection(SessionCollectionName).Find(context.Background(), filter,
+		options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}}))
+	if err != nil {
+		fmt.Printf("Failed to get sessions for user %v: %v\n", userId, err)
+		return nil, err
+	}
+
+	err = cur.All(context.Background(), &result)
+	if err != nil {
+		fmt.Printf("Failed to get sessions for user %v: %v\n", userId, err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Revoke deletes one of the user's sessions, invalidating the tokens issued for it.
+func (ss *SessionService) Revoke(userId string, sessionId string) error {
+	objectId, err := primitive.ObjectIDFromHex(sessionId)
+	if err != nil {
+		return structures.ErrNoSession
+	}
+
+	res, err := ss.dbService.collection(SessionCollectionName).DeleteOne(context.Background(),
+		bson.M{"_id": objectId, "user_id": userId})
+	if err != nil {
+		fmt.Printf("Failed to revoke session %v: %v\n", sessionId, err)
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return structures.ErrNoSession
+	}
+
+	fmt.Printf("Revoked session %v of user %v.\n", sessionId, userId)
+
+	return nil
+}
+
+// RevokeAllByUser deletes every session of the user.
+func (ss *SessionService) RevokeAllByUser(userId string) error {
+	_, err := ss.dbService.collection(SessionCollectionName).DeleteMany(context.Background(), bson.M{"user_id": userId})
+	if err != nil {
+		fmt.Printf("Failed to revoke sessions of user %v: %v\n", userId, err)
+		return err
+	}
+
+	return nil
+}
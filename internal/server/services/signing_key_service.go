@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+
+	"unreal.sh/echo/internal/structures"
+)
+
+// SigningKey is a private key used to sign tokens, identified by the `kid` header.
+type SigningKey struct {
+	Id     string
+	Method jwt.SigningMethod
+
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// SigningKeyService signs tokens with the active key, and verifies tokens signed with any loaded key.
+//
+// Keys are read from the PEM files in JWT_KEYS_DIR, each named after its key ID (e.g. 2024-06.pem).
+// RSA keys sign with RS256 and Ed25519 keys with EdDSA. JWT_ACTIVE_KEY_ID selects the signing key,
+// defaulting to the last ID in lexical order. To rotate, add a new key and make it active;
+// keep the previous file around until the tokens it signed have expired.
+type SigningKeyService struct {
+	keys   map[string]*SigningKey
+	active *SigningKey
+}
+
+func (sks *SigningKeyService) Init(ctx context.Context) error {
+	dir, found := os.LookupEnv("JWT_KEYS_DIR")
+	if !found {
+		return errors.New("missing JWT_KEYS_DIR environment variable")
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	if len(paths) == 0 {
+		return fmt.Errorf("no signing keys found in %s", dir)
+	}
+
+	sort.Strings(paths)
+
+	sks.keys = make(map[string]*SigningKey)
+	for _, path := range paths {
+		key, err := loadSigningKey(path)
+		if err != nil {
+			return fmt.Errorf("failed to load signing key %s: %w", path, err)
+		}
+
+		sks.keys[key.Id] = key
+		sks.active = key
+	}
+
+	if activeId := os.Getenv("JWT_ACTIVE_KEY_ID"); activeId != "" {
+		active, found := sks.keys[activeId]
+		if !found {
+			return fmt.Errorf("active signing key %s not found in %s", activeId, dir)
+		}
+		sks.active = active
+	}
+
+	fmt.Printf("Loaded %d signing keys, signing with %s.\n", len(sks.keys), sks.active.Id)
+
+	return nil
+}
+
+// Sign returns the token for the given claims, signed with the active key.
+func (sks *SigningKeyService) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(sks.active.Method, claims)
+	token.Header["kid"] = sks.active.Id
+
+	return token.SignedString(sks.active.private)
+}
+
+// Keyfunc returns the key that should have signed the token, to be passed to jwt.Parse.
+// It rejects tokens without a `kid` header, and tokens whose algorithm doesn't match the key it names.
+func (sks *SigningKeyService) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, found := sks.keys[kid]
+	if !found || key.Method.Alg() != token.Method.Alg() {
+		return nil, structures.ErrInvalidToken
+	}
+
+	return key.public, nil
+}
+
+// JWKS returns the public keys of every loaded signing key.
+func (sks *SigningKeyService) JWKS() structures.JSONWebKeySet {
+	ids := make([]string, 0, len(sks.keys))
+	for id := range sks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := structures.JSONWebKeySet{Keys: make([]structures.JSONWebKey, 0, len(ids))}
+	for _, id := range ids {
+		key := sks.keys[id]
+
+		jwk := structures.JSONWebKey{KeyId: key.Id, Use: "sig", Algorithm: key.Method.Alg()}
+
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.Modulus = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+func loadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var private crypto.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{
+		Id:      strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		private: private,
+	}
+
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.public = &private.PublicKey
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.public = private.Public()
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+
+	return key, nil
+}
@@ -2,13 +2,22 @@ package services
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"unreal.sh/echo/internal/structures"
 )
 
+// stationRegistrationLifetime is how long a station stays listed after registering.
+const stationRegistrationLifetime = 5 * time.Minute
+
 type StationsService struct {
 	Locations []structures.LocationClaim
+
+	// expiresAt holds when each of Locations, which are in the order they registered, expires.
+	expiresAt []time.Time
+
+	mu sync.RWMutex
 }
 
 func (ss *StationsService) Init(ctx context.Context) {
@@ -16,8 +25,57 @@ func (ss *StationsService) Init(ctx context.Context) {
 }
 
 func (ss *StationsService) RegisterStation(station structures.LocationClaim) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
 	ss.Locations = append(ss.Locations, station)
-	time.AfterFunc(5*time.Minute, func() {
-		ss.Locations = ss.Locations[1:]
-	})
+	ss.expiresAt = append(ss.expiresAt, time.Now().Add(stationRegistrationLifetime))
+}
+
+// RemoveExpired forgets the registrations that expired. Until then they're only hidden.
+func (ss *StationsService) RemoveExpired(ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	expired := ss.expired(time.Now())
+
+	ss.Locations = ss.Locations[expired:]
+	ss.expiresAt = ss.expiresAt[expired:]
+
+	return nil
+}
+
+// expired returns how many registrations, from the oldest, expired by the given time.
+func (ss *StationsService) expired(now time.Time) int {
+	for i, expiresAt := range ss.expiresAt {
+		if now.Before(expiresAt) {
+			return i
+		}
+	}
+
+	return len(ss.expiresAt)
+}
+
+// GetLocations returns the stations currently registered.
+func (ss *StationsService) GetLocations() []structures.LocationClaim {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	return append([]structures.LocationClaim{}, ss.Locations[ss.expired(time.Now()):]...)
+}
+
+// GetStation returns the latest registration of the station with the given ID, if it's still registered.
+func (ss *StationsService) GetStation(stationId string) (structures.LocationClaim, bool) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	oldest := ss.expired(time.Now())
+
+	for i := len(ss.Locations) - 1; i >= oldest; i-- {
+		if ss.Locations[i].StationId == stationId {
+			return ss.Locations[i], true
+		}
+	}
+
+	return structures.LocationClaim{}, false
 }
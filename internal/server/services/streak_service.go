@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
+)
+
+// StreakService tracks how consistently users recycle, as daily and weekly streaks
+// counted in each user's time zone.
+type StreakService struct {
+	// grace is how long after a missed day or week a claim still continues the streak.
+	grace      time.Duration
+	milestones []structures.StreakMilestone
+
+	dbService *DatabaseService
+}
+
+// Init reads the grace period, in hours, from STREAK_GRACE_HOURS, defaulting to 6, and the
+// milestones from STREAK_MILESTONES, a comma-separated list of type:length:credits, such as
+// "daily:7:50,weekly:4:100". Streaks grant no bonus credits when it's unset.
+func (sts *StreakService) Init(ctx context.Context, dbService *DatabaseService) error {
+	hours, err := strconv.Atoi(utils.GetenvOr("STREAK_GRACE_HOURS", "6"))
+	if err != nil || hours < 0 {
+		return errors.New("invalid STREAK_GRACE_HOURS environment variable")
+	}
+	sts.grace = time.Duration(hours) * time.Hour
+
+	sts.milestones, err = parseStreakMilestones(utils.GetenvOr("STREAK_MILESTONES", ""))
+	if err != nil {
+		return err
+	}
+
+	sts.dbService = dbService
+
+	return nil
+}
+
+// streakRetries is how many times Record recomputes streaks changed by a concurrent claim.
+const streakRetries = 3
+
+// Record updates the user's streaks with a claim made at the given time, and grants the bonus
+// of every milestone reached. It returns the bonus transactions added to the user's ledger, and
+// the milestones they were granted for.
+//
+// Streaks are only updated if they are still as they were loaded, so that concurrent claims
+// can't both reach the same milestone. When they changed, they are reloaded and recomputed.
+func (sts *StreakService) Record(ctx context.Context, user *structures.User,
+	claimedAt int64) ([]structures.Transaction, []structures.StreakMilestone, error) {
+	objectId, err := primitive.ObjectIDFromHex(user.Id)
+	if err != nil {
+		return nil, nil, structures.ErrInvalidDatabaseId
+	}
+
+	location := userLocation(user)
+	at := time.Unix(claimedAt, 0)
+
+	for attempt := 0; attempt < streakRetries; attempt++ {
+		daily, dailyAdvanced := sts.advance(user.DailyStreak, structures.DAILY, at, location)
+		weekly, weeklyAdvanced := sts.advance(user.WeeklyStreak, structures.WEEKLY, at, location)
+
+		bonuses, reached := sts.reached(user.Id, claimedAt, daily, dailyAdvanced, weekly, weeklyAdvanced)
+		matched := false
+
+		err = sts.dbService.WithTransaction(ctx, func(ctx context.Context) error {
+			res, err := sts.dbService.collection(UserCollectionName).UpdateOne(ctx, bson.M{
+				"_id":                       objectId,
+				"daily_streak.current":      storedAs(user.DailyStreak.Current),
+				"daily_streak.last_period":  storedAs(user.DailyStreak.LastPeriod),
+				"weekly_streak.current":     storedAs(user.WeeklyStreak.Current),
+				"weekly_streak.last_period": storedAs(user.WeeklyStreak.LastPeriod),
+			}, bson.M{"$set": bson.M{
+				"daily_streak":  daily,
+				"weekly_streak": weekly,
+			}})
+			if err != nil {
+				return err
+			}
+
+			matched = res.MatchedCount > 0
+			if !matched {
+				return nil
+			}
+
+			for i := range bonuses {
+				err = sts.dbService.CreditUserById(ctx, &bonuses[i], user.Id)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if matched {
+			user.DailyStreak = daily
+			user.WeeklyStreak = weekly
+
+			return bonuses, reached, nil
+		}
+
+		current, err := sts.dbService.GetUserById(user.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		user.DailyStreak = current.DailyStreak
+		user.WeeklyStreak = current.WeeklyStreak
+	}
+
+	return nil, nil, fmt.Errorf("streaks of user %v kept changing concurrently", user.Id)
+}
+
+// reached returns the bonus transactions for the milestones reached by advancing the streaks,
+// and those milestones.
+func (sts *StreakService) reached(userId string, claimedAt int64, daily structures.Streak, dailyAdvanced bool,
+	weekly structures.Streak, weeklyAdvanced bool) ([]structures.Transaction, []structures.StreakMilestone) {
+	bonuses := []structures.Transaction{}
+	reached := []structures.StreakMilestone{}
+
+	for _, milestone := range sts.milestones {
+		streak, advanced := daily, dailyAdvanced
+		if milestone.Type == structures.WEEKLY {
+			streak, advanced = weekly, weeklyAdvanced
+		}
+
+		if !advanced || streak.Current != milestone.Length {
+			continue
+		}
+
+		unit := "day"
+		if milestone.Type == structures.WEEKLY {
+			unit = "week"
+		}
+
+		bonuses = append(bonuses, structures.Transaction{
+			TransactionType: structures.BONUS,
+			UserId:          userId,
+			Credits:         milestone.Credits,
+			Timestamp:       claimedAt,
+			Description:     fmt.Sprintf("Reached a %d-%s streak", milestone.Length, unit),
+		})
+		reached = append(reached, milestone)
+	}
+
+	return bonuses, reached
+}
+
+// storedAs matches a field holding the value. A zero value also matches a missing field, as in
+// users from before the field existed.
+func storedAs[T comparable](value T) any {
+	var zero T
+	if value == zero {
+		return bson.M{"$in": bson.A{value, nil}}
+	}
+	return value
+}
+
+// advance returns the streak after a claim at the given time, and whether its length changed.
+// A claim in the same period as the previous one leaves the streak as it was.
+func (sts *StreakService) advance(streak structures.Streak, streakType structures.StreakType, at time.Time,
+	location *time.Location) (structures.Streak, bool) {
+	period := streakPeriod(streakType, at, location)
+
+	if streak.Current > 0 && period == streak.LastPeriod {
+		return streak, false
+	}
+
+	if streak.Current > 0 && period > streak.LastPeriod && at.Unix() < streak.ExpiresAt {
+		streak.Current++
+	} else {
+		streak.Current = 1
+	}
+
+	streak.Longest = max(streak.Longest, streak.Current)
+	streak.LastPeriod = period
+
+	// The next claim has to come within the following period, or shortly after it.
+	streak.ExpiresAt = streakPeriodStart(streakType, period+2, location).Add(sts.grace).Unix()
+
+	return streak, true
+}
+
+// userLocation returns the time zone the user's streaks are counted in.
+func userLocation(user *structures.User) *time.Location {
+	if user.Timezone != "" {
+		location, err := time.LoadLocation(user.Timezone)
+		if err == nil {
+			return location
+		}
+	}
+
+	return time.UTC
+}
+
+// streakPeriod returns the number of the day or week containing t in the given time zone,
+// counted from the Unix epoch. Weeks start on Monday.
+func streakPeriod(streakType structures.StreakType, t time.Time, location *time.Location) int64 {
+	year, month, day := t.In(location).Date()
+	dayNumber := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / int64((24 * time.Hour).Seconds())
+
+	if streakType == structures.WEEKLY {
+		// The epoch was a Thursday, three days after the Monday that starts week zero.
+		return floorDiv(dayNumber+3, 7)
+	}
+
+	return dayNumber
+}
+
+// streakPeriodStart returns when the given day or week starts in the given time zone.
+func streakPeriodStart(streakType structures.StreakType, period int64, location *time.Location) time.Time {
+	dayNumber := period
+	if streakType == structures.WEEKLY {
+		dayNumber = period*7 - 3
+	}
+
+	date := time.Unix(dayNumber*int64((24*time.Hour).Seconds()), 0).UTC()
+
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, location)
+}
+
+func floorDiv(a int64, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func parseStreakMilestones(value string) ([]structures.StreakMilestone, error) {
+	milestones := []structures.StreakMilestone{}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid streak milestone %q", entry)
+		}
+
+		streakType := structures.StreakType(parts[0])
+		length, lengthErr := strconv.Atoi(parts[1])
+		credits, creditsErr := strconv.ParseFloat(parts[2], 32)
+
+		if (streakType != structures.DAILY && streakType != structures.WEEKLY) ||
+			lengthErr != nil || length < 1 || creditsErr != nil || credits <= 0 {
+			return nil, fmt.Errorf("invalid streak milestone %q", entry)
+		}
+
+		milestones = append(milestones, structures.StreakMilestone{
+			Type:    streakType,
+			Length:  length,
+			Credits: float32(credits),
+		})
+	}
+
+	return milestones, nil
+}
@@ -0,0 +1,558 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
+)
+
+const TeamCollectionName = "teams"
+const ChallengeCollectionName = "challenges"
+
+const teamInviteCodeLength = 10
+
+// teamChallengeLimit is how many of the latest challenges are shown on a team.
+const teamChallengeLimit = 20
+
+// TeamService manages teams and the challenges they compete in. Claims count towards the team
+// the user was in when making them, so totals don't change as members come and go.
+type TeamService struct {
+	maxMembers int
+
+	dbService      *DatabaseService
+	profileService *ProfileService
+}
+
+// Init reads the most members a team can have from TEAM_MAX_MEMBERS, defaulting to 100.
+func (tms *TeamService) Init(ctx context.Context, dbService *DatabaseService, profileService *ProfileService) error {
+	maxMembers, err := strconv.Atoi(utils.GetenvOr("TEAM_MAX_MEMBERS", "100"))
+	if err != nil || maxMembers < 1 {
+		return errors.New("invalid TEAM_MAX_MEMBERS environment variable")
+	}
+
+	tms.maxMembers = maxMembers
+	tms.dbService = dbService
+	tms.profileService = profileService
+
+	_, err = dbService.collection(TeamCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "invite_code", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		fmt.Printf("Failed to create team indexes: %v\n", err)
+		return err
+	}
+
+	_, err = dbService.collection(UserCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "team_id", Value: 1}},
+		Options: options.Index().SetPartialFilterExpression(
+			bson.M{"team_id": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		fmt.Printf("Failed to create team member index: %v\n", err)
+		return err
+	}
+
+	_, err = dbService.collection(DisposalCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "team_id", Value: 1}, {Key: "claimed_at", Value: 1}},
+		Options: options.Index().SetPartialFilterExpression(
+			bson.M{"team_id": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		fmt.Printf("Failed to create disposal team index: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Get returns the team with the given ID, or ErrNoTeam.
+func (tms *TeamService) Get(ctx context.Context, id string) (*structures.Team, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, structures.ErrNoTeam
+	}
+
+	var team structures.Team
+	err = tms.dbService.collection(TeamCollectionName).FindOne(ctx, bson.M{"_id": objectId}).Decode(&team)
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrNoTeam
+	}
+
+	return &team, err
+}
+
+// GetNames returns the names of the teams with the given IDs, keyed by ID. Unknown IDs are left out.
+func (tms *TeamService) GetNames(ctx context.Context, ids []string) (map[string]string, error) {
+	objectIds := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		objectId, err := primitive.ObjectIDFromHex(id)
+		if err == nil {
+			objectIds = append(objectIds, objectId)
+		}
+	}
+
+	cursor, err := tms.dbService.collection(TeamCollectionName).Find(ctx, bson.M{"_id": bson.M{"$in": objectIds}},
+		options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var teams []structures.Team
+	err = cursor.All(ctx, &teams)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(teams))
+	for _, team := range teams {
+		names[team.Id] = team.Name
+	}
+
+	return names, nil
+}
+
+// Create makes a new team owned by the user, who becomes its first member.
+func (tms *TeamService) Create(ctx context.Context, user *structures.User, team *structures.Team) error {
+	if user.TeamId != "" {
+		return structures.ErrAlreadyInTeam
+	}
+
+	team.Id = ""
+	team.OwnerId = user.Id
+	team.MemberCount = 1
+	team.CreatedAt = time.Now().Unix()
+
+	teams := tms.dbService.collection(TeamCollectionName)
+
+	var res *mongo.InsertOneResult
+	var err error
+
+	for attempt := 0; attempt < 5; attempt++ {
+		team.InviteCode = randomReadableCode(teamInviteCodeLength)
+
+		res, err = teams.InsertOne(ctx, team)
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	teamId := res.InsertedID.(primitive.ObjectID)
+	team.Id = teamId.Hex()
+
+	err = tms.setTeam(ctx, user, team.Id)
+	if err != nil {
+		_, deleteErr := teams.DeleteOne(ctx, bson.M{"_id": teamId})
+		if deleteErr != nil {
+			fmt.Printf("Failed to remove team %v: %v\n", team.Id, deleteErr)
+		}
+		return err
+	}
+
+	fmt.Printf("User %v created team %v.\n", user.Id, team.Id)
+
+	return nil
+}
+
+// Join adds the user to the team with the given invite code.
+func (tms *TeamService) Join(ctx context.Context, user *structures.User, inviteCode string) (*structures.Team, error) {
+	if user.TeamId != "" {
+		return nil, structures.ErrAlreadyInTeam
+	}
+
+	teams := tms.dbService.collection(TeamCollectionName)
+	code := strings.ToUpper(strings.TrimSpace(inviteCode))
+
+	var team structures.Team
+	err := teams.FindOneAndUpdate(ctx,
+		bson.M{"invite_code": code, "member_count": bson.M{"$lt": tms.maxMembers}},
+		bson.M{"$inc": bson.M{"member_count": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&team)
+	if err == mongo.ErrNoDocuments {
+		count, err := teams.CountDocuments(ctx, bson.M{"invite_code": code})
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, structures.ErrTeamFull
+		}
+		return nil, structures.ErrNoTeam
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = tms.setTeam(ctx, user, team.Id)
+	if err != nil {
+		tms.removeMember(ctx, team.Id, user.Id)
+		return nil, err
+	}
+
+	fmt.Printf("User %v joined team %v.\n", user.Id, team.Id)
+
+	return &team, nil
+}
+
+// Leave removes the user from their team. The team is deleted once its last member leaves,
+// and handed over to another member if its owner does. Claims made in it still count towards it.
+func (tms *TeamService) Leave(ctx context.Context, user *structures.User) error {
+	if user.TeamId == "" {
+		return structures.ErrNotInTeam
+	}
+
+	objectId, err := primitive.ObjectIDFromHex(user.Id)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	teamId := user.TeamId
+
+	res, err := tms.dbService.collection(UserCollectionName).UpdateOne(ctx,
+		bson.M{"_id": objectId, "team_id": teamId}, bson.M{"$unset": bson.M{"team_id": ""}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return structures.ErrNotInTeam
+	}
+
+	user.TeamId = ""
+
+	fmt.Printf("User %v left team %v.\n", user.Id, teamId)
+
+	tms.removeMember(ctx, teamId, user.Id)
+
+	return nil
+}
+
+// setTeam makes the user a member of the team, unless they're already in one.
+func (tms *TeamService) setTeam(ctx context.Context, user *structures.User, teamId string) error {
+	objectId, err := primitive.ObjectIDFromHex(user.Id)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	res, err := tms.dbService.collection(UserCollectionName).UpdateOne(ctx,
+		bson.M{"_id": objectId, "team_id": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"team_id": teamId}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return structures.ErrAlreadyInTeam
+	}
+
+	user.TeamId = teamId
+
+	return nil
+}
+
+// removeMember updates a team after one of its members left, deleting it if it's now empty,
+// or handing it over to another member if they owned it. Failures are only logged, as the
+// user is out of the team either way.
+func (tms *TeamService) removeMember(ctx context.Context, teamId string, userId string) {
+	objectId, err := primitive.ObjectIDFromHex(teamId)
+	if err != nil {
+		return
+	}
+
+	teams := tms.dbService.collection(TeamCollectionName)
+
+	var team structures.Team
+	err = teams.FindOneAndUpdate(ctx, bson.M{"_id": objectId}, bson.M{"$inc": bson.M{"member_count": -1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&team)
+	if err != nil {
+		fmt.Printf("Failed to update team %v: %v\n", teamId, err)
+		return
+	}
+
+	if team.MemberCount <= 0 {
+		_, err = teams.DeleteOne(ctx, bson.M{"_id": objectId, "member_count": bson.M{"$lte": 0}})
+		if err != nil {
+			fmt.Printf("Failed to delete team %v: %v\n", teamId, err)
+		}
+		return
+	}
+
+	if team.OwnerId != userId {
+		return
+	}
+
+	var successor structures.User
+	err = tms.dbService.collection(UserCollectionName).FindOne(ctx, bson.M{"team_id": teamId},
+		options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&successor)
+	if err != nil {
+		fmt.Printf("Failed to find a new owner for team %v: %v\n", teamId, err)
+		return
+	}
+
+	_, err = teams.UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{"$set": bson.M{"owner_id": successor.Id}})
+	if err != nil {
+		fmt.Printf("Failed to hand team %v over: %v\n", teamId, err)
+	}
+}
+
+// Totals sums the claims made for the team.
+func (tms *TeamService) Totals(ctx context.Context, teamId string) (structures.TeamTotals, error) {
+	totals, err := tms.aggregateTotals(ctx, teamId, 0, 0, nil, "$team_id")
+	if err != nil {
+		return structures.TeamTotals{}, err
+	}
+
+	return totals[teamId], nil
+}
+
+// Members returns the current members of the team with what each contributed to it, the largest
+// contributors first. Members the viewer isn't allowed to see are shown as hidden.
+func (tms *TeamService) Members(ctx context.Context, viewer *structures.User,
+	team *structures.Team) ([]structures.TeamMember, error) {
+	cursor, err := tms.dbService.collection(UserCollectionName).Find(ctx, bson.M{"team_id": team.Id},
+		options.Find().SetProjection(bson.M{"transactions": 0}))
+	if err != nil {
+		return nil, err
+	}
+
+	var users []structures.User
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		return nil, err
+	}
+
+	contributions, err := tms.aggregateTotals(ctx, team.Id, 0, 0, nil, "$user_id")
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]structures.TeamMember, len(users))
+	for i := range users {
+		member := structures.TeamMember{
+			UserId:       users[i].Id,
+			IsOwner:      users[i].Id == team.OwnerId,
+			Contribution: contributions[users[i].Id],
+		}
+
+		if tms.profileService.CanView(viewer, &users[i]) {
+			member.Name = users[i].Name
+			member.Username = users[i].Username
+		} else {
+			member.Hidden = true
+		}
+
+		members[i] = member
+	}
+
+	slices.SortStableFunc(members, func(a, b structures.TeamMember) int {
+		return cmp.Compare(b.Contribution.Credits, a.Contribution.Credits)
+	})
+
+	return members, nil
+}
+
+// Progress returns how far the team got in the latest challenges that have started.
+func (tms *TeamService) Progress(ctx context.Context, teamId string) ([]structures.ChallengeProgress, error) {
+	cursor, err := tms.dbService.collection(ChallengeCollectionName).Find(ctx,
+		bson.M{"starts_at": bson.M{"$lte": time.Now().Unix()}},
+		options.Find().SetSort(bson.D{{Key: "starts_at", Value: -1}}).SetLimit(teamChallengeLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	var challenges []structures.Challenge
+	err = cursor.All(ctx, &challenges)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := make([]structures.ChallengeProgress, len(challenges))
+	for i, challenge := range challenges {
+		totals, err := tms.aggregateTotals(ctx, teamId, challenge.StartsAt, challenge.EndsAt,
+			challenge.DisposalType, "$team_id")
+		if err != nil {
+			return nil, err
+		}
+
+		value := totals[teamId].Credits
+		if challenge.Metric == structures.METRIC_WEIGHT {
+			value = totals[teamId].Weight
+		}
+
+		progress[i] = structures.ChallengeProgress{
+			Challenge: challenge,
+			Value:     value,
+			Completed: value >= challenge.Goal,
+		}
+	}
+
+	return progress, nil
+}
+
+// aggregateTotals sums the team's claims made between from and to, keyed by the given field.
+// Only disposals of the given type count, if one is given. A zero to means no upper bound.
+func (tms *TeamService) aggregateTotals(ctx context.Context, teamId string, from int64, to int64,
+	disposalType *structures.DisposalType, groupBy string) (map[string]structures.TeamTotals, error) {
+	claimedAt := bson.M{"$gte": from}
+	if to != 0 {
+		claimedAt["$lt"] = to
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"team_id": teamId, "is_claimed": true, "claimed_at": claimedAt}},
+		bson.M{"$unwind": "$disposals"},
+	}
+
+	if disposalType != nil {
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"disposals.disposaltype": *disposalType}})
+	}
+
+	pipeline = append(pipeline,
+		bson.M{"$group": bson.M{
+			"_id":     bson.M{"claim": "$_id", "key": groupBy},
+			"credits": bson.M{"$sum": "$disposals.credits"},
+			"weight":  bson.M{"$sum": "$disposals.weight"},
+		}},
+		bson.M{"$group": bson.M{
+			"_id":     "$_id.key",
+			"credits": bson.M{"$sum": "$credits"},
+			"weight":  bson.M{"$sum": "$weight"},
+			"claims":  bson.M{"$sum": 1},
+		}},
+	)
+
+	cursor, err := tms.dbService.collection(DisposalCollectionName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Key                   string `bson:"_id"`
+		structures.TeamTotals `bson:",inline"`
+	}
+	err = cursor.All(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]structures.TeamTotals, len(rows))
+	for _, row := range rows {
+		totals[row.Key] = row.TeamTotals
+	}
+
+	return totals, nil
+}
+
+// ListChallenges returns every challenge, latest first.
+func (tms *TeamService) ListChallenges(ctx context.Context) ([]structures.Challenge, error) {
+	cursor, err := tms.dbService.collection(ChallengeCollectionName).Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "starts_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	challenges := []structures.Challenge{}
+	err = cursor.All(ctx, &challenges)
+
+	return challenges, err
+}
+
+// GetChallenge returns the challenge with the given ID, or ErrNoChallenge.
+func (tms *TeamService) GetChallenge(ctx context.Context, id string) (*structures.Challenge, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, structures.ErrNoChallenge
+	}
+
+	var challenge structures.Challenge
+	err = tms.dbService.collection(ChallengeCollectionName).FindOne(ctx, bson.M{"_id": objectId}).Decode(&challenge)
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrNoChallenge
+	}
+
+	return &challenge, err
+}
+
+// CreateChallenge adds a challenge. It returns ErrInvalidChallenge if it ends before it starts or has no goal.
+func (tms *TeamService) CreateChallenge(ctx context.Context, challenge *structures.Challenge) error {
+	if !isValidChallenge(challenge) {
+		return structures.ErrInvalidChallenge
+	}
+
+	challenge.Id = ""
+	challenge.CreatedAt = time.Now().Unix()
+
+	res, err := tms.dbService.collection(ChallengeCollectionName).InsertOne(ctx, challenge)
+	if err != nil {
+		return err
+	}
+
+	challenge.Id = res.InsertedID.(primitive.ObjectID).Hex()
+
+	fmt.Printf("Created challenge %v.\n", challenge.Id)
+
+	return nil
+}
+
+// UpdateChallenge replaces the challenge with the given ID.
+func (tms *TeamService) UpdateChallenge(ctx context.Context, id string, challenge *structures.Challenge) error {
+	if !isValidChallenge(challenge) {
+		return structures.ErrInvalidChallenge
+	}
+
+	existing, err := tms.GetChallenge(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	objectId, _ := primitive.ObjectIDFromHex(id)
+
+	challenge.Id = ""
+	challenge.CreatedAt = existing.CreatedAt
+
+	res, err := tms.dbService.collection(ChallengeCollectionName).ReplaceOne(ctx, bson.M{"_id": objectId}, challenge)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return structures.ErrNoChallenge
+	}
+
+	challenge.Id = id
+
+	return nil
+}
+
+func (tms *TeamService) DeleteChallenge(ctx context.Context, id string) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return structures.ErrNoChallenge
+	}
+
+	res, err := tms.dbService.collection(ChallengeCollectionName).DeleteOne(ctx, bson.M{"_id": objectId})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return structures.ErrNoChallenge
+	}
+
+	return nil
+}
+
+func isValidChallenge(challenge *structures.Challenge) bool {
+	return challenge.EndsAt > challenge.StartsAt && challenge.Goal > 0 &&
+		(challenge.Metric == structures.METRIC_CREDITS || challenge.Metric == structures.METRIC_WEIGHT)
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/totp"
+	"unreal.sh/echo/internal/utils"
+)
+
+const recoveryCodeCount = 10
+
+type TwoFactorService struct {
+	issuer string
+
+	dbService *DatabaseService
+}
+
+func (tfs *TwoFactorService) Init(ctx context.Context, dbService *DatabaseService) error {
+	tfs.issuer = utils.GetenvOr("TOTP_ISSUER", "Ecobucks")
+	tfs.dbService = dbService
+
+	return nil
+}
+
+// BeginEnrollment generates a new TOTP secret for the user and stores it, not yet enabled.
+// It returns the secret and the provisioning URI to be shown as a QR code.
+func (tfs *TwoFactorService) BeginEnrollment(user *structures.User) (string, string, error) {
+	if user.HasTwoFactor() {
+		return "", "", structures.ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = tfs.dbService.UpdateUserById(user.Id, bson.M{"$set": bson.M{
+		"two_factor": structures.TwoFactor{Secret: secret},
+	}})
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.ProvisioningURI(tfs.issuer, user.Username, secret), nil
+}
+
+// ConfirmEnrollment enables 2FA once the user proves their authenticator app works.
+// It returns the recovery codes, which are only ever shown this once.
+func (tfs *TwoFactorService) ConfirmEnrollment(user *structures.User, code string) ([]string, error) {
+	if user.TwoFactor == nil {
+		return nil, structures.ErrTwoFactorNotEnrolled
+	}
+
+	if user.HasTwoFactor() {
+		return nil, structures.ErrTwoFactorAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(user.TwoFactor.Secret, code, time.Now())
+	if !ok {
+		return nil, structures.ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = tfs.dbService.UpdateUserById(user.Id, bson.M{"$set": bson.M{
+		"two_factor.enabled":        true,
+		"two_factor.enabled_at":     time.Now().Unix(),
+		"two_factor.last_used_step": step,
+		"two_factor.recovery_codes": hashes,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable removes the user's 2FA enrollment after checking a TOTP or recovery code.
+func (tfs *TwoFactorService) Disable(user *structures.User, code string) error {
+	err := tfs.Verify(user, code)
+	if err != nil {
+		return err
+	}
+
+	return tfs.dbService.UpdateUserById(user.Id, bson.M{"$unset": bson.M{"two_factor": ""}})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a TOTP code.
+func (tfs *TwoFactorService) RegenerateRecoveryCodes(user *structures.User, code string) ([]string, error) {
+	err := tfs.Verify(user, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = tfs.dbService.UpdateUserById(user.Id, bson.M{"$set": bson.M{"two_factor.recovery_codes": hashes}})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Verify checks a TOTP code or, failing that, a recovery code for a user with 2FA enabled.
+// TOTP codes can't be replayed, and recovery codes are consumed on use.
+func (tfs *TwoFactorService) Verify(user *structures.User, code string) error {
+	if !user.HasTwoFactor() {
+		return structures.ErrTwoFactorNotEnrolled
+	}
+
+	objectId, err := primitive.ObjectIDFromHex(user.Id)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	users := tfs.dbService.collection(UserCollectionName)
+
+	if step, ok := totp.Validate(user.TwoFactor.Secret, code, time.Now()); ok {
+		// Only accept steps newer than the last one used, so an intercepted code is worthless.
+		res, err := users.UpdateOne(context.Background(),
+			bson.M{"_id": objectId, "two_factor.last_used_step": bson.M{"$lt": step}},
+			bson.M{"$set": bson.M{"two_factor.last_used_step": step}})
+		if err != nil {
+			fmt.Printf("Failed to record TOTP use for user %v: %v\n", user.Id, err)
+			return err
+		}
+
+		if res.ModifiedCount == 0 {
+			return structures.ErrInvalidTwoFactorCode
+		}
+
+		return nil
+	}
+
+	hash := hashRecoveryCode(code)
+
+	res, err := users.UpdateOne(context.Background(),
+		bson.M{"_id": objectId, "two_factor.recovery_codes": hash},
+		bson.M{"$pull": bson.M{"two_factor.recovery_codes": hash}})
+	if err != nil {
+		fmt.Printf("Failed to consume recovery code for user %v: %v\n", user.Id, err)
+		return err
+	}
+
+	if res.ModifiedCount == 0 {
+		return structures.ErrInvalidTwoFactorCode
+	}
+
+	fmt.Printf("User %v used a recovery code.\n", user.Id)
+
+	return nil
+}
+
+// IsRequired reports whether any of the user's roles must have 2FA enabled.
+func (tfs *TwoFactorService) IsRequired(user *structures.User) (bool, error) {
+	settings, err := tfs.dbService.GetSecuritySettings()
+	if err != nil {
+		return false, err
+	}
+
+	for _, role := range user.Roles() {
+		if slices.Contains(settings.TwoFactorRequiredRoles, role) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// generateRecoveryCodes returns new recovery codes and the hashes to store.
+// Recovery codes are random, so a fast hash is enough to protect them at rest.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 5)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := hex.EncodeToString(b)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -3,11 +3,14 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 type UserService struct {
@@ -57,3 +60,37 @@ func (us *UserService) Init(ctx context.Context) error {
 
 	return nil
 }
+
+// AvatarUrl returns the public URL of the user's avatar.
+func (us *UserService) AvatarUrl(userId string) string {
+	return fmt.Sprintf(us.avatarUrlFormat, us.bucketName, userId)
+}
+
+// DeleteAvatar removes the user's avatar from storage, if they uploaded one.
+func (us *UserService) DeleteAvatar(ctx context.Context, userId string) error {
+	_, err := us.S3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &us.bucketName,
+		Key:    &userId,
+	})
+
+	return err
+}
+
+// GetAvatar downloads the user's avatar from storage. It returns nil if they never uploaded one.
+func (us *UserService) GetAvatar(ctx context.Context, userId string) ([]byte, error) {
+	object, err := us.S3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &us.bucketName,
+		Key:    &userId,
+	})
+
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer object.Body.Close()
+
+	return io.ReadAll(object.Body)
+}
@@ -0,0 +1,442 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"unreal.sh/echo/internal/structures"
+	"unreal.sh/echo/internal/utils"
+)
+
+const WebhookEndpointCollectionName = "webhook_endpoints"
+const WebhookDeliveryCollectionName = "webhook_deliveries"
+
+const webhookPollInterval = 5 * time.Second
+const webhookMaxBackoff = 6 * time.Hour
+
+// WebhookService sends events to partner endpoints. Events are queued as one delivery per
+// subscribed endpoint and sent in the background, retrying failures with exponential backoff
+// until they run out of attempts and are left dead for an admin to look into and redeliver.
+//
+// Every request is signed with the endpoint's secret. The X-Echo-Signature header holds
+// "t=<timestamp>,v1=<signature>", the signature being the hex HMAC-SHA256 of the timestamp,
+// a dot and the body, so receivers can reject stale or tampered requests.
+type WebhookService struct {
+	maxAttempts int
+	retryBase   time.Duration
+
+	dbService  *DatabaseService
+	httpClient *http.Client
+}
+
+// Init reads WEBHOOK_MAX_ATTEMPTS, the number of attempts before a delivery is dead, defaulting
+// to 10, and WEBHOOK_RETRY_BASE_SECONDS, the delay before the first retry, which doubles with
+// every attempt, defaulting to 30.
+func (whs *WebhookService) Init(ctx context.Context, dbService *DatabaseService) error {
+	maxAttempts, err := strconv.Atoi(utils.GetenvOr("WEBHOOK_MAX_ATTEMPTS", "10"))
+	if err != nil || maxAttempts < 1 {
+		return errors.New("invalid WEBHOOK_MAX_ATTEMPTS environment variable")
+	}
+
+	retryBase, err := strconv.Atoi(utils.GetenvOr("WEBHOOK_RETRY_BASE_SECONDS", "30"))
+	if err != nil || retryBase < 1 {
+		return errors.New("invalid WEBHOOK_RETRY_BASE_SECONDS environment variable")
+	}
+
+	whs.maxAttempts = maxAttempts
+	whs.retryBase = time.Duration(retryBase) * time.Second
+
+	whs.dbService = dbService
+	whs.httpClient = &http.Client{Timeout: 10 * time.Second}
+
+	_, err = dbService.collection(WebhookDeliveryCollectionName).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "event_id", Value: 1}, {Key: "endpoint_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "endpoint_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		fmt.Printf("Failed to create webhook delivery indexes: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// ListEndpoints returns every webhook endpoint, without their secrets.
+func (whs *WebhookService) ListEndpoints(ctx context.Context) ([]structures.WebhookEndpoint, error) {
+	cursor, err := whs.dbService.collection(WebhookEndpointCollectionName).Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := []structures.WebhookEndpoint{}
+	err = cursor.All(ctx, &endpoints)
+
+	for i := range endpoints {
+		endpoints[i].Secret = ""
+	}
+
+	return endpoints, err
+}
+
+// CreateEndpoint registers an endpoint with a newly generated secret, which is only returned here.
+func (whs *WebhookService) CreateEndpoint(ctx context.Context, endpoint *structures.WebhookEndpoint) error {
+	if !isValidWebhookEndpoint(endpoint) {
+		return structures.ErrInvalidWebhookEndpoint
+	}
+
+	endpoint.Id = ""
+	endpoint.Secret = "whsec_" + randomUrlString(32)
+	endpoint.CreatedAt = time.Now().Unix()
+
+	res, err := whs.dbService.collection(WebhookEndpointCollectionName).InsertOne(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+
+	endpoint.Id = res.InsertedID.(primitive.ObjectID).Hex()
+
+	fmt.Printf("Created webhook endpoint %v for %v.\n", endpoint.Id, endpoint.Url)
+
+	return nil
+}
+
+// UpdateEndpoint changes the URL, description, event filter and whether the endpoint is
+// disabled. The secret stays the same.
+func (whs *WebhookService) UpdateEndpoint(ctx context.Context, endpoint *structures.WebhookEndpoint) error {
+	if !isValidWebhookEndpoint(endpoint) {
+		return structures.ErrInvalidWebhookEndpoint
+	}
+
+	objectId, err := primitive.ObjectIDFromHex(endpoint.Id)
+	if err != nil {
+		return structures.ErrNoWebhookEndpoint
+	}
+
+	err = whs.dbService.collection(WebhookEndpointCollectionName).FindOneAndUpdate(ctx, bson.M{"_id": objectId},
+		bson.M{"$set": bson.M{
+			"url":         endpoint.Url,
+			"description": endpoint.Description,
+			"events":      endpoint.Events,
+			"disabled":    endpoint.Disabled,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(endpoint)
+	if err == mongo.ErrNoDocuments {
+		return structures.ErrNoWebhookEndpoint
+	} else if err != nil {
+		return err
+	}
+
+	endpoint.Secret = ""
+
+	return nil
+}
+
+// DeleteEndpoint removes an endpoint along with its deliveries.
+func (whs *WebhookService) DeleteEndpoint(ctx context.Context, id string) error {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return structures.ErrNoWebhookEndpoint
+	}
+
+	res, err := whs.dbService.collection(WebhookEndpointCollectionName).DeleteOne(ctx, bson.M{"_id": objectId})
+	if err != nil {
+		return err
+	} else if res.DeletedCount == 0 {
+		return structures.ErrNoWebhookEndpoint
+	}
+
+	_, err = whs.dbService.collection(WebhookDeliveryCollectionName).DeleteMany(ctx, bson.M{"endpoint_id": id})
+
+	return err
+}
+
+func (whs *WebhookService) getEndpoint(ctx context.Context, id string) (*structures.WebhookEndpoint, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, structures.ErrNoWebhookEndpoint
+	}
+
+	var endpoint structures.WebhookEndpoint
+	err = whs.dbService.collection(WebhookEndpointCollectionName).FindOne(ctx, bson.M{"_id": objectId}).
+		Decode(&endpoint)
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrNoWebhookEndpoint
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &endpoint, nil
+}
+
+// Enqueue queues an event for every endpoint subscribed to its type. Queueing the same event
+// again only adds deliveries for endpoints that don't have it yet.
+func (whs *WebhookService) Enqueue(ctx context.Context, event *structures.WebhookEvent) error {
+	endpoints, err := whs.ListEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+
+	deliveries := []interface{}{}
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribes(event.Type) {
+			continue
+		}
+
+		deliveries = append(deliveries, structures.WebhookDelivery{
+			EndpointId:    endpoint.Id,
+			EventId:       event.Id,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        structures.DELIVERY_PENDING,
+			CreatedAt:     now,
+			NextAttemptAt: now,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	_, err = whs.dbService.collection(WebhookDeliveryCollectionName).InsertMany(ctx, deliveries,
+		options.InsertMany().SetOrdered(false))
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+
+	return err
+}
+
+// ListDeliveries returns the latest deliveries, optionally only those with the given status
+// or to the given endpoint.
+func (whs *WebhookService) ListDeliveries(ctx context.Context, status structures.WebhookDeliveryStatus,
+	endpointId string, limit int) ([]structures.WebhookDelivery, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	if endpointId != "" {
+		filter["endpoint_id"] = endpointId
+	}
+
+	cursor, err := whs.dbService.collection(WebhookDeliveryCollectionName).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []structures.WebhookDelivery{}
+	err = cursor.All(ctx, &deliveries)
+
+	return deliveries, err
+}
+
+// Redeliver queues a delivery to be sent again right away, with a fresh set of attempts.
+func (whs *WebhookService) Redeliver(ctx context.Context, id string) (*structures.WebhookDelivery, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, structures.ErrNoWebhookDelivery
+	}
+
+	var delivery structures.WebhookDelivery
+	err = whs.dbService.collection(WebhookDeliveryCollectionName).FindOneAndUpdate(ctx, bson.M{"_id": objectId},
+		bson.M{
+			"$set":   bson.M{"status": structures.DELIVERY_PENDING, "attempts": 0, "next_attempt_at": time.Now().Unix()},
+			"$unset": bson.M{"delivered_at": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, structures.ErrNoWebhookDelivery
+	} else if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Queued webhook delivery %v for redelivery.\n", delivery.Id)
+
+	return &delivery, nil
+}
+
+// Start sends due deliveries, periodically until ctx is done.
+func (whs *WebhookService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(webhookPollInterval)
+		defer ticker.Stop()
+
+		for {
+			whs.ProcessDue(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ProcessDue sends every pending delivery that is due.
+func (whs *WebhookService) ProcessDue(ctx context.Context) {
+	deliveries := whs.dbService.collection(WebhookDeliveryCollectionName)
+
+	for ctx.Err() == nil {
+		// Claim one delivery at a time by pushing it back past the request timeout, so replicas
+		// running this concurrently don't send it twice, and a crash midway retries it later.
+		now := time.Now()
+
+		var delivery structures.WebhookDelivery
+		err := deliveries.FindOneAndUpdate(ctx,
+			bson.M{"status": structures.DELIVERY_PENDING, "next_attempt_at": bson.M{"$lte": now.Unix()}},
+			bson.M{"$set": bson.M{"next_attempt_at": now.Add(2 * whs.httpClient.Timeout).Unix()}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}),
+		).Decode(&delivery)
+
+		if err == mongo.ErrNoDocuments {
+			return
+		} else if err != nil {
+			fmt.Printf("Failed to find due webhook deliveries: %v\n", err)
+			return
+		}
+
+		err = whs.attempt(ctx, &delivery)
+		if err != nil {
+			fmt.Printf("Failed to update webhook delivery %v: %v\n", delivery.Id, err)
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome, scheduling a retry on failure.
+func (whs *WebhookService) attempt(ctx context.Context, delivery *structures.WebhookDelivery) error {
+	objectId, err := primitive.ObjectIDFromHex(delivery.Id)
+	if err != nil {
+		return structures.ErrInvalidDatabaseId
+	}
+
+	deliveries := whs.dbService.collection(WebhookDeliveryCollectionName)
+	attempts := delivery.Attempts + 1
+
+	endpoint, err := whs.getEndpoint(ctx, delivery.EndpointId)
+	if err == structures.ErrNoWebhookEndpoint || (err == nil && endpoint.Disabled) {
+		_, err = deliveries.UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{"$set": bson.M{
+			"status":     structures.DELIVERY_DEAD,
+			"last_error": "The endpoint was deleted or disabled.",
+		}})
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	statusCode, err := whs.send(ctx, endpoint, delivery)
+	if err == nil {
+		_, err = deliveries.UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{
+			"$set":   bson.M{"status": structures.DELIVERY_DELIVERED, "attempts": attempts, "delivered_at": time.Now().Unix()},
+			"$unset": bson.M{"next_attempt_at": "", "last_error": "", "last_status_code": ""},
+		})
+		return err
+	}
+
+	update := bson.M{"attempts": attempts, "last_error": err.Error(), "last_status_code": statusCode}
+
+	if attempts >= whs.maxAttempts {
+		update["status"] = structures.DELIVERY_DEAD
+		fmt.Printf("Webhook delivery %v to %v is dead after %d attempts: %v\n", delivery.Id, endpoint.Url, attempts, err)
+	} else {
+		update["next_attempt_at"] = time.Now().Add(whs.backoff(attempts)).Unix()
+	}
+
+	_, err = deliveries.UpdateOne(ctx, bson.M{"_id": objectId}, bson.M{"$set": update})
+
+	return err
+}
+
+// backoff returns how long to wait after the given number of failed attempts.
+func (whs *WebhookService) backoff(attempts int) time.Duration {
+	delay := whs.retryBase
+	for i := 1; i < attempts && delay < webhookMaxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, webhookMaxBackoff)
+}
+
+// send POSTs a delivery to its endpoint, returning the response status code, if there was one,
+// and an error unless it is a 2xx.
+func (whs *WebhookService) send(ctx context.Context, endpoint *structures.WebhookEndpoint,
+	delivery *structures.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Echo-Webhooks/1.0")
+	req.Header.Set("X-Echo-Event", string(delivery.EventType))
+	req.Header.Set("X-Echo-Delivery", delivery.Id)
+	req.Header.Set("X-Echo-Signature", "t="+timestamp+",v1="+signWebhook(endpoint.Secret, timestamp, delivery.Payload))
+
+	res, err := whs.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("endpoint responded with %v", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
+
+func signWebhook(secret string, timestamp string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func isValidWebhookEndpoint(endpoint *structures.WebhookEndpoint) bool {
+	u, err := url.Parse(endpoint.Url)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return false
+	}
+
+	for _, eventType := range endpoint.Events {
+		if !slices.Contains(structures.WebhookEventTypes, eventType) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,34 @@
+package structures
+
+type AchievementRuleType string
+
+const (
+	// RULE_CLAIM_COUNT counts claimed disposals.
+	RULE_CLAIM_COUNT AchievementRuleType = "claim_count"
+
+	// RULE_TOTAL_WEIGHT adds up the weight recycled, in grams.
+	RULE_TOTAL_WEIGHT AchievementRuleType = "total_weight"
+
+	// RULE_CONSECUTIVE_DAYS is the longest run of days in a row with at least one claim.
+	RULE_CONSECUTIVE_DAYS AchievementRuleType = "consecutive_days"
+
+	// RULE_DISTINCT_STATIONS counts the different stations disposals were made at.
+	RULE_DISTINCT_STATIONS AchievementRuleType = "distinct_stations"
+)
+
+// Achievement is a badge users earn once their claims meet its rule.
+// Achievements are defined as data, in a file or in the achievements collection.
+type Achievement struct {
+	Id          string          `json:"id"          bson:"_id"`
+	Name        string          `json:"name"        bson:"name"`
+	Description string          `json:"description" bson:"description"`
+	Rule        AchievementRule `json:"rule"        bson:"rule"`
+}
+
+// AchievementRule is met once the measured value reaches the threshold.
+// Rules that measure disposals can be limited to a single disposal type.
+type AchievementRule struct {
+	Type         AchievementRuleType `json:"type"                    bson:"type"`
+	Threshold    float64             `json:"threshold"               bson:"threshold"`
+	DisposalType *DisposalType       `json:"disposal_type,omitempty" bson:"disposal_type,omitempty"`
+}
@@ -0,0 +1,43 @@
+package structures
+
+type Scope string
+
+const (
+	SCOPE_READ_PROFILE    Scope = "read:profile"
+	SCOPE_WRITE_PROFILE   Scope = "write:profile"
+	SCOPE_READ_DISPOSALS  Scope = "read:disposals"
+	SCOPE_WRITE_DISPOSALS Scope = "write:disposals"
+	SCOPE_READ_STATIONS   Scope = "read:stations"
+	SCOPE_WRITE_STATIONS  Scope = "write:stations"
+	SCOPE_READ_MERCHANT   Scope = "read:merchant"
+	SCOPE_WRITE_MERCHANT  Scope = "write:merchant"
+)
+
+// ApiTokenPrefix starts every personal access token, so they are told apart from JWTs.
+const ApiTokenPrefix = "echo_pat_"
+
+// ApiToken is a long-lived personal access token for integrations.
+// Only a hash of the token is stored; the token itself is shown once, on creation.
+type ApiToken struct {
+	Id         string  `json:"id"           bson:"_id,omitempty"`
+	UserId     string  `json:"-"            bson:"user_id"`
+	Name       string  `json:"name"         bson:"name"`
+	Hint       string  `json:"hint"         bson:"hint"`
+	Hash       string  `json:"-"            bson:"hash"`
+	Scopes     []Scope `json:"scopes"       bson:"scopes"`
+	CreatedAt  int64   `json:"created_at"   bson:"created_at"`
+	LastUsedAt int64   `json:"last_used_at" bson:"last_used_at"`
+
+	// ExpiresAt is zero for tokens that never expire.
+	ExpiresAt int64 `json:"expires_at" bson:"expires_at"`
+}
+
+// HasScope reports whether the token grants the given scope.
+func (t *ApiToken) HasScope(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package structures
+
+// Campaign is a time-boxed promotion that grants bonus credits on claims, such as
+// double credits for batteries during a month. It can be limited to a station,
+// a region or a disposal type, and capped per user.
+type Campaign struct {
+	Id          string `json:"id"          bson:"_id,omitempty"`
+	Name        string `json:"name"        bson:"name"`
+	Description string `json:"description" bson:"description"`
+
+	// Multiplier applies to the credits of eligible disposals; 2 doubles them. 1 or less adds nothing.
+	Multiplier float32 `json:"multiplier" bson:"multiplier"`
+
+	// FlatBonus is added once per claim with eligible disposals.
+	FlatBonus float32 `json:"flat_bonus" bson:"flat_bonus"`
+
+	StartsAt int64 `json:"starts_at" bson:"starts_at"`
+	EndsAt   int64 `json:"ends_at"   bson:"ends_at"`
+
+	// StationId, Region and DisposalType narrow down which claims are eligible, when set.
+	StationId    string        `json:"station_id,omitempty"    bson:"station_id,omitempty"`
+	Region       string        `json:"region,omitempty"        bson:"region,omitempty"`
+	DisposalType *DisposalType `json:"disposal_type,omitempty" bson:"disposal_type,omitempty"`
+
+	// CapPerUser is the most bonus credits a user can get from the campaign. Zero means no cap.
+	CapPerUser float32 `json:"cap_per_user" bson:"cap_per_user"`
+
+	CreatedAt int64 `json:"created_at" bson:"created_at"`
+}
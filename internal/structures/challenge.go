@@ -0,0 +1,25 @@
+package structures
+
+// Challenge is a goal teams race to reach within a time window, such as recycling 500kg
+// of batteries in a month. Only claims made during the window count towards it.
+type Challenge struct {
+	Id          string            `json:"id"          bson:"_id,omitempty"`
+	Name        string            `json:"name"        bson:"name"`
+	Description string            `json:"description" bson:"description"`
+	Metric      LeaderboardMetric `json:"metric"      bson:"metric"`
+	Goal        float64           `json:"goal"        bson:"goal"`
+	StartsAt    int64             `json:"starts_at"   bson:"starts_at"`
+	EndsAt      int64             `json:"ends_at"     bson:"ends_at"`
+
+	// DisposalType narrows down which disposals count, when set.
+	DisposalType *DisposalType `json:"disposal_type,omitempty" bson:"disposal_type,omitempty"`
+
+	CreatedAt int64 `json:"created_at" bson:"created_at"`
+}
+
+// ChallengeProgress is how far a team got in a challenge.
+type ChallengeProgress struct {
+	Challenge Challenge `json:"challenge"`
+	Value     float64   `json:"value"`
+	Completed bool      `json:"completed"`
+}
@@ -0,0 +1,28 @@
+package structures
+
+import "time"
+
+type DataExportStatus string
+
+const (
+	EXPORT_PENDING DataExportStatus = "PENDING"
+	EXPORT_READY   DataExportStatus = "READY"
+	EXPORT_FAILED  DataExportStatus = "FAILED"
+)
+
+// DataExport is an archive of everything stored about a user, generated on request.
+// Once ready, it can be downloaded until it expires.
+type DataExport struct {
+	Id          string           `json:"id"                     bson:"_id,omitempty"`
+	UserId      string           `json:"-"                      bson:"user_id"`
+	Status      DataExportStatus `json:"status"                 bson:"status"`
+	Key         string           `json:"-"                      bson:"key"`
+	Size        int64            `json:"size,omitempty"         bson:"size,omitempty"`
+	CreatedAt   int64            `json:"created_at"             bson:"created_at"`
+	CompletedAt int64            `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+	ExpiresAt   time.Time        `json:"expires_at"             bson:"expires_at"`
+
+	// DownloadUrl is a link to the archive that stops working when the export expires.
+	// It is signed anew whenever the export is requested, and never stored.
+	DownloadUrl string `json:"download_url,omitempty" bson:"-"`
+}
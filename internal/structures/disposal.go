@@ -1,7 +1,7 @@
 package structures
 
 type Disposal struct {
-	Credits      float32      `json:"credits"`
-	Weight       float32      `json:"weight"`
-	DisposalType DisposalType `json:"disposal_type"`
+	Credits      float32      `json:"credits"       validate:"min=0"`
+	Weight       float32      `json:"weight"        validate:"gt=0,max=1000000"`
+	DisposalType DisposalType `json:"disposal_type" validate:"min=0,max=3"`
 }
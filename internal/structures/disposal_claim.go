@@ -1,12 +1,34 @@
 package structures
 
 type DisposalClaim struct {
-	Id         string     `json:"id"          bson:"_id,omitempty"`
-	UserId     string     `json:"user_id"     bson:"user_id"`
-	OperatorId string     `json:"operator_id" bson:"operator_id"`
-	Token      string     `json:"token"       bson:"token"`
-	Credits    float32    `json:"credits"     bson:"credits"`
-	IsClaimed  bool       `json:"is_claimed"  bson:"is_claimed"`
-	Disposals  []Disposal `json:"disposals"   bson:"disposals"`
-	Weight     float32    `json:"weight"      bson:"weight"`
+	Id         string     `json:"id"              bson:"_id,omitempty"`
+	UserId     string     `json:"user_id"         bson:"user_id"`
+	OperatorId string     `json:"operator_id"     bson:"operator_id"`
+	Token      string     `json:"token,omitempty" bson:"token"`
+	Credits    float32    `json:"credits"         bson:"credits"`
+	IsClaimed  bool       `json:"is_claimed"      bson:"is_claimed"`
+	Disposals  []Disposal `json:"disposals"       bson:"disposals"`
+	Weight     float32    `json:"weight"          bson:"weight"`
+	CreatedAt  int64      `json:"created_at"      bson:"created_at"`
+	ClaimedAt  int64      `json:"claimed_at"      bson:"claimed_at,omitempty"`
+
+	// ExpiresAt is when the disposal can no longer be claimed. Disposals registered before claim
+	// tokens expired have none.
+	ExpiresAt int64 `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+
+	// IsExpired is set once the disposal expired unclaimed. It keeps its token, which is unique.
+	IsExpired bool `json:"is_expired,omitempty" bson:"is_expired,omitempty"`
+
+	// ExpiryNotified is set once the operator was told the disposal is about to expire unclaimed.
+	ExpiryNotified bool `json:"-" bson:"expiry_notified,omitempty"`
+
+	// StationId and Region are those of the station the disposal was made at, if the operator gave one.
+	StationId string `json:"station_id,omitempty" bson:"station_id,omitempty"`
+	Region    string `json:"region,omitempty"     bson:"region,omitempty"`
+
+	// TeamId is the team the user was in when claiming, which the claim counts towards.
+	TeamId string `json:"team_id,omitempty" bson:"team_id,omitempty"`
+
+	// Impact is computed when the disposal is claimed, with the factors in effect then.
+	Impact *Impact `json:"impact,omitempty" bson:"impact,omitempty"`
 }
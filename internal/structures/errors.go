@@ -40,4 +40,107 @@ var (
 	ErrIncompatibleVersion = errors.New("incompatible version")
 
 	ErrNoDisposal = errors.New("disposal not found")
+
+	// ErrInvalidTwoFactorCode is returned when a TOTP or recovery code is invalid or was already used
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+	// ErrTwoFactorNotEnrolled is returned when 2FA is used by a user who hasn't started enrollment
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication not enrolled")
+
+	// ErrTwoFactorAlreadyEnabled is returned when enrolling a user who already has 2FA enabled
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication already enabled")
+
+	// ErrUnknownOidcProvider is returned when no OpenID Connect provider is configured with the given name
+	ErrUnknownOidcProvider = errors.New("unknown identity provider")
+
+	// ErrInvalidOidcState is returned when an OpenID Connect callback doesn't match a login in progress
+	ErrInvalidOidcState = errors.New("invalid or expired login state")
+
+	// ErrIdentityAlreadyLinked is returned when an external identity is already linked to another user
+	ErrIdentityAlreadyLinked = errors.New("identity already linked to another user")
+
+	// ErrNoSession is returned when a session doesn't exist, was revoked or has expired
+	ErrNoSession = errors.New("session not found")
+
+	// ErrNoApiToken is returned when a personal access token doesn't exist or has expired
+	ErrNoApiToken = errors.New("api token not found")
+
+	// ErrDeletionAlreadyScheduled is returned when deleting an account that is already scheduled for deletion
+	ErrDeletionAlreadyScheduled = errors.New("account deletion already scheduled")
+
+	// ErrDeletionNotScheduled is returned when cancelling the deletion of an account that isn't scheduled for it
+	ErrDeletionNotScheduled = errors.New("account deletion not scheduled")
+
+	// ErrDeletionInProgress is returned when cancelling the deletion of an account that is already being anonymized
+	ErrDeletionInProgress = errors.New("account deletion in progress")
+
+	// ErrDataExportFailed is returned when a user's data couldn't be assembled into an export
+	ErrDataExportFailed = errors.New("data export failed")
+
+	// ErrNoCampaign is returned when a campaign doesn't exist
+	ErrNoCampaign = errors.New("campaign not found")
+
+	// ErrInvalidCampaign is returned when a campaign ends before it starts, or grants no bonus at all
+	ErrInvalidCampaign = errors.New("invalid campaign")
+
+	// ErrInvalidReferralCode is returned when signing up with a referral code no user has
+	ErrInvalidReferralCode = errors.New("invalid referral code")
+
+	// ErrNoMerchant is returned when a merchant doesn't exist
+	ErrNoMerchant = errors.New("merchant not found")
+
+	// ErrNoOffer is returned when an offer doesn't exist, or belongs to another merchant
+	ErrNoOffer = errors.New("offer not found")
+
+	// ErrNoVoucher is returned when a voucher doesn't exist, was already redeemed, has expired,
+	// or can't be redeemed at the merchant
+	ErrNoVoucher = errors.New("voucher not found")
+
+	// ErrInsufficientCredits is returned when a user doesn't have enough credits to pay for something
+	ErrInsufficientCredits = errors.New("insufficient credits")
+
+	// ErrNoTeam is returned when a team doesn't exist, or an invite code matches none
+	ErrNoTeam = errors.New("team not found")
+
+	// ErrAlreadyInTeam is returned when a user in a team tries to create or join another
+	ErrAlreadyInTeam = errors.New("user is already in a team")
+
+	// ErrNotInTeam is returned when a user who isn't in a team tries to leave one
+	ErrNotInTeam = errors.New("user is not in a team")
+
+	// ErrTeamFull is returned when joining a team that reached its member limit
+	ErrTeamFull = errors.New("team is full")
+
+	// ErrNoChallenge is returned when a challenge doesn't exist
+	ErrNoChallenge = errors.New("challenge not found")
+
+	// ErrInvalidChallenge is returned when a challenge ends before it starts, or has no goal
+	ErrInvalidChallenge = errors.New("invalid challenge")
+
+	// ErrCannotFollowSelf is returned when a user tries to follow or block themselves
+	ErrCannotFollowSelf = errors.New("cannot follow or block yourself")
+
+	// ErrNoWebhookEndpoint is returned when the webhook endpoint is not found
+	ErrNoWebhookEndpoint = errors.New("webhook endpoint not found")
+
+	// ErrInvalidWebhookEndpoint is returned when a webhook endpoint has a bad URL or an unknown event
+	ErrInvalidWebhookEndpoint = errors.New("invalid webhook endpoint")
+
+	// ErrNoWebhookDelivery is returned when the webhook delivery is not found
+	ErrNoWebhookDelivery = errors.New("webhook delivery not found")
+
+	// ErrNoJob is returned when no scheduled job has the given name
+	ErrNoJob = errors.New("job not found")
+
+	// ErrNoNotification is returned when the notification is not found
+	ErrNoNotification = errors.New("notification not found")
+
+	// ErrNoDevice is returned when the device is not found
+	ErrNoDevice = errors.New("device not found")
+
+	// ErrDisposalAlreadyClaimed is returned when claiming a disposal that was claimed in the meantime
+	ErrDisposalAlreadyClaimed = errors.New("disposal already claimed")
+
+	// ErrDisposalAlreadyExists is returned when a disposal with the same token already exists
+	ErrDisposalAlreadyExists = errors.New("disposal already exists")
 )
@@ -0,0 +1,31 @@
+package structures
+
+type EventType string
+
+const (
+	EVENT_CLAIM  EventType = "claim"
+	EVENT_BADGE  EventType = "badge"
+	EVENT_STREAK EventType = "streak"
+)
+
+// Event is something a user did that their followers see in their feed.
+// Only the fields relevant to its type are set.
+type Event struct {
+	Id        string    `json:"id"         bson:"_id,omitempty"`
+	UserId    string    `json:"-"          bson:"user_id"`
+	Type      EventType `json:"type"       bson:"type"`
+	CreatedAt int64     `json:"created_at" bson:"created_at"`
+
+	// Weight is how much was recycled in a claim, in grams.
+	Weight float32 `json:"weight,omitempty" bson:"weight,omitempty"`
+
+	BadgeId   string `json:"badge_id,omitempty"   bson:"badge_id,omitempty"`
+	BadgeName string `json:"badge_name,omitempty" bson:"badge_name,omitempty"`
+
+	StreakType   StreakType `json:"streak_type,omitempty"   bson:"streak_type,omitempty"`
+	StreakLength int        `json:"streak_length,omitempty" bson:"streak_length,omitempty"`
+
+	// Name and Username are those of the user, set when reading a feed.
+	Name     string `json:"name"     bson:"-"`
+	Username string `json:"username" bson:"-"`
+}
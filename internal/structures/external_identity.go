@@ -0,0 +1,26 @@
+package structures
+
+import "time"
+
+// ExternalIdentity links a user to an account at an OpenID Connect provider.
+type ExternalIdentity struct {
+	Provider string `json:"provider"  bson:"provider"`
+	Subject  string `json:"subject"   bson:"subject"`
+	Email    string `json:"email"     bson:"email,omitempty"`
+	LinkedAt int64  `json:"linked_at" bson:"linked_at"`
+}
+
+// OidcState is what the server remembers between starting a login and the provider's callback.
+type OidcState struct {
+	State        string `bson:"_id"`
+	Provider     string `bson:"provider"`
+	Nonce        string `bson:"nonce"`
+	CodeVerifier string `bson:"code_verifier"`
+
+	// LinkUserId and LinkSessionId are set when an already authenticated user started the flow
+	// to link the identity.
+	LinkUserId    string `bson:"link_user_id,omitempty"`
+	LinkSessionId string `bson:"link_session_id,omitempty"`
+
+	ExpiresAt time.Time `bson:"expires_at"`
+}
@@ -0,0 +1,21 @@
+package structures
+
+// Follow is a user following another. Two users following each other are friends,
+// and can see each other's friends-only profiles.
+type Follow struct {
+	Id         string `json:"-"          bson:"_id,omitempty"`
+	FollowerId string `json:"-"          bson:"follower_id"`
+	FolloweeId string `json:"-"          bson:"followee_id"`
+	CreatedAt  int64  `json:"created_at" bson:"created_at"`
+}
+
+// FollowEntry is a user in a list of followers or followed users.
+type FollowEntry struct {
+	Name     string `json:"name,omitempty"`
+	Username string `json:"username,omitempty"`
+	Hidden   bool   `json:"hidden"`
+
+	// Mutual is set when both users follow each other, making them friends.
+	Mutual bool  `json:"mutual"`
+	Since  int64 `json:"since"`
+}
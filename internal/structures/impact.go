@@ -0,0 +1,25 @@
+package structures
+
+// Impact is the environmental benefit of recycling something instead of throwing it away.
+type Impact struct {
+	Co2e   float64 `json:"co2e_kg"    bson:"co2e_kg"`
+	Energy float64 `json:"energy_kwh" bson:"energy_kwh"`
+	Water  float64 `json:"water_l"    bson:"water_l"`
+}
+
+// Add returns the sum of both impacts.
+func (i Impact) Add(other Impact) Impact {
+	return Impact{
+		Co2e:   i.Co2e + other.Co2e,
+		Energy: i.Energy + other.Energy,
+		Water:  i.Water + other.Water,
+	}
+}
+
+// ImpactFactor is the impact of recycling a kilogram of a disposal type.
+type ImpactFactor struct {
+	DisposalType DisposalType `json:"disposal_type"`
+	Co2ePerKg    float64      `json:"co2e_kg_per_kg"`
+	EnergyPerKg  float64      `json:"energy_kwh_per_kg"`
+	WaterPerKg   float64      `json:"water_l_per_kg"`
+}
@@ -0,0 +1,5 @@
+package inputs
+
+type BlockUserInput struct {
+	Username string `json:"username" validate:"required,max=32"`
+}
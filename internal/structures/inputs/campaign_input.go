@@ -0,0 +1,16 @@
+package inputs
+
+import "unreal.sh/echo/internal/structures"
+
+type CampaignInput struct {
+	Name         string                   `json:"name"          validate:"required,max=100"`
+	Description  string                   `json:"description"   validate:"max=1000"`
+	Multiplier   float32                  `json:"multiplier"    validate:"min=0,max=10"`
+	FlatBonus    float32                  `json:"flat_bonus"    validate:"min=0,max=100000"`
+	StartsAt     int64                    `json:"starts_at"     validate:"required"`
+	EndsAt       int64                    `json:"ends_at"       validate:"required"`
+	StationId    string                   `json:"station_id"    validate:"max=64"`
+	Region       string                   `json:"region"        validate:"max=64"`
+	DisposalType *structures.DisposalType `json:"disposal_type" validate:"min=0,max=3"`
+	CapPerUser   float32                  `json:"cap_per_user"  validate:"min=0"`
+}
@@ -0,0 +1,13 @@
+package inputs
+
+import "unreal.sh/echo/internal/structures"
+
+type ChallengeInput struct {
+	Name         string                       `json:"name"          validate:"required,max=100"`
+	Description  string                       `json:"description"   validate:"max=1000"`
+	Metric       structures.LeaderboardMetric `json:"metric"        validate:"required,oneof=credits weight"`
+	Goal         float64                      `json:"goal"          validate:"gt=0"`
+	StartsAt     int64                        `json:"starts_at"     validate:"required"`
+	EndsAt       int64                        `json:"ends_at"       validate:"required"`
+	DisposalType *structures.DisposalType     `json:"disposal_type" validate:"min=0,max=3"`
+}
@@ -2,5 +2,5 @@ package inputs
 
 type ClaimDisposalInput struct {
 	UserToken     string `json:"user_token"`
-	DisposalToken string `json:"disposal_token"`
+	DisposalToken string `json:"disposal_token" validate:"required"`
 }
@@ -1,7 +1,10 @@
 package inputs
 
 type CreateAccountInput struct {
-	Name     string `json:"name"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Name     string `json:"name"     validate:"required,min=1,max=64"`
+	Username string `json:"username" validate:"required,min=3,max=32,username"`
+	Password string `json:"password" validate:"required,min=8,maxbytes=72,password"`
+
+	// ReferralCode is the code of the user who invited this one, if any.
+	ReferralCode string `json:"referral_code" validate:"max=32"`
 }
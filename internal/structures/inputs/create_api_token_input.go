@@ -0,0 +1,11 @@
+package inputs
+
+import "unreal.sh/echo/internal/structures"
+
+type CreateApiTokenInput struct {
+	Name   string             `json:"name"   validate:"required,max=64"`
+	Scopes []structures.Scope `json:"scopes" validate:"required,oneof=read:profile write:profile read:disposals write:disposals read:stations write:stations read:merchant write:merchant"`
+
+	// ExpiresInDays is the number of days until the token expires, or 0 for a token that never does.
+	ExpiresInDays int `json:"expires_in_days" validate:"min=0,max=3650"`
+}
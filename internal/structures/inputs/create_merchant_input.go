@@ -0,0 +1,9 @@
+package inputs
+
+type CreateMerchantInput struct {
+	Name        string `json:"name"        validate:"required,max=100"`
+	Description string `json:"description" validate:"max=1000"`
+
+	// Username is the user who runs the merchant, who can then manage its offers.
+	Username string `json:"username" validate:"required,max=32"`
+}
@@ -0,0 +1,6 @@
+package inputs
+
+type CreateTeamInput struct {
+	Name        string `json:"name"        validate:"required,max=64"`
+	Description string `json:"description" validate:"max=1000"`
+}
@@ -0,0 +1,10 @@
+package inputs
+
+type DeleteAccountInput struct {
+	// Password is required for accounts that have one. Accounts without a password or 2FA
+	// have to be deleted from a session signed in within the last few minutes instead.
+	Password string `json:"password"`
+
+	// Code is a TOTP or recovery code, required for accounts with 2FA enabled.
+	Code string `json:"code"`
+}
@@ -0,0 +1,8 @@
+package inputs
+
+// IssueVoucherInput asks for a voucher for an offer, or for an amount of credits
+// any merchant can redeem.
+type IssueVoucherInput struct {
+	OfferId string  `json:"offer_id" validate:"max=64"`
+	Credits float32 `json:"credits"  validate:"min=0,max=1000000"`
+}
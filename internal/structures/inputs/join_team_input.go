@@ -0,0 +1,5 @@
+package inputs
+
+type JoinTeamInput struct {
+	InviteCode string `json:"invite_code" validate:"required,max=32"`
+}
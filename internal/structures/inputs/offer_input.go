@@ -0,0 +1,8 @@
+package inputs
+
+type OfferInput struct {
+	Title       string  `json:"title"       validate:"required,max=100"`
+	Description string  `json:"description" validate:"max=1000"`
+	Credits     float32 `json:"credits"     validate:"gt=0,max=1000000"`
+	Active      bool    `json:"active"`
+}
@@ -0,0 +1,5 @@
+package inputs
+
+type RedeemVoucherInput struct {
+	Code string `json:"code" validate:"required,max=64"`
+}
@@ -0,0 +1,5 @@
+package inputs
+
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
@@ -0,0 +1,9 @@
+package inputs
+
+import "unreal.sh/echo/internal/structures"
+
+type RegisterDeviceInput struct {
+	Platform structures.DevicePlatform `json:"platform" validate:"required,oneof=ios android web"`
+	Token    string                    `json:"token"    validate:"required,max=4096"`
+	Name     string                    `json:"name"     validate:"max=64"`
+}
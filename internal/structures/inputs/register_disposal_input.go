@@ -3,6 +3,7 @@ package inputs
 import "unreal.sh/echo/internal/structures"
 
 type RegisterDisposalInput struct {
-	Disposals     []structures.Disposal `json:"disposals"`
+	Disposals     []structures.Disposal `json:"disposals"      validate:"required,min=1,max=100"`
 	OperatorToken *string               `json:"operator_token"`
+	StationId     string                `json:"station_id"     validate:"max=64"`
 }
@@ -3,5 +3,5 @@ package inputs
 import "unreal.sh/echo/internal/structures"
 
 type RegisterEcobucksStationInput struct {
-	Location structures.LocationClaim `json:"location"`
+	Location structures.LocationClaim `json:"location" validate:"required"`
 }
@@ -0,0 +1,5 @@
+package inputs
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" validate:"required"`
+}
@@ -0,0 +1,6 @@
+package inputs
+
+type TwoFactorLoginInput struct {
+	MfaToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code"      validate:"required"`
+}
@@ -0,0 +1,6 @@
+package inputs
+
+type UpdateNotificationPreferenceInput struct {
+	InApp bool `json:"in_app"`
+	Push  bool `json:"push"`
+}
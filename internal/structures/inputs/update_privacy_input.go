@@ -0,0 +1,7 @@
+package inputs
+
+import "unreal.sh/echo/internal/structures"
+
+type UpdatePrivacyInput struct {
+	Visibility structures.Visibility `json:"visibility" validate:"required,oneof=public friends private"`
+}
@@ -0,0 +1,7 @@
+package inputs
+
+import "unreal.sh/echo/internal/structures"
+
+type UpdateSecuritySettingsInput struct {
+	TwoFactorRequiredRoles []structures.Role `json:"two_factor_required_roles" validate:"oneof=user operator admin merchant"`
+}
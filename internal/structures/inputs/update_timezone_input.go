@@ -0,0 +1,5 @@
+package inputs
+
+type UpdateTimezoneInput struct {
+	Timezone string `json:"timezone" validate:"required,max=64,timezone"`
+}
@@ -0,0 +1,10 @@
+package inputs
+
+import "unreal.sh/echo/internal/structures"
+
+type WebhookEndpointInput struct {
+	Url         string                        `json:"url"         validate:"required,max=2048"`
+	Description string                        `json:"description" validate:"max=500"`
+	Events      []structures.WebhookEventType `json:"events"`
+	Disabled    bool                          `json:"disabled"`
+}
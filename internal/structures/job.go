@@ -0,0 +1,39 @@
+package structures
+
+import "time"
+
+type JobRunStatus string
+
+const (
+	JOB_RUNNING   JobRunStatus = "running"
+	JOB_SUCCEEDED JobRunStatus = "succeeded"
+	JOB_FAILED    JobRunStatus = "failed"
+)
+
+// JobRun records one run of a scheduled job.
+type JobRun struct {
+	Id  string `json:"id"  bson:"_id,omitempty"`
+	Job string `json:"job" bson:"job"`
+
+	// Replica identifies the server process that ran the job.
+	Replica    string       `json:"replica"               bson:"replica"`
+	Status     JobRunStatus `json:"status"                bson:"status"`
+	StartedAt  int64        `json:"started_at"            bson:"started_at"`
+	FinishedAt int64        `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+	DurationMs int64        `json:"duration_ms"           bson:"duration_ms"`
+	Error      string       `json:"error,omitempty"       bson:"error,omitempty"`
+
+	// ExpiresAt is set once the run finishes, and the record is removed after it.
+	ExpiresAt *time.Time `json:"-" bson:"expires_at,omitempty"`
+}
+
+// JobInfo describes a scheduled job and how it last ran.
+type JobInfo struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+
+	// Local jobs run on every replica, the others on a single one at a time.
+	Local     bool    `json:"local"`
+	NextRunAt int64   `json:"next_run_at"`
+	LastRun   *JobRun `json:"last_run"`
+}
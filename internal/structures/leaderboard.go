@@ -0,0 +1,55 @@
+package structures
+
+type LeaderboardMetric string
+
+const (
+	METRIC_CREDITS LeaderboardMetric = "credits"
+	METRIC_WEIGHT  LeaderboardMetric = "weight"
+)
+
+// LeaderboardGroup is what a leaderboard ranks: individual users, or teams.
+type LeaderboardGroup string
+
+const (
+	GROUP_USERS LeaderboardGroup = "users"
+	GROUP_TEAMS LeaderboardGroup = "teams"
+)
+
+type LeaderboardPeriod string
+
+const (
+	PERIOD_WEEKLY   LeaderboardPeriod = "weekly"
+	PERIOD_MONTHLY  LeaderboardPeriod = "monthly"
+	PERIOD_ALL_TIME LeaderboardPeriod = "all"
+)
+
+// Leaderboard is a ranking precomputed from claimed disposals, optionally narrowed
+// down to a disposal type and a station region. Its entries are stored separately.
+type Leaderboard struct {
+	Id           string            `json:"-"             bson:"_id"`
+	Group        LeaderboardGroup  `json:"group"         bson:"group"`
+	Metric       LeaderboardMetric `json:"metric"        bson:"metric"`
+	Period       LeaderboardPeriod `json:"period"        bson:"period"`
+	DisposalType *DisposalType     `json:"disposal_type" bson:"disposal_type"`
+	Region       string            `json:"region"        bson:"region"`
+	PeriodStart  int64             `json:"period_start"  bson:"period_start"`
+	ComputedAt   int64             `json:"computed_at"   bson:"computed_at"`
+
+	// Generation identifies the entries of the latest refresh, so readers never see a half-written one.
+	Generation string `json:"-" bson:"generation"`
+}
+
+type LeaderboardEntry struct {
+	Board      string  `json:"-"    bson:"board"`
+	Generation string  `json:"-"    bson:"generation"`
+	UserId     string  `json:"-"    bson:"user_id,omitempty"`
+	TeamId     string  `json:"team_id,omitempty" bson:"team_id,omitempty"`
+	Rank       int     `json:"rank" bson:"rank"`
+	Value      float64 `json:"value" bson:"value"`
+
+	// Name and Username are left out for users the viewer isn't allowed to see.
+	// Entries of team leaderboards only have a Name, the team's.
+	Name     string `json:"name,omitempty"     bson:"-"`
+	Username string `json:"username,omitempty" bson:"-"`
+	Hidden   bool   `json:"hidden"             bson:"-"`
+}
@@ -3,9 +3,10 @@ package structures
 import "time"
 
 type LocationClaim struct {
-	Latitude  float32       `json:"latitude"`
-	Longitude float32       `json:"longitude"`
+	Latitude  float32       `json:"latitude"   validate:"min=-90,max=90"`
+	Longitude float32       `json:"longitude"  validate:"min=-180,max=180"`
 	Timestamp int64         `json:"timestamp"`
-	StationId string        `json:"station_id"`
+	StationId string        `json:"station_id" validate:"required"`
+	Region    string        `json:"region"     validate:"max=64"`
 	Age       time.Duration `json:"age"`
 }
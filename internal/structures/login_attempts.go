@@ -0,0 +1,11 @@
+package structures
+
+import "time"
+
+// LoginAttempts tracks the failed logins for a single username or IP address.
+type LoginAttempts struct {
+	Key         string    `bson:"_id"`
+	Failures    int       `bson:"failures"`
+	LockedUntil time.Time `bson:"locked_until"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
@@ -0,0 +1,23 @@
+package structures
+
+// Merchant is a business accepting Ecobucks. Its staff are the users whose MerchantId points to it.
+type Merchant struct {
+	Id          string `json:"id"          bson:"_id,omitempty"`
+	Name        string `json:"name"        bson:"name"`
+	Description string `json:"description" bson:"description"`
+	CreatedAt   int64  `json:"created_at"  bson:"created_at"`
+}
+
+// Offer is something a merchant sells for a fixed amount of credits.
+type Offer struct {
+	Id          string  `json:"id"          bson:"_id,omitempty"`
+	MerchantId  string  `json:"merchant_id" bson:"merchant_id"`
+	Title       string  `json:"title"       bson:"title"`
+	Description string  `json:"description" bson:"description"`
+	Credits     float32 `json:"credits"     bson:"credits"`
+	Active      bool    `json:"active"      bson:"active"`
+	CreatedAt   int64   `json:"created_at"  bson:"created_at"`
+
+	// MerchantName is set when listing offers to customers.
+	MerchantName string `json:"merchant_name,omitempty" bson:"-"`
+}
@@ -0,0 +1,78 @@
+package structures
+
+import "time"
+
+type NotificationCategory string
+
+const (
+	// NOTIFY_CREDITS is for credits landing in the user's balance, from claims and bonuses.
+	NOTIFY_CREDITS NotificationCategory = "credits"
+
+	// NOTIFY_REWARDS is for offers the user redeemed before becoming available again.
+	NOTIFY_REWARDS NotificationCategory = "rewards"
+
+	// NOTIFY_CLAIM_EXPIRING is for disposals an operator registered that are about to expire unclaimed.
+	NOTIFY_CLAIM_EXPIRING NotificationCategory = "claim_expiring"
+)
+
+// NotificationCategories lists every category users can set preferences for.
+var NotificationCategories = []NotificationCategory{NOTIFY_CREDITS, NOTIFY_REWARDS, NOTIFY_CLAIM_EXPIRING}
+
+// Notification is a message in a user's in-app inbox, also sent to their devices as a push
+// notification unless they turned that off.
+type Notification struct {
+	Id       string               `json:"id"       bson:"_id,omitempty"`
+	UserId   string               `json:"-"        bson:"user_id"`
+	Category NotificationCategory `json:"category" bson:"category"`
+	Title    string               `json:"title"    bson:"title"`
+	Body     string               `json:"body"     bson:"body"`
+
+	// Data holds identifiers clients can use to open what the notification is about.
+	Data map[string]string `json:"data,omitempty" bson:"data,omitempty"`
+
+	CreatedAt int64 `json:"created_at"        bson:"created_at"`
+	ReadAt    int64 `json:"read_at,omitempty" bson:"read_at,omitempty"`
+
+	// ExpiresAt is when the notification is removed from the inbox.
+	ExpiresAt *time.Time `json:"-" bson:"expires_at,omitempty"`
+}
+
+// NotificationPreference is how the user wants to hear about a category of notifications.
+type NotificationPreference struct {
+	Category NotificationCategory `json:"category" bson:"-"`
+	InApp    bool                 `json:"in_app"   bson:"in_app"`
+	Push     bool                 `json:"push"     bson:"push"`
+}
+
+// NotificationPreference returns the user's preference for the category. Categories they
+// never set are delivered both in-app and as push notifications.
+func (u *User) NotificationPreference(category NotificationCategory) NotificationPreference {
+	preference, found := u.NotificationPreferences[category]
+	if !found {
+		preference = NotificationPreference{InApp: true, Push: true}
+	}
+
+	preference.Category = category
+	return preference
+}
+
+type DevicePlatform string
+
+const (
+	PLATFORM_IOS     DevicePlatform = "ios"
+	PLATFORM_ANDROID DevicePlatform = "android"
+	PLATFORM_WEB     DevicePlatform = "web"
+)
+
+// Device is a user's device registered for push notifications.
+type Device struct {
+	Id       string         `json:"id"       bson:"_id,omitempty"`
+	UserId   string         `json:"-"        bson:"user_id"`
+	Platform DevicePlatform `json:"platform" bson:"platform"`
+	Name     string         `json:"name"     bson:"name"`
+
+	// Token is the address the push provider gave the device. A token is only registered to
+	// one user at a time.
+	Token     string `json:"-"          bson:"token"`
+	CreatedAt int64  `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,24 @@
+package structures
+
+import "time"
+
+// OutboxEvent is an event waiting to be published, written along with the change it describes
+// so neither can be lost without the other. Its ID doubles as the deduplication ID subscribers
+// see, since an event may be published more than once.
+type OutboxEvent struct {
+	Id        string           `json:"id"         bson:"_id,omitempty"`
+	Type      WebhookEventType `json:"type"       bson:"type"`
+	CreatedAt int64            `json:"created_at" bson:"created_at"`
+
+	// Data is the JSON encoded body of the event.
+	Data string `json:"data" bson:"data"`
+
+	Published     bool   `json:"published"                 bson:"published"`
+	PublishedAt   int64  `json:"published_at,omitempty"    bson:"published_at,omitempty"`
+	Attempts      int    `json:"attempts"                  bson:"attempts"`
+	NextAttemptAt int64  `json:"next_attempt_at,omitempty" bson:"next_attempt_at,omitempty"`
+	LastError     string `json:"last_error,omitempty"      bson:"last_error,omitempty"`
+
+	// ExpiresAt is set once the event is published, and the event is removed after it.
+	ExpiresAt *time.Time `json:"-" bson:"expires_at,omitempty"`
+}
@@ -3,7 +3,13 @@ package payloads
 import "unreal.sh/echo/internal/structures"
 
 type AuthenticationPayload struct {
-	Token string              `json:"token"`
-	User  *structures.Profile `json:"user"`
-	Error string              `json:"error"`
+	Token        string              `json:"token"`
+	RefreshToken string              `json:"refresh_token,omitempty"`
+	User         *structures.Profile `json:"user"`
+	Error        string              `json:"error"`
+
+	// MfaRequired is set instead of Token when the user has 2FA enabled.
+	// MfaToken must then be sent to POST /auth/2fa along with a code.
+	MfaRequired bool   `json:"mfa_required"`
+	MfaToken    string `json:"mfa_token,omitempty"`
 }
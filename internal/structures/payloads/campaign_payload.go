@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type CampaignPayload struct {
+	Campaign *structures.Campaign `json:"campaign"`
+	Error    string               `json:"error,omitempty"`
+}
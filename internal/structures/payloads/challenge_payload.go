@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type ChallengePayload struct {
+	Challenge *structures.Challenge `json:"challenge"`
+	Error     string                `json:"error,omitempty"`
+}
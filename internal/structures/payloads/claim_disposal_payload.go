@@ -6,4 +6,12 @@ type ClaimDisposalPayload struct {
 	Success  bool                      `json:"success"`
 	Error    *string                   `json:"error"`
 	Disposal *structures.DisposalClaim `json:"disposal"`
+
+	// Badges are the achievements earned with this claim.
+	Badges []structures.Achievement `json:"badges"`
+
+	// Bonuses are the credits granted on top of the claim's own.
+	Bonuses []structures.Transaction `json:"bonuses"`
+
+	Impact *structures.Impact `json:"impact"`
 }
@@ -0,0 +1,10 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type CreateApiTokenPayload struct {
+	Success  bool                 `json:"success"`
+	Token    string               `json:"token"`
+	ApiToken *structures.ApiToken `json:"api_token"`
+	Error    string               `json:"error"`
+}
@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type DataExportPayload struct {
+	Export *structures.DataExport `json:"export"`
+	Error  string                 `json:"error,omitempty"`
+}
@@ -0,0 +1,7 @@
+package payloads
+
+type DeleteAccountPayload struct {
+	Success             bool   `json:"success"`
+	DeletionScheduledAt int64  `json:"deletion_scheduled_at"`
+	Error               string `json:"error"`
+}
@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type DevicePayload struct {
+	Device *structures.Device `json:"device"`
+}
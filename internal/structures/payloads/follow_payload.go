@@ -0,0 +1,6 @@
+package payloads
+
+type FollowPayload struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
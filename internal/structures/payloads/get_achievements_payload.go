@@ -0,0 +1,10 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetAchievementsPayload struct {
+	Achievements []structures.Achievement `json:"achievements"`
+
+	// Earned holds the IDs of the achievements the current user has earned.
+	Earned []string `json:"earned"`
+}
@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetApiTokensPayload struct {
+	ApiTokens []structures.ApiToken `json:"api_tokens"`
+}
@@ -0,0 +1,6 @@
+package payloads
+
+type GetBlockedPayload struct {
+	// Usernames of the blocked users that still have an account.
+	Usernames []string `json:"usernames"`
+}
@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetCampaignsPayload struct {
+	Campaigns []structures.Campaign `json:"campaigns"`
+}
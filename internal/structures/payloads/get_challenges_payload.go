@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetChallengesPayload struct {
+	Challenges []structures.Challenge `json:"challenges"`
+}
@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetDevicesPayload struct {
+	Devices []structures.Device `json:"devices"`
+}
@@ -0,0 +1,10 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetFeedPayload struct {
+	Events []structures.Event `json:"events"`
+
+	// Next is the cursor of the following page, passed back as `before`. It's empty on the last page.
+	Next string `json:"next,omitempty"`
+}
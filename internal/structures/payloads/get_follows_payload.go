@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetFollowsPayload struct {
+	Users []structures.FollowEntry `json:"users"`
+}
@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetImpactPayload struct {
+	User     structures.Impact `json:"user"`
+	Platform structures.Impact `json:"platform"`
+}
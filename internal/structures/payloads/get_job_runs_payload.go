@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetJobRunsPayload struct {
+	Runs  []structures.JobRun `json:"runs"`
+	Error string              `json:"error,omitempty"`
+}
@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetJobsPayload struct {
+	Jobs []structures.JobInfo `json:"jobs"`
+}
@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetMerchantsPayload struct {
+	Merchants []structures.Merchant `json:"merchants"`
+}
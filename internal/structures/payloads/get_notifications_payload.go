@@ -0,0 +1,11 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetNotificationsPayload struct {
+	Notifications []structures.Notification `json:"notifications"`
+	Unread        int64                     `json:"unread"`
+
+	// Next is the cursor to pass as `before` for older notifications, empty on the last page.
+	Next string `json:"next,omitempty"`
+}
@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetOffersPayload struct {
+	Offers []structures.Offer `json:"offers"`
+}
@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetPublicProfilePayload struct {
+	Profile *structures.PublicProfile `json:"profile"`
+}
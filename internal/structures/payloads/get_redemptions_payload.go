@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetRedemptionsPayload struct {
+	Redemptions []structures.Redemption `json:"redemptions"`
+}
@@ -0,0 +1,11 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetReferralsPayload struct {
+	Code         string                `json:"code"`
+	MaxReferrals int                   `json:"max_referrals"`
+	Pending      int                   `json:"pending"`
+	Rewarded     int                   `json:"rewarded"`
+	Referrals    []structures.Referral `json:"referrals"`
+}
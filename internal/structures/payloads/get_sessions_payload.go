@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetSessionsPayload struct {
+	Sessions []structures.Session `json:"sessions"`
+}
@@ -0,0 +1,11 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetSettlementsPayload struct {
+	Period      structures.SettlementPeriod `json:"period"`
+	Settlements []structures.Settlement     `json:"settlements"`
+
+	// Total sums every settlement listed.
+	Total structures.Settlement `json:"total"`
+}
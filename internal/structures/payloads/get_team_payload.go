@@ -0,0 +1,11 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetTeamPayload struct {
+	Team       *structures.Team               `json:"team"`
+	Totals     structures.TeamTotals          `json:"totals"`
+	Members    []structures.TeamMember        `json:"members"`
+	Challenges []structures.ChallengeProgress `json:"challenges"`
+	Error      string                         `json:"error,omitempty"`
+}
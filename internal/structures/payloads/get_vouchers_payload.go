@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetVouchersPayload struct {
+	Vouchers []structures.Voucher `json:"vouchers"`
+}
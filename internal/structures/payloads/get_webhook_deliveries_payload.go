@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetWebhookDeliveriesPayload struct {
+	Deliveries []structures.WebhookDelivery `json:"deliveries"`
+}
@@ -0,0 +1,7 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type GetWebhookEndpointsPayload struct {
+	Endpoints []structures.WebhookEndpoint `json:"endpoints"`
+}
@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type JobPayload struct {
+	Job   *structures.JobInfo `json:"job"`
+	Error string              `json:"error,omitempty"`
+}
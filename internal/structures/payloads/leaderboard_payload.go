@@ -0,0 +1,11 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type LeaderboardPayload struct {
+	Leaderboard *structures.Leaderboard       `json:"leaderboard"`
+	Entries     []structures.LeaderboardEntry `json:"entries"`
+
+	// Me is the requesting user's entry, even if they aren't in Entries. It's nil if they haven't ranked.
+	Me *structures.LeaderboardEntry `json:"me"`
+}
@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type MerchantPayload struct {
+	Merchant *structures.Merchant `json:"merchant"`
+	Error    string               `json:"error,omitempty"`
+}
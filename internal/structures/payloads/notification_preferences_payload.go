@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type NotificationPreferencesPayload struct {
+	Preferences []structures.NotificationPreference `json:"preferences"`
+	Error       string                              `json:"error,omitempty"`
+}
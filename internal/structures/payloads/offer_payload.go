@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type OfferPayload struct {
+	Offer *structures.Offer `json:"offer"`
+	Error string            `json:"error,omitempty"`
+}
@@ -0,0 +1,7 @@
+package payloads
+
+// OidcLinkPayload holds the URL to send the browser to, to link an identity from the provider.
+type OidcLinkPayload struct {
+	AuthorizationUrl string `json:"authorization_url"`
+	Error            string `json:"error,omitempty"`
+}
@@ -0,0 +1,9 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type RedemptionPayload struct {
+	Success    bool                   `json:"success"`
+	Redemption *structures.Redemption `json:"redemption"`
+	Error      string                 `json:"error,omitempty"`
+}
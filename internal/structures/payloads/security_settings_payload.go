@@ -0,0 +1,9 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type SecuritySettingsPayload struct {
+	Success  bool                         `json:"success"`
+	Settings *structures.SecuritySettings `json:"settings"`
+	Error    string                       `json:"error"`
+}
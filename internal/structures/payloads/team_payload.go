@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type TeamPayload struct {
+	Team  *structures.Team `json:"team"`
+	Error string           `json:"error,omitempty"`
+}
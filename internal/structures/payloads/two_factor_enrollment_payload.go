@@ -0,0 +1,8 @@
+package payloads
+
+type TwoFactorEnrollmentPayload struct {
+	Success         bool   `json:"success"`
+	Secret          string `json:"secret"`
+	ProvisioningUri string `json:"provisioning_uri"`
+	Error           string `json:"error"`
+}
@@ -0,0 +1,7 @@
+package payloads
+
+type TwoFactorRecoveryCodesPayload struct {
+	Success       bool     `json:"success"`
+	RecoveryCodes []string `json:"recovery_codes"`
+	Error         string   `json:"error"`
+}
@@ -0,0 +1,6 @@
+package payloads
+
+type TwoFactorStatusPayload struct {
+	Enabled  bool `json:"enabled"`
+	Required bool `json:"required"`
+}
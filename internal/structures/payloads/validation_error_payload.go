@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/validation"
+
+type ValidationErrorPayload struct {
+	Error  string            `json:"error"`
+	Fields validation.Errors `json:"fields"`
+}
@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type VoucherPayload struct {
+	Voucher *structures.Voucher `json:"voucher"`
+	Error   string              `json:"error,omitempty"`
+}
@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type WebhookDeliveryPayload struct {
+	Delivery *structures.WebhookDelivery `json:"delivery"`
+	Error    string                      `json:"error,omitempty"`
+}
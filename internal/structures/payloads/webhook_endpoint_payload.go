@@ -0,0 +1,8 @@
+package payloads
+
+import "unreal.sh/echo/internal/structures"
+
+type WebhookEndpointPayload struct {
+	Endpoint *structures.WebhookEndpoint `json:"endpoint"`
+	Error    string                      `json:"error,omitempty"`
+}
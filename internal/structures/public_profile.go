@@ -0,0 +1,11 @@
+package structures
+
+// PublicProfile is what other users can see of a user, if the user's visibility allows it.
+// It never includes credits or transactions.
+type PublicProfile struct {
+	Name        string   `json:"name"`
+	Username    string   `json:"username"`
+	AvatarUrl   string   `json:"avatar_url"`
+	TotalWeight float32  `json:"total_weight"`
+	Badges      []string `json:"badges"`
+}
@@ -0,0 +1,26 @@
+package structures
+
+type ReferralStatus string
+
+const (
+	REFERRAL_PENDING  ReferralStatus = "PENDING"
+	REFERRAL_REWARDED ReferralStatus = "REWARDED"
+	REFERRAL_REJECTED ReferralStatus = "REJECTED"
+)
+
+// Referral is a signup made with another user's referral code. Both users get a bonus
+// once the new user claims their first disposal, unless the referral was rejected.
+type Referral struct {
+	Id         string         `json:"id"                    bson:"_id,omitempty"`
+	ReferrerId string         `json:"-"                     bson:"referrer_id"`
+	RefereeId  string         `json:"-"                     bson:"referee_id"`
+	Status     ReferralStatus `json:"status"                bson:"status"`
+	Reason     string         `json:"reason,omitempty"      bson:"reason,omitempty"`
+	CreatedAt  int64          `json:"created_at"            bson:"created_at"`
+	RewardedAt int64          `json:"rewarded_at,omitempty" bson:"rewarded_at,omitempty"`
+
+	// Ip, UserAgent and DeviceName describe the signup, to tell self-referrals apart.
+	Ip         string `json:"-" bson:"ip"`
+	UserAgent  string `json:"-" bson:"user_agent"`
+	DeviceName string `json:"-" bson:"device_name"`
+}
@@ -0,0 +1,10 @@
+package structures
+
+type Role string
+
+const (
+	USER     Role = "user"
+	OPERATOR Role = "operator"
+	ADMIN    Role = "admin"
+	MERCHANT Role = "merchant"
+)
@@ -0,0 +1,19 @@
+package structures
+
+import "time"
+
+// Session is a login on a single device, shared by the access and refresh tokens issued for it.
+// Revoking a session deletes it, which invalidates both tokens.
+type Session struct {
+	Id         string    `json:"id"           bson:"_id,omitempty"`
+	UserId     string    `json:"-"            bson:"user_id"`
+	DeviceName string    `json:"device_name"  bson:"device_name"`
+	UserAgent  string    `json:"user_agent"   bson:"user_agent"`
+	Ip         string    `json:"ip"           bson:"ip"`
+	CreatedAt  int64     `json:"created_at"   bson:"created_at"`
+	LastUsedAt int64     `json:"last_used_at" bson:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"   bson:"expires_at"`
+
+	// Current is set when listing sessions, on the one the request was made with.
+	Current bool `json:"current" bson:"-"`
+}
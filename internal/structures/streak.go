@@ -0,0 +1,35 @@
+package structures
+
+type StreakType string
+
+const (
+	DAILY  StreakType = "daily"
+	WEEKLY StreakType = "weekly"
+)
+
+// Streak counts consecutive days or weeks, in the user's time zone, with at least one claim.
+type Streak struct {
+	Current int `json:"current" bson:"current"`
+	Longest int `json:"longest" bson:"longest"`
+
+	// LastPeriod is the day or week number of the latest claim, counted from the Unix epoch.
+	LastPeriod int64 `json:"-" bson:"last_period"`
+
+	// ExpiresAt is when the streak breaks unless another claim is made, grace period included.
+	ExpiresAt int64 `json:"expires_at" bson:"expires_at"`
+}
+
+// Active returns the streak as of the given time, with Current reset if it has broken since the last claim.
+func (s Streak) Active(now int64) Streak {
+	if now >= s.ExpiresAt {
+		s.Current = 0
+	}
+	return s
+}
+
+// StreakMilestone grants bonus credits when a streak reaches the given length.
+type StreakMilestone struct {
+	Type    StreakType `json:"type"`
+	Length  int        `json:"length"`
+	Credits float32    `json:"credits"`
+}
@@ -0,0 +1,32 @@
+package structures
+
+// Team is a group of users, such as a school or a company, competing together.
+// Users belong to one team at most, and join it with its invite code.
+type Team struct {
+	Id          string `json:"id"           bson:"_id,omitempty"`
+	Name        string `json:"name"         bson:"name"`
+	Description string `json:"description"  bson:"description"`
+	OwnerId     string `json:"-"            bson:"owner_id"`
+	MemberCount int    `json:"member_count" bson:"member_count"`
+	CreatedAt   int64  `json:"created_at"   bson:"created_at"`
+
+	// InviteCode is only shown to members.
+	InviteCode string `json:"invite_code,omitempty" bson:"invite_code"`
+}
+
+// TeamTotals sums claims made by members on behalf of a team.
+type TeamTotals struct {
+	Credits float64 `json:"credits" bson:"credits"`
+	Weight  float64 `json:"weight"  bson:"weight"`
+	Claims  int     `json:"claims"  bson:"claims"`
+}
+
+// TeamMember is a member of a team and what they contributed to it.
+type TeamMember struct {
+	UserId       string     `json:"-"`
+	Name         string     `json:"name,omitempty"`
+	Username     string     `json:"username,omitempty"`
+	Hidden       bool       `json:"hidden"`
+	IsOwner      bool       `json:"is_owner"`
+	Contribution TeamTotals `json:"contribution"`
+}
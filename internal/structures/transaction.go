@@ -5,6 +5,9 @@ type TransactionType string
 const (
 	CLAIM TransactionType = "CLAIM"
 	SPEND TransactionType = "SPEND"
+
+	// BONUS is for credits granted on top of a claim, such as for reaching a streak milestone.
+	BONUS TransactionType = "BONUS"
 )
 
 type Transaction struct {
@@ -14,4 +17,7 @@ type Transaction struct {
 	Credits         float32         `json:"credits"          bson:"credits"`
 	Timestamp       int64           `json:"timestamp"        bson:"timestamp"`
 	Description     string          `json:"description"      bson:"description"`
+
+	// RedemptionId is set on SPEND transactions, to the merchant redemption they paid for.
+	RedemptionId string `json:"redemption_id,omitempty" bson:"redemption_id,omitempty"`
 }
@@ -0,0 +1,16 @@
+package structures
+
+// TwoFactor holds a user's TOTP enrollment.
+// The secret is set when enrollment starts, and Enabled only once a code has been verified.
+type TwoFactor struct {
+	Secret        string   `bson:"secret"`
+	Enabled       bool     `bson:"enabled"`
+	EnabledAt     int64    `bson:"enabled_at"`
+	LastUsedStep  int64    `bson:"last_used_step"`
+	RecoveryCodes []string `bson:"recovery_codes"`
+}
+
+// SecuritySettings are the platform-wide security settings managed by admins.
+type SecuritySettings struct {
+	TwoFactorRequiredRoles []Role `json:"two_factor_required_roles" bson:"two_factor_required_roles"`
+}
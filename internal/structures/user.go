@@ -1,13 +1,54 @@
 package structures
 
+import (
+	"slices"
+	"time"
+)
+
 type User struct {
 	Id           string        `json:"id"           bson:"_id,omitempty"`
 	Name         string        `json:"name"         bson:"name"`
 	Username     string        `json:"username"     bson:"username"`
 	Credits      float64       `json:"credits"      bson:"credits"`
 	IsOperator   bool          `json:"is_operator"  bson:"is_operator"`
+	IsAdmin      bool          `json:"is_admin"     bson:"is_admin"`
 	Transactions []Transaction `json:"transactions" bson:"transactions"`
 	PasswordHash string        `json:"-"            bson:"password_hash"`
+	TwoFactor    *TwoFactor    `json:"-"            bson:"two_factor,omitempty"`
+
+	Identities []ExternalIdentity `json:"-" bson:"identities,omitempty"`
+
+	// MerchantId is set on the staff of a merchant, who can redeem vouchers on its behalf.
+	MerchantId string `json:"merchant_id,omitempty" bson:"merchant_id,omitempty"`
+	TeamId     string `json:"team_id,omitempty"     bson:"team_id,omitempty"`
+
+	// Visibility is empty for accounts created before it existed, which are public.
+	Visibility Visibility `json:"visibility" bson:"visibility,omitempty"`
+	Badges     []string   `json:"badges"     bson:"badges,omitempty"`
+
+	// Blocked holds the IDs of the users this one blocked. Blocked users can't see or follow them.
+	Blocked []string `json:"-" bson:"blocked,omitempty"`
+
+	// NotificationPreferences holds the categories the user changed from the default.
+	NotificationPreferences map[NotificationCategory]NotificationPreference `json:"-" bson:"notification_preferences,omitempty"`
+
+	// ReferralCode is generated at signup, or the first time an older account lists its referrals.
+	ReferralCode string `json:"referral_code" bson:"referral_code,omitempty"`
+
+	// Timezone is the IANA time zone streaks are counted in. Empty means UTC.
+	Timezone     string `json:"timezone"      bson:"timezone,omitempty"`
+	DailyStreak  Streak `json:"daily_streak"  bson:"daily_streak"`
+	WeeklyStreak Streak `json:"weekly_streak" bson:"weekly_streak"`
+
+	// DeletionScheduledAt is when the account will be anonymized, if the user asked for its deletion.
+	DeletionScheduledAt int64  `json:"-" bson:"deletion_scheduled_at,omitempty"`
+	DeletionPseudonym   string `json:"-" bson:"deletion_pseudonym,omitempty"`
+
+	// DeletionStarted is set once anonymizing the account has begun, when it can't be cancelled anymore.
+	DeletionStarted bool `json:"-" bson:"deletion_started,omitempty"`
+
+	// IsDeleted marks the pseudonymous record left behind once an account has been anonymized.
+	IsDeleted bool `json:"-" bson:"is_deleted,omitempty"`
 }
 
 type Profile struct {
@@ -15,15 +56,80 @@ type Profile struct {
 	Username     string        `json:"username"`
 	Credits      float64       `json:"credits"`
 	IsOperator   bool          `json:"is_operator"`
+	IsAdmin      bool          `json:"is_admin"`
+	MerchantId   string        `json:"merchant_id,omitempty"`
+	TeamId       string        `json:"team_id,omitempty"`
+	TwoFactor    bool          `json:"two_factor"`
 	Transactions []Transaction `json:"transactions"`
+	Visibility   Visibility    `json:"visibility"`
+	Badges       []string      `json:"badges"`
+	Timezone     string        `json:"timezone"`
+	ReferralCode string        `json:"referral_code"`
+	DailyStreak  Streak        `json:"daily_streak"`
+	WeeklyStreak Streak        `json:"weekly_streak"`
+
+	DeletionScheduledAt int64 `json:"deletion_scheduled_at,omitempty"`
+}
+
+// Roles returns every role the user holds. All users hold the USER role.
+func (u *User) Roles() []Role {
+	roles := []Role{USER}
+	if u.IsOperator {
+		roles = append(roles, OPERATOR)
+	}
+	if u.IsAdmin {
+		roles = append(roles, ADMIN)
+	}
+	if u.MerchantId != "" {
+		roles = append(roles, MERCHANT)
+	}
+	return roles
+}
+
+// ProfileVisibility returns who the user is visible to.
+func (u *User) ProfileVisibility() Visibility {
+	if u.Visibility == "" {
+		return PUBLIC
+	}
+	return u.Visibility
+}
+
+// HasBlocked reports whether the user blocked the other one.
+func (u *User) HasBlocked(other *User) bool {
+	return slices.Contains(u.Blocked, other.Id)
+}
+
+// HasPassword reports whether the user can sign in with a password, rather than only through
+// an external identity provider.
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+// HasTwoFactor reports whether the user has completed TOTP enrollment.
+func (u *User) HasTwoFactor() bool {
+	return u.TwoFactor != nil && u.TwoFactor.Enabled
 }
 
 func (u *User) ToProfile() *Profile {
+	now := time.Now().Unix()
+
 	return &Profile{
 		Name:         u.Name,
 		Username:     u.Username,
 		Credits:      u.Credits,
 		IsOperator:   u.IsOperator,
+		IsAdmin:      u.IsAdmin,
+		MerchantId:   u.MerchantId,
+		TeamId:       u.TeamId,
+		TwoFactor:    u.HasTwoFactor(),
 		Transactions: u.Transactions,
+		Visibility:   u.ProfileVisibility(),
+		Badges:       u.Badges,
+		Timezone:     u.Timezone,
+		ReferralCode: u.ReferralCode,
+		DailyStreak:  u.DailyStreak.Active(now),
+		WeeklyStreak: u.WeeklyStreak.Active(now),
+
+		DeletionScheduledAt: u.DeletionScheduledAt,
 	}
 }
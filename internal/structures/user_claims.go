@@ -5,5 +5,16 @@ import "github.com/golang-jwt/jwt"
 type UserClaims struct {
 	Name   string `json:"name"`
 	UserId string `json:"user_id"`
+
+	// SessionId is the session the token was issued for. Revoking it invalidates the token.
+	SessionId string `json:"sid,omitempty"`
+
+	// Refresh marks a refresh token, which can only be used at POST /auth/refresh.
+	Refresh bool `json:"refresh,omitempty"`
+
+	// MfaPending marks a token issued after a correct password for a user with 2FA enabled.
+	// It can only be exchanged for a real token at POST /auth/2fa.
+	MfaPending bool `json:"mfa_pending,omitempty"`
+
 	jwt.StandardClaims
 }
@@ -0,0 +1,10 @@
+package structures
+
+// Visibility controls who can see a user on public profiles, leaderboards and feeds.
+type Visibility string
+
+const (
+	PUBLIC  Visibility = "public"
+	FRIENDS Visibility = "friends"
+	PRIVATE Visibility = "private"
+)
@@ -0,0 +1,57 @@
+package structures
+
+import "time"
+
+type VoucherStatus string
+
+const (
+	VOUCHER_ISSUED   VoucherStatus = "ISSUED"
+	VOUCHER_REDEEMED VoucherStatus = "REDEEMED"
+)
+
+// Voucher is a short-lived code a customer shows at a merchant, usually as a QR code, to pay
+// for an offer or a given amount of credits. Credits are only taken once a merchant redeems it.
+type Voucher struct {
+	Id         string        `json:"id"                    bson:"_id,omitempty"`
+	Code       string        `json:"code"                  bson:"code"`
+	UserId     string        `json:"-"                     bson:"user_id"`
+	OfferId    string        `json:"offer_id,omitempty"    bson:"offer_id,omitempty"`
+	OfferTitle string        `json:"offer_title,omitempty" bson:"offer_title,omitempty"`
+	Credits    float32       `json:"credits"               bson:"credits"`
+	Status     VoucherStatus `json:"status"                bson:"status"`
+	CreatedAt  int64         `json:"created_at"            bson:"created_at"`
+	ExpiresAt  time.Time     `json:"expires_at"            bson:"expires_at"`
+
+	// MerchantId is empty for credit vouchers, which any merchant can redeem.
+	MerchantId string `json:"merchant_id,omitempty" bson:"merchant_id,omitempty"`
+}
+
+// Redemption is a voucher burned by a merchant, and what the merchant is settled for.
+type Redemption struct {
+	Id         string  `json:"id"                    bson:"_id,omitempty"`
+	MerchantId string  `json:"merchant_id"           bson:"merchant_id"`
+	VoucherId  string  `json:"voucher_id"            bson:"voucher_id"`
+	OfferId    string  `json:"offer_id,omitempty"    bson:"offer_id,omitempty"`
+	OfferTitle string  `json:"offer_title,omitempty" bson:"offer_title,omitempty"`
+	UserId     string  `json:"-"                     bson:"user_id"`
+	Credits    float32 `json:"credits"               bson:"credits"`
+	RedeemedAt int64   `json:"redeemed_at"           bson:"redeemed_at"`
+
+	// RedeemedBy is the merchant staff member who scanned the voucher.
+	RedeemedBy string `json:"redeemed_by" bson:"redeemed_by"`
+}
+
+type SettlementPeriod string
+
+const (
+	SETTLEMENT_DAILY   SettlementPeriod = "daily"
+	SETTLEMENT_WEEKLY  SettlementPeriod = "weekly"
+	SETTLEMENT_MONTHLY SettlementPeriod = "monthly"
+)
+
+// Settlement totals a merchant's redemptions over a day, week or month, in UTC.
+type Settlement struct {
+	PeriodStart int64   `json:"period_start" bson:"_id"`
+	Redemptions int     `json:"redemptions"  bson:"redemptions"`
+	Credits     float64 `json:"credits"      bson:"credits"`
+}
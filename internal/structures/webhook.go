@@ -0,0 +1,88 @@
+package structures
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+type WebhookEventType string
+
+const (
+	WEBHOOK_DISPOSAL_REGISTERED WebhookEventType = "disposal.registered"
+	WEBHOOK_DISPOSAL_CLAIMED    WebhookEventType = "disposal.claimed"
+	WEBHOOK_DISPOSAL_EXPIRED    WebhookEventType = "disposal.expired"
+	WEBHOOK_USER_CREATED        WebhookEventType = "user.created"
+	WEBHOOK_VOUCHER_REDEEMED    WebhookEventType = "voucher.redeemed"
+)
+
+// WebhookEventTypes lists every event webhook endpoints can subscribe to.
+var WebhookEventTypes = []WebhookEventType{
+	WEBHOOK_DISPOSAL_REGISTERED,
+	WEBHOOK_DISPOSAL_CLAIMED,
+	WEBHOOK_DISPOSAL_EXPIRED,
+	WEBHOOK_USER_CREATED,
+	WEBHOOK_VOUCHER_REDEEMED,
+}
+
+// WebhookEndpoint is a partner URL that receives events as signed POST requests.
+type WebhookEndpoint struct {
+	Id          string `json:"id"          bson:"_id,omitempty"`
+	Url         string `json:"url"         bson:"url"`
+	Description string `json:"description" bson:"description"`
+
+	// Events filters which events are sent to the endpoint. All of them are sent if it's empty.
+	Events    []WebhookEventType `json:"events"     bson:"events"`
+	Disabled  bool               `json:"disabled"   bson:"disabled"`
+	CreatedAt int64              `json:"created_at" bson:"created_at"`
+
+	// Secret signs the payloads sent to the endpoint. It is only shown when the endpoint is created.
+	Secret string `json:"secret,omitempty" bson:"secret"`
+}
+
+// Subscribes reports whether the endpoint should receive events of the given type.
+func (e *WebhookEndpoint) Subscribes(eventType WebhookEventType) bool {
+	if e.Disabled {
+		return false
+	}
+
+	return len(e.Events) == 0 || slices.Contains(e.Events, eventType)
+}
+
+// WebhookEvent is the body of webhook requests. Its ID stays the same across redeliveries,
+// so receivers can ignore events they already handled.
+type WebhookEvent struct {
+	Id        string           `json:"id"`
+	Type      WebhookEventType `json:"type"`
+	CreatedAt int64            `json:"created_at"`
+	Data      json.RawMessage  `json:"data"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DELIVERY_PENDING   WebhookDeliveryStatus = "pending"
+	DELIVERY_DELIVERED WebhookDeliveryStatus = "delivered"
+
+	// DELIVERY_DEAD deliveries ran out of attempts, and are only sent again when redelivered by hand.
+	DELIVERY_DEAD WebhookDeliveryStatus = "dead"
+)
+
+// WebhookDelivery is an event queued for one endpoint.
+type WebhookDelivery struct {
+	Id         string                `json:"id"          bson:"_id,omitempty"`
+	EndpointId string                `json:"endpoint_id" bson:"endpoint_id"`
+	EventId    string                `json:"event_id"    bson:"event_id"`
+	EventType  WebhookEventType      `json:"event_type"  bson:"event_type"`
+	Payload    string                `json:"payload"     bson:"payload"`
+	Status     WebhookDeliveryStatus `json:"status"      bson:"status"`
+	Attempts   int                   `json:"attempts"    bson:"attempts"`
+	CreatedAt  int64                 `json:"created_at"  bson:"created_at"`
+
+	// NextAttemptAt is when the delivery is due to be sent, while it's pending.
+	NextAttemptAt int64 `json:"next_attempt_at,omitempty" bson:"next_attempt_at,omitempty"`
+	DeliveredAt   int64 `json:"delivered_at,omitempty"    bson:"delivered_at,omitempty"`
+
+	// LastError and LastStatusCode describe the latest failed attempt.
+	LastError      string `json:"last_error,omitempty"       bson:"last_error,omitempty"`
+	LastStatusCode int    `json:"last_status_code,omitempty" bson:"last_status_code,omitempty"`
+}
@@ -1,6 +1,12 @@
 package utils
 
-import "os"
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
 
 func GetenvOr(key, fallback string) string {
 	value := os.Getenv(key)
@@ -25,3 +31,82 @@ func Sum[I any, O int | int64 | float32 | float64](list []I, selector func(v I)
 	}
 	return sum
 }
+
+// trustedProxies are the networks of the proxies whose X-Forwarded-For headers ClientIP believes.
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies sets the proxies in front of the server, as a comma-separated list of IP
+// addresses and CIDR ranges such as "10.0.0.0/8". An empty list trusts no proxy.
+func SetTrustedProxies(value string) error {
+	networks := []*net.IPNet{}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			entry = fmt.Sprintf("%s/%d", ip, bits)
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		networks = append(networks, network)
+	}
+
+	trustedProxies = networks
+
+	return nil
+}
+
+// ClientIP returns the IP address of the client that sent the request. When the request came
+// through trusted proxies, that is the last address they added to X-Forwarded-For that isn't one
+// of them, since clients can put anything before it.
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	hops := []string{}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0 && isTrustedProxy(ip); i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+	}
+
+	return ip
+}
+
+func isTrustedProxy(value string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	err := SetTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrustedProxies("")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"untrusted peer", "203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy without header", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"spoofed hops", "10.0.0.1:1234", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chained proxies", "10.0.0.1:1234", []string{"198.51.100.1, 192.0.2.1", "10.0.0.2"}, "198.51.100.1"},
+		{"only proxies", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"invalid hop", "10.0.0.1:1234", []string{"198.51.100.1, garbage"}, "10.0.0.1"},
+		{"no port", "203.0.113.7", nil, "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTrustedProxies(t *testing.T) {
+	defer SetTrustedProxies("")
+
+	for _, value := range []string{"", "10.0.0.1", "10.0.0.0/8, ::1", " 2001:db8::/32 ,"} {
+		if err := SetTrustedProxies(value); err != nil {
+			t.Errorf("SetTrustedProxies(%q) returned %v", value, err)
+		}
+	}
+
+	for _, value := range []string{"proxy", "10.0.0.0/33", "10.0.0.256"} {
+		if err := SetTrustedProxies(value); err == nil {
+			t.Errorf("SetTrustedProxies(%q) = nil, want an error", value)
+		}
+	}
+}
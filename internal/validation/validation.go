@@ -0,0 +1,251 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// TagName is the struct tag read by Validate.
+const TagName = "validate"
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.]+$`)
+
+// FieldError describes a single rule that a field failed to satisfy.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors is the list of every field that failed validation.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate checks v against the rules declared in its `validate` struct tags.
+// Nested structs and slices of structs are validated recursively.
+// It returns nil if every rule is satisfied.
+//
+// Supported rules:
+//   - required: the value must not be the zero value.
+//   - min=N, max=N: bounds the length of strings and slices, or the value of numbers.
+//   - maxbytes=N: bounds the length of strings in bytes rather than characters.
+//   - gt=N: the number must be strictly greater than N.
+//   - username: the string may only contain letters, digits, '_' and '.'.
+//   - password: the string must contain at least one letter and one digit.
+//   - timezone: the string must be an IANA time zone name, such as America/Sao_Paulo.
+//   - oneof=a b c: the string, or every string in the slice, must be one of the listed values.
+func Validate(v any) error {
+	var errs Errors
+	validateValue(reflect.ValueOf(v), "", &errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+func validateValue(v reflect.Value, path string, errs *Errors) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name := fieldName(field)
+			if name == "-" {
+				continue
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+
+			value := v.Field(i)
+			if tag, ok := field.Tag.Lookup(TagName); ok {
+				applyRules(value, name, tag, errs)
+			}
+
+			validateValue(value, name, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+func applyRules(v reflect.Value, field string, tag string, errs *Errors) {
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "" {
+			continue
+		}
+
+		// Optional fields are pointers: nil passes every rule but required,
+		// and the others apply to the value pointed to.
+		value := v
+		if name != "required" && value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+
+		if message, ok := checkRule(value, name, param); !ok {
+			*errs = append(*errs, FieldError{Field: field, Rule: name, Message: message})
+
+			// A missing value fails every other rule too; report it once.
+			if name == "required" {
+				return
+			}
+		}
+	}
+}
+
+func checkRule(v reflect.Value, rule string, param string) (string, bool) {
+	switch rule {
+	case "required":
+		if v.IsZero() {
+			return "is required", false
+		}
+	case "min":
+		if n, ok := measure(v); ok && n < parseParam(param) {
+			return fmt.Sprintf("must be at least %s%s", param, unitOf(v)), false
+		}
+	case "max":
+		if n, ok := measure(v); ok && n > parseParam(param) {
+			return fmt.Sprintf("must be at most %s%s", param, unitOf(v)), false
+		}
+	case "maxbytes":
+		if v.Kind() == reflect.String && float64(v.Len()) > parseParam(param) {
+			return fmt.Sprintf("must be at most %s bytes", param), false
+		}
+	case "gt":
+		if n, ok := measure(v); ok && n <= parseParam(param) {
+			return "must be greater than " + param, false
+		}
+	case "username":
+		if v.Kind() == reflect.String && v.Len() > 0 && !usernamePattern.MatchString(v.String()) {
+			return "may only contain letters, digits, '_' and '.'", false
+		}
+	case "timezone":
+		if v.Kind() == reflect.String && v.Len() > 0 {
+			if _, err := time.LoadLocation(v.String()); err != nil || v.String() == "Local" {
+				return "must be a time zone name, such as America/Sao_Paulo", false
+			}
+		}
+	case "password":
+		if v.Kind() == reflect.String && !isStrongPassword(v.String()) {
+			return "must contain at least one letter and one digit", false
+		}
+	case "oneof":
+		options := strings.Fields(param)
+		for _, value := range stringsOf(v) {
+			if !slices.Contains(options, value) {
+				return "must be one of: " + strings.Join(options, ", "), false
+			}
+		}
+	default:
+		panic("validation: unknown rule " + rule)
+	}
+
+	return "", true
+}
+
+// measure returns the number a min/max/gt rule is compared against:
+// the rune count of strings, the length of slices and maps, or the value of numbers.
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(len([]rune(v.String()))), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+
+	return 0, false
+}
+
+func unitOf(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return " items"
+	}
+
+	return ""
+}
+
+// stringsOf returns the value itself if it is a string, or its elements if it is a slice of strings.
+func stringsOf(v reflect.Value) []string {
+	switch {
+	case v.Kind() == reflect.String:
+		return []string{v.String()}
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		values := make([]string, v.Len())
+		for i := range values {
+			values[i] = v.Index(i).String()
+		}
+		return values
+	}
+
+	return nil
+}
+
+func parseParam(param string) float64 {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic("validation: invalid rule parameter " + param)
+	}
+	return n
+}
+
+func isStrongPassword(password string) bool {
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	return hasLetter && hasDigit
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}